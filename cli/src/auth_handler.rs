@@ -7,22 +7,31 @@ use std::{
 use crate::moonenv_config::MoonenvConfig;
 use crate::{api_util::treat_api_err, cli_struct::OrgActionAuthArgs};
 use anyhow::{anyhow, Ok, Result};
-use reqwest::{Client, StatusCode};
+use reqwest::{header::USER_AGENT, Client, StatusCode};
 use serde::Deserialize;
 
+const DEVICE_CODE_GRANT_TYPE: &str = "urn:ietf:params:oauth:grant-type:device_code";
+const CLI_USER_AGENT: &str = concat!("moonenv-cli/", env!("CARGO_PKG_VERSION"));
+
 #[derive(Deserialize, Debug)]
 struct OAuthSetOfTokenResult {
-    #[serde(alias = "authorizationUri")]
-    authorization_uri: String,
-
-    #[serde(alias = "deviceCode")]
     device_code: String,
+    user_code: String,
+    verification_uri: String,
+    verification_uri_complete: String,
+    interval: u64,
+}
+
+#[derive(Deserialize, Debug)]
+struct OAuthErrorResult {
+    error: String,
+    error_description: Option<String>,
 }
 
 #[derive(Deserialize, Debug, Clone)]
 struct OAuthTokenResult {
-    #[serde(alias = "idToken")]
-    id_token: String,
+    #[serde(alias = "accessToken")]
+    access_token: String,
 
     #[serde(alias = "refreshToken")]
     refresh_token: String,
@@ -33,8 +42,12 @@ struct OAuthTokenResult {
 
 #[derive(Deserialize, Debug, Clone)]
 struct OAuthRefreshTokenResult {
-    #[serde(alias = "idToken")]
-    id_token: String,
+    #[serde(alias = "accessToken")]
+    access_token: String,
+
+    /// Refresh tokens rotate, so the one that was sent cannot be used again
+    #[serde(alias = "refreshToken")]
+    refresh_token: String,
 
     #[serde(alias = "expiresIn")]
     expires_in: u16,
@@ -46,10 +59,23 @@ pub async fn login_handler(value: OrgActionAuthArgs) -> Result<()> {
     let org = Arc::new(moonenv_config.get_org(value.org)?);
     let url = moonenv_config.get_url(&org)?;
     let client_id = moonenv_config.get_client_id(&org)?;
-    let uri = format!("{}/auth/token?client_id={}", url, client_id);
-    let set_of_token_result =
-        treat_api_err::<OAuthSetOfTokenResult>(Client::new().get(&uri).send().await?).await?;
-    open::that(format!("https://{}", set_of_token_result.authorization_uri))?;
+    let uri = format!("{}/auth/device_authorization", url);
+    // The org and the user agent are shown on the browser pages, so the user can tell the login is theirs
+    let set_of_token_result = treat_api_err::<OAuthSetOfTokenResult>(
+        Client::new()
+            .post(&uri)
+            .header(USER_AGENT, CLI_USER_AGENT)
+            .form(&[("client_id", client_id.as_str()), ("org_id", org.as_str())])
+            .send()
+            .await?,
+    )
+    .await?;
+
+    println!(
+        "Open {} and confirm the code {}",
+        set_of_token_result.verification_uri, set_of_token_result.user_code
+    );
+    open::that(&set_of_token_result.verification_uri_complete)?;
     let org_clone = Arc::clone(&org);
     let (set_of_token_result, login_result) =
         spawn(move || fetch_login_result(set_of_token_result, &org_clone))
@@ -57,7 +83,7 @@ pub async fn login_handler(value: OrgActionAuthArgs) -> Result<()> {
             .map_err(|e| anyhow::Error::msg(format!("Login failed: {:?}", e)))??;
     let mut config = moonenv_config.get_config(&org)?;
 
-    config.access_token = Some(login_result.id_token); // TODO: weird, but access token is ID Token
+    config.access_token = Some(login_result.access_token);
     config.device_code = Some(set_of_token_result.device_code);
     config.refresh_token = Some(login_result.refresh_token);
     config.access_token_expires_at = Some(get_expires_at(login_result.expires_in)?);
@@ -75,23 +101,46 @@ async fn fetch_login_result(
     let mut moonenv_config = MoonenvConfig::new();
     let url = moonenv_config.get_url(org)?;
     let client_id = moonenv_config.get_client_id(org)?;
-    let uri = format!(
-        "{}/auth/token?client_id={}&device_code={}&grant_type=urn:ietf:params:oauth:grant-type:device_code",
-        url, client_id, set_of_token_result.device_code
-    );
+    let uri = format!("{}/auth/token", url);
+    let form = [
+        ("grant_type", DEVICE_CODE_GRANT_TYPE),
+        ("device_code", set_of_token_result.device_code.as_str()),
+        ("client_id", client_id.as_str()),
+    ];
+    let mut interval = set_of_token_result.interval;
     let token_result: OAuthTokenResult;
 
     loop {
-        sleep(Duration::from_millis(3100));
+        sleep(Duration::from_secs(interval));
 
-        let result = Client::new().get(&uri).send().await?;
-        let status = result.status();
+        let result = Client::new().post(&uri).form(&form).send().await?;
 
-        if status.is_success() {
+        if result.status().is_success() {
             token_result = result.json::<OAuthTokenResult>().await?;
             break;
-        } else if status.as_u16() == StatusCode::GONE {
-            return Err(anyhow!("Session is expired. Try to login again!"));
+        }
+
+        if result.status() != StatusCode::BAD_REQUEST {
+            return Err(anyhow!(
+                "Login failed with status {}: {}",
+                result.status(),
+                result.text().await?
+            ));
+        }
+
+        let error = result.json::<OAuthErrorResult>().await?;
+
+        match error.error.as_str() {
+            "authorization_pending" => {}
+            "slow_down" => interval += 5,
+            "expired_token" => return Err(anyhow!("Session is expired. Try to login again!")),
+            "access_denied" => return Err(anyhow!("The login was denied")),
+            _ => {
+                return Err(anyhow!(
+                    "Login failed: {}",
+                    error.error_description.unwrap_or(error.error)
+                ))
+            }
         }
     }
 
@@ -136,19 +185,30 @@ async fn refresh_token(org: &str) -> Result<String> {
         .ok_or(anyhow::anyhow!("No device code found. Try to login first."))?;
     let url = moonenv_config.get_url(org)?;
     let uri = format!("{}/auth/refresh-token?device_code={}", url, device_code);
-    let result = treat_api_err::<OAuthRefreshTokenResult>(
-        Client::new()
-            .post(uri)
-            .bearer_auth(refresh_token)
-            .send()
-            .await?,
-    )
-    .await?;
+    let response = Client::new()
+        .post(uri)
+        .bearer_auth(&refresh_token)
+        .send()
+        .await?;
+
+    // Another moonenv process refreshed with the same token a moment ago, and saved the new tokens
+    if response.status() == StatusCode::CONFLICT {
+        let latest_config = MoonenvConfig::new().get_config(org)?;
+
+        if latest_config.refresh_token.as_ref() != Some(&refresh_token) {
+            if let Some(access_token) = latest_config.access_token {
+                return Ok(access_token);
+            }
+        }
+    }
+
+    let result = treat_api_err::<OAuthRefreshTokenResult>(response).await?;
 
-    config.access_token = Some(result.id_token.clone());
+    config.access_token = Some(result.access_token.clone());
+    config.refresh_token = Some(result.refresh_token);
     config.access_token_expires_at = Some(get_expires_at(result.expires_in)?);
 
     let _ = moonenv_config.change_config(config);
 
-    Ok(result.id_token)
+    Ok(result.access_token)
 }
@@ -14,6 +14,14 @@ use std::io::Write;
 #[derive(Deserialize, Debug)]
 pub struct PushResponse {
     pub message: String,
+    #[serde(default)]
+    pub warnings: Vec<PushWarning>,
+}
+
+#[derive(Deserialize, Debug)]
+pub struct PushWarning {
+    pub key: String,
+    pub message: String,
 }
 
 #[derive(Deserialize, Debug)]
@@ -82,6 +90,10 @@ impl RepoActionEnvArgs {
 
         println!("{}", result.message);
 
+        for warning in result.warnings {
+            eprintln!("warning: {}: {}", warning.key, warning.message);
+        }
+
         Ok(())
     }
 
@@ -7,6 +7,7 @@ toolchain go1.22.2
 require github.com/aws/jsii-runtime-go v1.104.0
 
 require (
+	github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2 v2.173.2-alpha.0
 	github.com/aws/aws-lambda-go v1.47.0
 	github.com/aws/aws-sdk-go v1.55.5
 	github.com/aws/aws-sdk-go-v2 v1.32.0
@@ -18,7 +19,6 @@ require (
 )
 
 require (
-	github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2 v2.173.2-alpha.0 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.6 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.17.39 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.16.15 // indirect
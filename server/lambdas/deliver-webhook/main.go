@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	maxAttempts    = 5
+	initialBackoff = time.Second
+)
+
+var (
+	httpClient = http.Client{Timeout: 5 * time.Second}
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// Sends the event to every webhook of the org that subscribed to it
+func handler(ctx context.Context, event orgs.EnvEvent) error {
+	webhooks, err := orgs.QueryWebhooks(event.OrgId)
+
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+
+	for _, webhook := range webhooks {
+		if !webhook.Matches(event) {
+			continue
+		}
+
+		if err := webhook.OpenSecret(); err != nil {
+			log.Printf("Failed to decrypt the secret of the webhook %s: %v", webhook.WebhookId, err)
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(webhook orgs.Webhook) {
+			defer wg.Done()
+
+			deliver(ctx, webhook, event, body)
+		}(*webhook)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// Retries with an exponential backoff until the endpoint answers with a 2xx, and logs the outcome
+func deliver(ctx context.Context, webhook orgs.Webhook, event orgs.EnvEvent, body []byte) {
+	var (
+		delivery = orgs.WebhookDelivery{WebhookId: webhook.WebhookId, OrgId: webhook.OrgId, Event: event, Status: orgs.DeliveryStatusFailed}
+		backoff  = initialBackoff
+	)
+
+	for delivery.Attempts < maxAttempts {
+		delivery.Attempts++
+		delivery.ResponseStatus, delivery.Error = send(ctx, webhook, event, body)
+
+		if delivery.Error == "" {
+			delivery.Status = orgs.DeliveryStatusSucceeded
+
+			break
+		}
+
+		if delivery.Attempts < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	delivery.DeliveredAt = strconv.FormatInt(time.Now().Unix(), 10)
+
+	if _, err := orgs.InsertWebhookDelivery(delivery); err != nil {
+		log.Printf("Failed to log the delivery of %s to the webhook %s: %v", event.EventId, webhook.WebhookId, err)
+	}
+}
+
+func send(ctx context.Context, webhook orgs.Webhook, event orgs.EnvEvent, body []byte) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Moonenv-Event", string(event.Type))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("X-Moonenv-Event-Id", event.EventId)
+	req.Header.Set("X-Moonenv-Timestamp", timestamp)
+	req.Header.Set("X-Moonenv-Signature", "sha256="+sign(webhook.Secret, timestamp, body))
+
+	resp, err := httpClient.Do(req)
+
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Sprintf("The endpoint answered with %s", resp.Status)
+	}
+
+	return resp.StatusCode, ""
+}
+
+// Receivers check the HMAC-SHA256 of "{X-Moonenv-Timestamp}.{raw body}" with their secret to trust the event,
+// and reject old timestamps so a captured delivery cannot be replayed
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
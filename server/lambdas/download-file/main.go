@@ -18,14 +18,14 @@ func main() {
 	lambda.Start(handler)
 }
 
-func handler(ctx context.Context, event *bucketService.DownloadFileData) (string, error) {
+func handler(ctx context.Context, event *bucketService.DownloadFileData) (*bucketService.DownloadFileResult, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 
 	if err != nil {
-		return "", errors.New("failed to load SDK Configuration")
+		return nil, errors.New("failed to load SDK Configuration")
 	}
 
 	s3Client = s3.NewFromConfig(cfg)
 
-	return bucketService.GetObjectFromS3Bucket(ctx, s3Client, event.Key)
+	return bucketService.GetObjectIfChanged(ctx, s3Client, event.Key, event.IfNoneMatch)
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CognitoClaims struct {
+	Sub      string   `json:"sub"`
+	Issuer   string   `json:"iss"`
+	Audience string   `json:"aud"`
+	ClientId string   `json:"client_id"`
+	TokenUse string   `json:"token_use"`
+	ExpireAt int64    `json:"exp"`
+	Scope    string   `json:"scope"`
+	Username string   `json:"username"`
+	Groups   []string `json:"cognito:groups"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Tokens signed with an unknown key only trigger a new fetch of the signing keys once in this interval
+const signingKeysRefetchInterval = time.Minute
+
+var (
+	issuer = fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", os.Getenv("AWS_REGION"), os.Getenv("UserPoolId"))
+	// The app client the CLI signs in with
+	appClientId = os.Getenv("UserPoolClientId")
+	// The signing keys live as long as the lambda does and are only fetched again when an unknown one shows up
+	signingKeys          = map[string]*rsa.PublicKey{}
+	signingKeysFetchedAt time.Time
+	signingKeysMutex     sync.Mutex
+)
+
+// Checks the signature, issuer, app client and expiry of an ID or access token issued by the user pool
+func VerifyCognitoToken(token string) (*CognitoClaims, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unexpected signing algorithm %s", header.Alg)
+	}
+
+	key, err := getSigningKey(header.Kid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	claims := new(CognitoClaims)
+
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+
+	if claims.TokenUse != "id" && claims.TokenUse != "access" {
+		return nil, fmt.Errorf("unexpected token use %s", claims.TokenUse)
+	}
+
+	if !isAllowedClient(*claims) {
+		return nil, errors.New("token issued to an unknown app client")
+	}
+
+	if time.Now().Unix() > claims.ExpireAt {
+		return nil, errors.New("expired token")
+	}
+
+	return claims, nil
+}
+
+// ID tokens name the app client in aud and access tokens in client_id. Besides the CLI client, only the
+// clients of service credentials are accepted: their tokens have the client as subject, and the lambdas
+// only let them in through the org membership created with the credential
+func isAllowedClient(claims CognitoClaims) bool {
+	clientId := claims.ClientId
+
+	if claims.TokenUse == "id" {
+		clientId = claims.Audience
+	}
+
+	if clientId == "" {
+		return false
+	}
+
+	if clientId == appClientId {
+		return true
+	}
+
+	return claims.TokenUse == "access" && claims.Username == "" && clientId == claims.Sub
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func getSigningKey(kid string) (*rsa.PublicKey, error) {
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+
+	if key, ok := signingKeys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(signingKeysFetchedAt) < signingKeysRefetchInterval {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+
+	signingKeysFetchedAt = time.Now()
+
+	if err := fetchSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	key, ok := signingKeys[kid]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+
+	return key, nil
+}
+
+func fetchSigningKeys() error {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(issuer + "/.well-known/jwks.json")
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch the signing keys: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return err
+	}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+
+		if err != nil {
+			return err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if err != nil {
+			return err
+		}
+
+		signingKeys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testClientId = "cli-client"
+
+type testIssuer struct {
+	key     *rsa.PrivateKey
+	fetches atomic.Int32
+	server  *httptest.Server
+}
+
+// Serves the JWKS of a new key under /.well-known/jwks.json and points the authorizer at it
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testIssuer := &testIssuer{key: key}
+	testIssuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		testIssuer.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+
+	previousIssuer, previousClientId := issuer, appClientId
+	issuer, appClientId = testIssuer.server.URL, testClientId
+	signingKeys, signingKeysFetchedAt = map[string]*rsa.PublicKey{}, time.Time{}
+
+	t.Cleanup(func() {
+		testIssuer.server.Close()
+		issuer, appClientId = previousIssuer, previousClientId
+	})
+
+	return testIssuer
+}
+
+func (testIssuer *testIssuer) sign(t *testing.T, header jwtHeader, claims CognitoClaims, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyCognitoToken(t *testing.T) {
+	testIssuer := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		header    = jwtHeader{Alg: "RS256", Kid: "key-1"}
+		expireAt  = time.Now().Add(time.Hour).Unix()
+		idToken   = CognitoClaims{Sub: "user-1", Issuer: testIssuer.server.URL, Audience: testClientId, TokenUse: "id", ExpireAt: expireAt}
+		access    = CognitoClaims{Sub: "user-1", Issuer: testIssuer.server.URL, ClientId: testClientId, TokenUse: "access", Username: "user-1", ExpireAt: expireAt}
+		service   = CognitoClaims{Sub: "service-client", Issuer: testIssuer.server.URL, ClientId: "service-client", TokenUse: "access", ExpireAt: expireAt}
+		withClaim = func(claims CognitoClaims, change func(*CognitoClaims)) CognitoClaims {
+			change(&claims)
+
+			return claims
+		}
+	)
+
+	tests := []struct {
+		name    string
+		header  jwtHeader
+		claims  CognitoClaims
+		key     *rsa.PrivateKey
+		wantErr bool
+	}{
+		{"id token of the app client", header, idToken, testIssuer.key, false},
+		{"access token of the app client", header, access, testIssuer.key, false},
+		{"access token of a service credential", header, service, testIssuer.key, false},
+		{"id token of another client", header, withClaim(idToken, func(c *CognitoClaims) { c.Audience = "other" }), testIssuer.key, true},
+		{"id token naming the client only in client_id", header, withClaim(idToken, func(c *CognitoClaims) { c.Audience, c.ClientId = "", testClientId }), testIssuer.key, true},
+		{"user access token of another client", header, withClaim(access, func(c *CognitoClaims) { c.ClientId = "other" }), testIssuer.key, true},
+		{"service token whose client is not the subject", header, withClaim(service, func(c *CognitoClaims) { c.Sub = "user-1" }), testIssuer.key, true},
+		{"other issuer", header, withClaim(idToken, func(c *CognitoClaims) { c.Issuer = "https://example.com" }), testIssuer.key, true},
+		{"unknown token use", header, withClaim(idToken, func(c *CognitoClaims) { c.TokenUse = "refresh" }), testIssuer.key, true},
+		{"expired", header, withClaim(idToken, func(c *CognitoClaims) { c.ExpireAt = time.Now().Add(-time.Minute).Unix() }), testIssuer.key, true},
+		{"signed with another key", header, idToken, otherKey, true},
+		{"other algorithm", jwtHeader{Alg: "HS256", Kid: "key-1"}, idToken, testIssuer.key, true},
+		{"unknown key id", jwtHeader{Alg: "RS256", Kid: "key-2"}, idToken, testIssuer.key, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := VerifyCognitoToken(testIssuer.sign(t, test.header, test.claims, test.key))
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("VerifyCognitoToken() = %+v, want an error", claims)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("VerifyCognitoToken() error = %v", err)
+			}
+
+			if claims.Sub != test.claims.Sub {
+				t.Errorf("VerifyCognitoToken() sub = %s, want %s", claims.Sub, test.claims.Sub)
+			}
+		})
+	}
+
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!.!.!"} {
+		if _, err := VerifyCognitoToken(token); err == nil {
+			t.Errorf("VerifyCognitoToken(%q) succeeded, want an error", token)
+		}
+	}
+}
+
+func TestSigningKeysAreRefetchedOncePerInterval(t *testing.T) {
+	testIssuer := newTestIssuer(t)
+	claims := CognitoClaims{Sub: "user-1", Issuer: testIssuer.server.URL, Audience: testClientId, TokenUse: "id", ExpireAt: time.Now().Add(time.Hour).Unix()}
+
+	if _, err := VerifyCognitoToken(testIssuer.sign(t, jwtHeader{Alg: "RS256", Kid: "key-1"}, claims, testIssuer.key)); err != nil {
+		t.Fatalf("VerifyCognitoToken() error = %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := VerifyCognitoToken(testIssuer.sign(t, jwtHeader{Alg: "RS256", Kid: "unknown"}, claims, testIssuer.key)); err == nil {
+			t.Fatal("VerifyCognitoToken() with an unknown key id succeeded")
+		}
+	}
+
+	if fetches := testIssuer.fetches.Load(); fetches != 1 {
+		t.Fatalf("signing keys fetched %d times, want 1", fetches)
+	}
+
+	signingKeysFetchedAt = time.Now().Add(-signingKeysRefetchInterval)
+
+	if _, err := VerifyCognitoToken(testIssuer.sign(t, jwtHeader{Alg: "RS256", Kid: "unknown"}, claims, testIssuer.key)); err == nil {
+		t.Fatal("VerifyCognitoToken() with an unknown key id succeeded")
+	}
+
+	if fetches := testIssuer.fetches.Load(); fetches != 2 {
+		t.Fatalf("signing keys fetched %d times after the interval, want 2", fetches)
+	}
+}
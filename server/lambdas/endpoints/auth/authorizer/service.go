@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/tokens"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// API Gateway answers 401 when the authorizer fails with this exact message
+var errUnauthorized = errors.New("Unauthorized")
+
+var (
+	defaultUsageKey     = os.Getenv("DefaultUsageKey")
+	integrationUsageKey = os.Getenv("IntegrationUsageKey")
+)
+
+func Authorize(req events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	token := getBearerToken(req.Headers)
+
+	if token == "" {
+		return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+	}
+
+	var (
+		caller *principal.Principal
+		err    error
+	)
+
+	if tokens.IsPersonalAccessToken(token) {
+		caller, err = authorizePersonalAccessToken(token)
+	} else {
+		caller, err = authorizeCognitoToken(token)
+	}
+
+	if err != nil {
+		log.Printf("Rejected the request to %s: %s", req.MethodArn, err)
+
+		return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+	}
+
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: caller.Id,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action:   []string{"execute-api:Invoke"},
+					Effect:   "Allow",
+					Resource: []string{getApiArn(req.MethodArn)},
+				},
+			},
+		},
+		Context:            caller.ToContext(),
+		UsageIdentifierKey: getUsageKey(*caller),
+	}, nil
+}
+
+// Picks the API key of the usage plan that API Gateway throttles the caller with
+func getUsageKey(caller principal.Principal) string {
+	if caller.Type == principal.TypeService {
+		return integrationUsageKey
+	}
+
+	return defaultUsageKey
+}
+
+func authorizePersonalAccessToken(token string) (*principal.Principal, error) {
+	tokenHash := tokens.HashPersonalAccessToken(token)
+	accessToken, err := tokens.GetPersonalAccessToken(tokenHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if accessToken == nil {
+		return nil, errors.New("unknown personal access token")
+	}
+
+	expireAt, err := strconv.ParseInt(accessToken.ExpireAt, 10, 64)
+
+	if err != nil || time.Now().Unix() > expireAt {
+		return nil, errors.New("expired personal access token")
+	}
+
+	if err := tokens.UpdatePersonalAccessTokenLastUsedAt(tokenHash, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		log.Printf("Failed to update the last use of the personal access token %s: %s", accessToken.TokenId, err)
+	}
+
+	return &principal.Principal{
+		Id:          accessToken.UserId,
+		Type:        principal.TypePersonalAccessToken,
+		TokenScope:  accessToken.Scope,
+		TokenAccess: accessToken.Access,
+	}, nil
+}
+
+func authorizeCognitoToken(token string) (*principal.Principal, error) {
+	claims, err := VerifyCognitoToken(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	caller := principal.Principal{
+		Id:     claims.Sub,
+		Type:   principal.TypeUser,
+		Groups: claims.Groups,
+		Scopes: strings.Fields(claims.Scope),
+	}
+
+	// Tokens from the client credentials grant are the only ones without a user behind them
+	if claims.TokenUse == "access" && claims.Username == "" {
+		caller.Type = principal.TypeService
+	}
+
+	return &caller, nil
+}
+
+func getBearerToken(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Authorization") {
+			return strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+		}
+	}
+
+	return ""
+}
+
+// The policy allows every method of the API, so the lambdas are the ones checking what the caller can do.
+// A method ARN looks like arn:aws:execute-api:{region}:{account}:{apiId}/{stage}/{method}/{resource}
+func getApiArn(methodArn string) string {
+	parts := strings.SplitN(methodArn, "/", 3)
+
+	if len(parts) < 2 {
+		return methodArn
+	}
+
+	return strings.Join(parts[:2], "/") + "/*"
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 
+	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 	"github.com/aws/aws-lambda-go/lambda"
 )
@@ -19,9 +20,16 @@ func main() {
 
 func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
 	var (
-		code  = req.QueryStringParameters["code"]
-		state = req.QueryStringParameters["state"]
+		code       = req.QueryStringParameters["code"]
+		state      = req.QueryStringParameters["state"]
+		loginError = req.QueryStringParameters["error"]
+		binding    = restApi.GetCookie(req, tokenCode.BrowserBindingCookie)
 	)
 
-	return SaveCode(state, code), nil
+	// Cognito comes back with an error instead of a code when the user cancels or the login fails
+	if loginError != "" {
+		return DenyLogin(state, loginError, req.QueryStringParameters["error_description"], binding), nil
+	}
+
+	return SaveCode(state, code, binding), nil
 }
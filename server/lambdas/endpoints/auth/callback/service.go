@@ -1,19 +1,125 @@
 package main
 
 import (
+	"bytes"
+	"html/template"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
-func SaveCode(state string, code string) restApi.Response {
-	tokens, err := tokenCode.QueryToken(StateIndexName, map[string]*dynamodb.Condition{
+type landingPage struct {
+	Success bool
+	Title   string
+	Message string
+	OrgName string
+	Device  string
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - moonenv</title>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p{{if not .Success}} role="alert"{{end}}>{{.Message}}</p>
+{{if or .OrgName .Device}}<dl>
+{{if .OrgName}}<dt>Org</dt><dd>{{.OrgName}}</dd>{{end}}
+{{if .Device}}<dt>Device</dt><dd>{{.Device}}</dd>{{end}}
+</dl>{{end}}
+<p>You can close this tab{{if .Success}} and go back to the terminal{{end}}.</p>
+</main>
+</body>
+</html>
+`))
+
+// Links the Cognito authorization to the device, but only for the browser that confirmed the user code.
+// Anyone else who opens the authorization URI, such as the victim of a phishing link, is turned away
+func SaveCode(state string, code string, binding string) restApi.Response {
+	token, errResponse := getBoundToken(state, binding)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if code == "" {
+		return renderPage(http.StatusBadRequest, landingPage{Title: "Login failed", Message: "Cognito did not send a login code. Start the login again from the CLI."})
+	}
+
+	sealedCode, err := token.SealSecret("loginCode", code)
+
+	if err != nil {
+		return renderPage(http.StatusInternalServerError, landingPage{Title: "Login failed", Message: "Something went wrong while saving the login. Start the login again from the CLI."})
+	}
+
+	// Late or repeated callbacks find the login no longer pending, or expired, and cannot replace its code
+	err = tokenCode.TransitionToken(token.DeviceCode, tokenCode.StatusPending, tokenCode.StatusAuthorized, tokenCode.TokenCode{LoginCode: sealedCode})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return renderPage(http.StatusConflict, landingPage{Title: "Login already finished", Message: "This login was already completed or has expired."})
+	} else if err != nil {
+		return renderPage(http.StatusInternalServerError, landingPage{Title: "Login failed", Message: "Something went wrong while saving the login. Start the login again from the CLI."})
+	}
+
+	return withoutBinding(renderPage(http.StatusOK, landingPage{
+		Success: true,
+		Title:   "You are signed in",
+		Message: "The moonenv CLI is now signed in.",
+		OrgName: getOrgName(token.OrgId),
+		Device:  describeDevice(*token),
+	}))
+}
+
+// Marks the login as denied, so the next poll of the CLI gets access_denied and stops
+func DenyLogin(state string, loginError string, errorDescription string, binding string) restApi.Response {
+	token, errResponse := getBoundToken(state, binding)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	// The description comes from the URL, so it is logged rather than shown to the user
+	log.Printf("Cognito denied the login of %s: %s %s", token.DeviceCode, loginError, errorDescription)
+
+	err := tokenCode.TransitionToken(token.DeviceCode, tokenCode.StatusPending, tokenCode.StatusDenied, tokenCode.TokenCode{})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return renderPage(http.StatusConflict, landingPage{Title: "Login already finished", Message: "This login was already completed or has expired."})
+	} else if err != nil {
+		return renderPage(http.StatusInternalServerError, landingPage{Title: "Login failed", Message: "Something went wrong while cancelling the login."})
+	}
+
+	message := "The login could not be completed (" + loginError + "). Start the login again from the CLI."
+
+	if loginError == "access_denied" {
+		message = "The login was cancelled. Start the login again from the CLI if you still want to sign in."
+	}
+
+	return withoutBinding(renderPage(http.StatusOK, landingPage{
+		Title:   "Login cancelled",
+		Message: message,
+		OrgName: getOrgName(token.OrgId),
+		Device:  describeDevice(*token),
+	}))
+}
+
+func getBoundToken(state string, binding string) (*tokenCode.TokenCode, *restApi.Response) {
+	tokens, err := tokenCode.QueryToken(StateIndexName, map[string]*dynamodbService.Condition{
 		"state": {
 			ComparisonOperator: aws.String("EQ"),
-			AttributeValueList: []*dynamodb.AttributeValue{
+			AttributeValueList: []*dynamodbService.AttributeValue{
 				{
 					S: aws.String(state),
 				},
@@ -21,15 +127,72 @@ func SaveCode(state string, code string) restApi.Response {
 		},
 	})
 
-	if err != nil || tokens == nil || len(tokens) < 1 {
-		return restApi.ApiResponse(http.StatusNotFound, "State was not found")
+	if err != nil || len(tokens) < 1 {
+		response := renderPage(http.StatusNotFound, landingPage{Title: "Login expired", Message: "This login has expired or does not exist. Start the login again from the CLI."})
+
+		return nil, &response
 	}
 
-	err = tokenCode.UpdateToken(tokens[0].DeviceCode, tokenCode.TokenCode{LoginCode: code, Status: "authorized"})
+	if !tokens[0].IsBoundTo(binding) {
+		response := renderPage(http.StatusForbidden, landingPage{Title: "Login not confirmed", Message: "The code of the CLI was not confirmed in this browser. Start from the link shown by the CLI."})
 
-	if err != nil {
-		return restApi.ApiResponse(http.StatusInternalServerError, "Problem while saving the login code")
+		return nil, &response
+	}
+
+	return tokens[0], nil
+}
+
+// Falls back to nothing for unknown orgs, since the CLI sends whatever org it was configured with
+func getOrgName(orgId string) string {
+	if orgId == "" {
+		return ""
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil || org == nil {
+		return ""
+	}
+
+	if org.DisplayName == "" {
+		return org.OrgId
+	}
+
+	return org.DisplayName
+}
+
+func describeDevice(token tokenCode.TokenCode) string {
+	device := token.UserAgent
+
+	if device == "" {
+		device = "Unknown device"
+	}
+
+	if token.SourceIp != "" {
+		device += " from " + token.SourceIp
+	}
+
+	if createdAt, err := strconv.ParseInt(token.CreatedAt, 10, 64); err == nil {
+		device += ", started " + time.Unix(createdAt, 0).UTC().Format("2 Jan 2006 15:04 UTC")
+	}
+
+	return device
+}
+
+// The binding has done its job once the login is settled, so the browser can forget it
+func withoutBinding(response restApi.Response) restApi.Response {
+	cookie := http.Cookie{Name: tokenCode.BrowserBindingCookie, Path: "/auth/callback", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode}
+	response.Headers["Set-Cookie"] = cookie.String()
+
+	return response
+}
+
+func renderPage(statusCode int, page landingPage) restApi.Response {
+	var body bytes.Buffer
+
+	if err := landingTemplate.Execute(&body, page); err != nil {
+		return restApi.HtmlResponse(http.StatusInternalServerError, "Failed to render the page")
 	}
 
-	return restApi.ApiResponse(http.StatusNoContent, nil)
+	return restApi.HtmlResponse(statusCode, body.String())
 }
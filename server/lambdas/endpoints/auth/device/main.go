@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+var (
+	UserCodeIndexName = os.Getenv("UserCodeIndexName")
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /auth/device":
+		return ShowVerificationPage(req.QueryStringParameters["user_code"]), nil
+	case "POST /auth/device":
+		return ConfirmUserCode(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
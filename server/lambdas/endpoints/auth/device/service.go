@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"time"
+
+	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type verificationPage struct {
+	UserCode  string
+	CsrfToken string
+	Error     string
+}
+
+// Only sent by pages of the API itself, so another site cannot submit the form on behalf of a signed-in user
+const csrfCookie = "moonenv_device_csrf"
+
+// How long the verification page can stay open before the form has to be loaded again
+const csrfMaxAge = 15 * time.Minute
+
+var verificationTemplate = template.Must(template.New("verification").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in to moonenv</title>
+</head>
+<body>
+<main>
+<h1>Sign in to moonenv</h1>
+<p>Enter the code shown by the moonenv CLI.</p>
+<p><strong>Only continue if you started this login yourself and your terminal shows this same code.</strong> Whoever runs that terminal gets access to your account.</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post">
+<input type="hidden" name="csrf_token" value="{{.CsrfToken}}">
+<input name="user_code" value="{{.UserCode}}" placeholder="XXXX-XXXX" autocomplete="off" autofocus required>
+<button type="submit">Confirm and sign in</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+// The verification URI of the device flow. The code from verification_uri_complete is only filled in, never submitted,
+// so opening a link someone sent is not enough to sign in for their device
+func ShowVerificationPage(userCode string) restApi.Response {
+	return renderPage(http.StatusOK, verificationPage{UserCode: userCode})
+}
+
+// Binds the browser to the device that holds the confirmed code, then sends the user to sign in.
+// The callback only accepts the browser holding the binding cookie, so a leaked authorization URI cannot be used on someone else
+func ConfirmUserCode(req restApi.Request) restApi.Response {
+	form, err := restApi.ParseForm(req)
+
+	if err != nil {
+		return renderPage(http.StatusBadRequest, verificationPage{Error: "Enter the code again."})
+	}
+
+	userCode := form.Get("user_code")
+	csrfToken := restApi.GetCookie(req, csrfCookie)
+
+	if csrfToken == "" || subtle.ConstantTimeCompare([]byte(csrfToken), []byte(form.Get("csrf_token"))) != 1 {
+		return renderPage(http.StatusForbidden, verificationPage{UserCode: userCode, Error: "This page has expired, confirm the code again."})
+	}
+
+	normalizedCode := tokenCode.NormalizeUserCode(userCode)
+
+	if normalizedCode == "" {
+		return renderPage(http.StatusBadRequest, verificationPage{UserCode: userCode, Error: "This is not a valid code."})
+	}
+
+	token, errResponse := getPendingToken(normalizedCode)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if token == nil {
+		return renderPage(http.StatusNotFound, verificationPage{UserCode: userCode, Error: "This code is invalid or has expired. Start the login again from the CLI."})
+	}
+
+	if err := token.OpenSecrets(); err != nil {
+		return renderPage(http.StatusInternalServerError, verificationPage{UserCode: userCode, Error: "Something went wrong, try again."})
+	}
+
+	secret, binding, err := tokenCode.NewBrowserBinding()
+
+	if err != nil {
+		return renderPage(http.StatusInternalServerError, verificationPage{UserCode: userCode, Error: "Something went wrong, try again."})
+	}
+
+	// A later confirmation of the same code replaces the binding, in case the user switched browsers
+	if err := tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{BrowserBinding: binding}); err != nil {
+		return renderPage(http.StatusInternalServerError, verificationPage{UserCode: userCode, Error: "Something went wrong, try again."})
+	}
+
+	// Lax, because the browser comes back to the callback through a redirect from Cognito
+	bindingCookie := http.Cookie{
+		Name:     tokenCode.BrowserBindingCookie,
+		Value:    secret,
+		Path:     "/auth/callback",
+		MaxAge:   int(token.ExpireAt - time.Now().Unix()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	return restApi.Response{
+		StatusCode: http.StatusFound,
+		Headers: map[string]string{
+			"Location":      "https://" + token.AuthorizationUri,
+			"Cache-Control": "no-store",
+			"Set-Cookie":    bindingCookie.String(),
+		},
+	}
+}
+
+// User codes are short, so an old code can come back; only a pending record counts, and expired ones are never loaded
+func getPendingToken(userCode string) (*tokenCode.TokenCode, *restApi.Response) {
+	tokens, err := tokenCode.QueryToken(UserCodeIndexName, map[string]*dynamodb.Condition{
+		"userCode": {
+			ComparisonOperator: aws.String("EQ"),
+			AttributeValueList: []*dynamodb.AttributeValue{{S: aws.String(userCode)}},
+		},
+	})
+
+	if err != nil {
+		response := renderPage(http.StatusInternalServerError, verificationPage{UserCode: userCode, Error: "Something went wrong, try again."})
+
+		return nil, &response
+	}
+
+	for _, token := range tokens {
+		if token.Status == tokenCode.StatusPending {
+			return token, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Every render gets a new CSRF token, which the form sends back along with the cookie
+func renderPage(statusCode int, page verificationPage) restApi.Response {
+	var body bytes.Buffer
+
+	csrfToken := make([]byte, 32)
+
+	if _, err := rand.Read(csrfToken); err != nil {
+		return restApi.HtmlResponse(http.StatusInternalServerError, "Failed to render the page")
+	}
+
+	page.CsrfToken = base64.RawURLEncoding.EncodeToString(csrfToken)
+
+	if err := verificationTemplate.Execute(&body, page); err != nil {
+		return restApi.HtmlResponse(http.StatusInternalServerError, "Failed to render the page")
+	}
+
+	cookie := http.Cookie{
+		Name:     csrfCookie,
+		Value:    page.CsrfToken,
+		Path:     "/auth/device",
+		MaxAge:   int(csrfMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	response := restApi.HtmlResponse(statusCode, body.String())
+	response.Headers["Set-Cookie"] = cookie.String()
+
+	return response
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+var (
+	UserIndexName = os.Getenv("UserIndexName")
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /devices":
+		return ListDevices(req), nil
+	case "DELETE /devices":
+		return RevokeAllDevices(req), nil
+	case "PATCH /devices/{deviceId}":
+		return RenameDevice(req), nil
+	case "DELETE /devices/{deviceId}":
+		return RevokeDevice(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
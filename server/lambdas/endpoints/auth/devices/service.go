@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// What users see of their sessions; the device code and the secrets never leave the table
+type Device struct {
+	DeviceId        string `json:"deviceId"`
+	Name            string `json:"name"`
+	ClientId        string `json:"clientId"`
+	SourceIp        string `json:"sourceIp"`
+	UserAgent       string `json:"userAgent"`
+	CreatedAt       string `json:"createdAt"`
+	LastRefreshedAt string `json:"lastRefreshedAt,omitempty"`
+}
+
+type RenameDeviceRequest struct {
+	Name string `json:"name"`
+}
+
+// Lists the devices of the caller that are still signed in
+func ListDevices(req restApi.Request) restApi.Response {
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	tokens, errResponse := getSignedInDevices(orchestrator.GetCallerId(req))
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	devices := make([]Device, 0, len(tokens))
+
+	for _, token := range tokens {
+		devices = append(devices, newDevice(*token))
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]Device{"devices": devices})
+}
+
+func RenameDevice(req restApi.Request) restApi.Response {
+	var requestData RenameDeviceRequest
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Name == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	token, errResponse := getDevice(orchestrator.GetCallerId(req), req.PathParameters["deviceId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{DeviceName: requestData.Name}); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to rename the device")
+	}
+
+	token.DeviceName = requestData.Name
+
+	return restApi.ApiResponse(http.StatusOK, newDevice(*token))
+}
+
+// Signs out one device, such as a stolen laptop, without touching the others
+func RevokeDevice(req restApi.Request) restApi.Response {
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	token, errResponse := getDevice(orchestrator.GetCallerId(req), req.PathParameters["deviceId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := tokenCode.RevokeSession(*token); err != nil {
+		return restApi.BuildErrorResponse(http.StatusBadGateway, "Failed to revoke the device: "+err.Error())
+	}
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+// Signs out every device of the caller. The ones that fail are returned, and the call can be repeated
+func RevokeAllDevices(req restApi.Request) restApi.Response {
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	tokens, errResponse := getSignedInDevices(orchestrator.GetCallerId(req))
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	failedDeviceIds := []string{}
+
+	for _, token := range tokens {
+		if err := tokenCode.RevokeSession(*token); err != nil {
+			failedDeviceIds = append(failedDeviceIds, token.DeviceId)
+		}
+	}
+
+	if len(failedDeviceIds) > 0 {
+		return restApi.ApiResponse(http.StatusBadGateway, map[string]interface{}{
+			"message":         "Some devices could not be revoked",
+			"failedDeviceIds": failedDeviceIds,
+		})
+	}
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+func getSignedInDevices(userId string) ([]*tokenCode.TokenCode, *restApi.Response) {
+	tokens, err := tokenCode.QueryToken(UserIndexName, map[string]*dynamodbService.Condition{
+		"userId": {
+			ComparisonOperator: aws.String("EQ"),
+			AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(userId)}},
+		},
+	})
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load your devices")
+
+		return nil, &response
+	}
+
+	var signedIn []*tokenCode.TokenCode
+
+	for _, token := range tokens {
+		if token.Status == tokenCode.StatusCompleted {
+			signedIn = append(signedIn, token)
+		}
+	}
+
+	return signedIn, nil
+}
+
+// Devices are looked up among the ones of the caller, so nobody can reach the device of someone else
+func getDevice(userId string, deviceId string) (*tokenCode.TokenCode, *restApi.Response) {
+	tokens, errResponse := getSignedInDevices(userId)
+
+	if errResponse != nil {
+		return nil, errResponse
+	}
+
+	for _, token := range tokens {
+		if token.DeviceId == deviceId {
+			return token, nil
+		}
+	}
+
+	response := restApi.BuildErrorResponse(http.StatusNotFound, "Device not found")
+
+	return nil, &response
+}
+
+func newDevice(token tokenCode.TokenCode) Device {
+	name := token.DeviceName
+
+	if name == "" {
+		name = token.UserAgent
+	}
+
+	return Device{
+		DeviceId:        token.DeviceId,
+		Name:            name,
+		ClientId:        token.ClientId,
+		SourceIp:        token.SourceIp,
+		UserAgent:       token.UserAgent,
+		CreatedAt:       token.CreatedAt,
+		LastRefreshedAt: token.LastRefreshedAt,
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/url"
 
 	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
 	oauth "github.com/PBH-Tech/moonenv/lambdas/util/oauth"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 )
@@ -13,34 +16,115 @@ import (
 type CognitoRefreshTokenResponse struct {
 	IdToken     string `json:"id_token"`
 	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"token_type"`
+	// Only sent when refresh token rotation is enabled on the app client
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
 }
 
 type APIResponse struct {
 	IdToken     string `json:"idToken"`
 	AccessToken string `json:"accessToken"`
-	ExpiresIn   int    `json:"expiresIn"`
-	TokenType   string `json:"tokenType"`
+	// Replaces the one the device sent, which cannot be used again
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+	TokenType    string `json:"tokenType"`
 }
 
+// Exchanges the current refresh token of the device for new tokens and a new refresh token.
+// A refresh token that was already rotated means someone else holds a copy, so the whole family is revoked
 func RefreshToken(deviceCode string, refreshToken string) restApi.Response {
 
 	token, err := tokenCode.GetToken(deviceCode)
 
-	if err != nil {
+	if err != nil || token == nil {
 		return restApi.BuildErrorResponse(http.StatusNotFound, "Device code not found")
 	}
 
-	return getToken(token.ClientId, refreshToken)
+	// Signed out devices must log in again, even if Cognito has not caught up yet
+	if token.Status != tokenCode.StatusCompleted {
+		return restApi.BuildErrorResponse(http.StatusUnauthorized, "The device was signed out, log in again")
+	}
+
+	switch {
+	// Logins from before rotation hold the refresh token of Cognito, which is never accepted from the device again
+	case token.RefreshTokenHash == "":
+		return restApi.BuildErrorResponse(http.StatusUnauthorized, "The session is too old to be refreshed, log in again")
+	case token.IsCurrentRefreshToken(refreshToken):
+		return rotate(*token, refreshToken)
+	case token.IsRotatedRefreshToken(refreshToken) && token.IsWithinReuseGracePeriod():
+		return restApi.BuildErrorResponse(http.StatusConflict, "The refresh token was just rotated by another request, use the new one")
+	case token.IsRotatedRefreshToken(refreshToken):
+		return revokeReusedFamily(*token)
+	default:
+		return restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
+	}
+}
+
+// Cognito is asked first, so a device whose refresh fails keeps a token it can try again with
+func rotate(token tokenCode.TokenCode, refreshToken string) restApi.Response {
+	if err := token.OpenSecrets(); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to decrypt the session")
+	}
+
+	tokenResponse, errResponse := getToken(token.ClientId, token.RefreshToken)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	var sealedCognitoToken string
+
+	if tokenResponse.RefreshToken != "" {
+		sealed, err := token.SealSecret("refreshToken", tokenResponse.RefreshToken)
+
+		if err != nil {
+			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to encrypt the refresh token")
+		}
+
+		sealedCognitoToken = sealed
+	}
+
+	newRefreshToken, newRefreshTokenHash, err := tokenCode.NewRefreshToken()
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the refresh token")
+	}
+
+	err = tokenCode.RotateRefreshToken(token.DeviceCode, tokenCode.HashRefreshToken(refreshToken), newRefreshTokenHash, sealedCognitoToken)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The refresh token was just rotated by another request, use the new one")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to rotate the refresh token")
+	}
+
+	return restApi.ApiResponse(http.StatusCreated, APIResponse{
+		IdToken:      tokenResponse.IdToken,
+		AccessToken:  tokenResponse.AccessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    tokenResponse.ExpiresIn,
+		TokenType:    tokenResponse.TokenType,
+	})
+}
+
+func revokeReusedFamily(token tokenCode.TokenCode) restApi.Response {
+	log.Printf("A rotated refresh token of the device %s was used again, revoking its session", token.DeviceId)
+	events.Publish(events.Event{Type: events.TypeAuthRefreshTokenReused, ActorId: token.UserId, ClientId: token.ClientId})
+
+	if err := tokenCode.RevokeSession(token); err != nil {
+		log.Printf("Failed to revoke the session of the device %s: %v", token.DeviceId, err)
+	}
+
+	return restApi.BuildErrorResponse(http.StatusUnauthorized, "The refresh token was already used, so the session was revoked. Log in again")
 }
 
-func getToken(clientId string, refreshToken string) restApi.Response {
+func getToken(clientId string, refreshToken string) (*CognitoRefreshTokenResponse, *restApi.Response) {
 	data := url.Values{}
 	oauthUrl, errResponse := oauth.GetOAuthUrl()
 
 	if errResponse != nil {
-		return *errResponse
+		return nil, errResponse
 	}
 
 	data.Set("client_id", clientId)
@@ -54,20 +138,26 @@ func getToken(clientId string, refreshToken string) restApi.Response {
 	resp, err := client.PostForm(oauthUrlStr, data)
 
 	if err != nil {
-		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Error while sending HTTP request")
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Error while sending HTTP request")
+
+		return nil, &response
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
+		response := restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
+
+		return nil, &response
 	}
 
 	var tokenResponse CognitoRefreshTokenResponse
 	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
 	if err != nil {
-		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Error decoding JSON response")
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Error decoding JSON response")
+
+		return nil, &response
 	}
 
-	return restApi.ApiResponse(http.StatusCreated, APIResponse(tokenResponse))
+	return &tokenResponse, nil
 }
@@ -1,51 +1,60 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"net/url"
 
 	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
 	oauth "github.com/PBH-Tech/moonenv/lambdas/util/oauth"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 )
 
+// Signs the device out: the refresh token is revoked in Cognito and the device leaves the list of sessions
 func RevokeToken(deviceCode string, refreshToken string) restApi.Response {
 	token, err := tokenCode.GetToken(deviceCode)
 
-	if err != nil {
+	if err != nil || token == nil {
 		return restApi.BuildErrorResponse(http.StatusNotFound, "Device code not found")
 	}
 
-	return invalidateToken(token.ClientId, refreshToken)
-}
-
-func invalidateToken(clientId string, refreshToken string) restApi.Response {
-	// TODO: I don't like this code that are very similar to refresh too, should we abstract it?
-	data := url.Values{}
-	oauthUrl, errResponse := oauth.GetOAuthUrl()
+	// Logins from before rotation still hold the refresh token of Cognito
+	if token.RefreshTokenHash == "" {
+		return revokeCognitoToken(*token, refreshToken)
+	}
 
-	if errResponse != nil {
-		return *errResponse
+	if !token.IsCurrentRefreshToken(refreshToken) {
+		return restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
 	}
 
-	data.Set("client_id", clientId)
-	data.Set("token", refreshToken)
-	oauthUrl.Path = "/oauth2/revoke"
+	if err := tokenCode.RevokeSession(*token); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to revoke the session")
+	}
 
-	oauthUrlStr := oauthUrl.String()
-	client := &http.Client{}
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
 
-	resp, err := client.PostForm(oauthUrlStr, data)
+func revokeCognitoToken(token tokenCode.TokenCode, refreshToken string) restApi.Response {
+	err := oauth.RevokeRefreshToken(token.ClientId, refreshToken)
 
-	if err != nil {
+	if errors.Is(err, oauth.ErrInvalidToken) {
+		return restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
+	} else if err != nil {
 		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Error while sending HTTP request")
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return restApi.BuildErrorResponse(http.StatusUnauthorized, "Invalid refresh token")
+	if token.Status == tokenCode.StatusCompleted {
+		if err := tokenCode.TransitionToken(token.DeviceCode, tokenCode.StatusCompleted, tokenCode.StatusRevoked, tokenCode.TokenCode{}); err != nil {
+			log.Printf("Failed to mark the device %s as revoked: %v", token.DeviceId, err)
+		}
 	}
 
+	publishRevoked(token)
+
 	return restApi.ApiResponse(http.StatusNoContent, nil)
 }
+
+func publishRevoked(token tokenCode.TokenCode) {
+	events.Publish(events.Event{Type: events.TypeAuthRevoked, ActorId: token.UserId, ClientId: token.ClientId})
+}
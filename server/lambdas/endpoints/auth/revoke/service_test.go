@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+)
+
+func TestPublishRevoked(t *testing.T) {
+	sink := events.NewMemorySink()
+	events.SetPublisher(sink)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	publishRevoked(tokenCode.TokenCode{DeviceCode: "device-code", UserId: "user-1", ClientId: "cli-client"})
+
+	got := sink.Events()
+	want := events.Event{Type: events.TypeAuthRevoked, ActorId: "user-1", ClientId: "cli-client"}
+
+	if len(got) != 1 || got[0].OccurredAt == "" {
+		t.Fatalf("publishRevoked() published %+v, want one event with a time", got)
+	}
+
+	if got[0].OccurredAt = ""; got[0] != want {
+		t.Errorf("publishRevoked() published %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,124 @@
+package tokenCode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+	"github.com/PBH-Tech/moonenv/lambdas/util/oauth"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Two processes of the CLI can refresh with the same token at once; the one that loses is not taken for a thief
+const ReuseGracePeriod = 30 * time.Second
+
+// Devices get opaque refresh tokens that change on every refresh, and each login is the family of all of them.
+// A copied token stops working once the device refreshes, and using it after that revokes the whole family.
+// Returns the token for the device and the hash to store
+func NewRefreshToken() (string, string, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", err
+	}
+
+	refreshToken := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	return refreshToken, HashRefreshToken(refreshToken), nil
+}
+
+func HashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// Whether the device presents the refresh token it was last given
+func (token TokenCode) IsCurrentRefreshToken(refreshToken string) bool {
+	return token.RefreshTokenHash != "" && subtle.ConstantTimeCompare([]byte(token.RefreshTokenHash), []byte(HashRefreshToken(refreshToken))) == 1
+}
+
+// Whether the refresh token belonged to the family but was already replaced
+func (token TokenCode) IsRotatedRefreshToken(refreshToken string) bool {
+	return slices.Contains(token.RotatedRefreshTokenHashes, HashRefreshToken(refreshToken))
+}
+
+// Whether the last rotation is recent enough for a rotated token to come from a concurrent refresh
+func (token TokenCode) IsWithinReuseGracePeriod() bool {
+	lastRefreshedAt, err := strconv.ParseInt(token.LastRefreshedAt, 10, 64)
+
+	return err == nil && time.Since(time.Unix(lastRefreshedAt, 0)) < ReuseGracePeriod
+}
+
+// Replaces the refresh token of the device, as long as the presented one is still the current one.
+// sealedCognitoToken is only set when Cognito rotated its own refresh token too
+func RotateRefreshToken(deviceCode string, presentedHash string, newHash string, sealedCognitoToken string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	updateExpression := "SET refreshTokenHash = :newHash, lastRefreshedAt = :now"
+	values := map[string]*dynamodbService.AttributeValue{
+		":newHash":       {S: aws.String(newHash)},
+		":presentedHash": {S: aws.String(presentedHash)},
+		":presentedSet":  {SS: []*string{aws.String(presentedHash)}},
+		":now":           {S: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		":completed":     {S: aws.String(string(StatusCompleted))},
+	}
+
+	if sealedCognitoToken != "" {
+		updateExpression += ", refreshToken = :refreshToken"
+		values[":refreshToken"] = &dynamodbService.AttributeValue{S: aws.String(sealedCognitoToken)}
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                       map[string]*dynamodbService.AttributeValue{"deviceCode": {S: aws.String(deviceCode)}},
+		TableName:                 tokenCodeTableName,
+		ConditionExpression:       aws.String("refreshTokenHash = :presentedHash AND #status = :completed"),
+		UpdateExpression:          aws.String(updateExpression + " ADD rotatedRefreshTokenHashes :presentedSet"),
+		ExpressionAttributeNames:  map[string]*string{"#status": aws.String("status")},
+		ExpressionAttributeValues: values,
+	})
+
+	return err
+}
+
+// Signs the device out. Cognito revokes its refresh token first, so a failure leaves the device signed in and can be retried.
+// Devices without a stored refresh token can only be marked; the refresh endpoint turns them away from then on
+func RevokeSession(token TokenCode) error {
+	if err := token.OpenSecrets(); err != nil {
+		return err
+	}
+
+	if token.RefreshToken != "" {
+		err := oauth.RevokeRefreshToken(token.ClientId, token.RefreshToken)
+
+		// Cognito rejects refresh tokens that already expired or were revoked, which leaves nothing to revoke
+		if err != nil && !errors.Is(err, oauth.ErrInvalidToken) {
+			return err
+		}
+	}
+
+	err := TransitionToken(token.DeviceCode, StatusCompleted, StatusRevoked, TokenCode{})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	events.Publish(events.Event{Type: events.TypeAuthRevoked, ActorId: token.UserId, ClientId: token.ClientId})
+
+	return nil
+}
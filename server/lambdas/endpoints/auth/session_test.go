@@ -0,0 +1,90 @@
+package tokenCode
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	current, currentHash, err := NewRefreshToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, rotatedHash, err := NewRefreshToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current == rotated || currentHash == rotatedHash {
+		t.Fatal("NewRefreshToken() returned the same token twice")
+	}
+
+	if HashRefreshToken(current) != currentHash {
+		t.Fatal("NewRefreshToken() returned a hash that HashRefreshToken() does not give back")
+	}
+
+	var (
+		token   = TokenCode{RefreshTokenHash: currentHash, RotatedRefreshTokenHashes: []string{rotatedHash}}
+		unknown = "not-a-refresh-token"
+	)
+
+	tests := []struct {
+		name         string
+		token        TokenCode
+		refreshToken string
+		wantCurrent  bool
+		wantRotated  bool
+	}{
+		{"current token", token, current, true, false},
+		{"rotated token", token, rotated, false, true},
+		{"unknown token", token, unknown, false, false},
+		{"the hash itself is not a token", token, currentHash, false, false},
+		{"empty token", token, "", false, false},
+		{"device without a refresh token", TokenCode{}, "", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.token.IsCurrentRefreshToken(test.refreshToken); got != test.wantCurrent {
+				t.Errorf("IsCurrentRefreshToken() = %v, want %v", got, test.wantCurrent)
+			}
+
+			if got := test.token.IsRotatedRefreshToken(test.refreshToken); got != test.wantRotated {
+				t.Errorf("IsRotatedRefreshToken() = %v, want %v", got, test.wantRotated)
+			}
+		})
+	}
+}
+
+func TestIsWithinReuseGracePeriod(t *testing.T) {
+	refreshedAgo := func(duration time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(-duration).Unix(), 10)
+	}
+
+	tests := []struct {
+		name            string
+		lastRefreshedAt string
+		want            bool
+	}{
+		{"just refreshed", refreshedAgo(0), true},
+		{"inside the period", refreshedAgo(ReuseGracePeriod / 2), true},
+		{"after the period", refreshedAgo(ReuseGracePeriod + time.Second), false},
+		{"long ago", refreshedAgo(24 * time.Hour), false},
+		{"never refreshed", "", false},
+		{"malformed", "yesterday", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := TokenCode{LastRefreshedAt: test.lastRefreshedAt}
+
+			if got := token.IsWithinReuseGracePeriod(); got != test.want {
+				t.Errorf("IsWithinReuseGracePeriod() with lastRefreshedAt %q = %v, want %v", test.lastRefreshedAt, got, test.want)
+			}
+		})
+	}
+}
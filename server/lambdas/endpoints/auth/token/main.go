@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
 
@@ -14,9 +13,13 @@ import (
 var (
 	CallbackUri              = os.Getenv("CallbackUri")
 	CognitoUrl               = os.Getenv("CognitoUrl")
+	VerificationUri          = os.Getenv("VerificationUri")
 	PollingIntervalInSeconds int64
 )
 
+// Read more about it: https://www.rfc-editor.org/rfc/rfc8628
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
 func init() {
 	var err error
 	PollingIntervalInSeconds, err = strconv.ParseInt(os.Getenv("PollingIntervalInSeconds"), 10, 64)
@@ -34,24 +37,31 @@ func main() {
 }
 
 func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
-	var (
-		clientId                 = req.QueryStringParameters["client_id"]
-		deviceCode, deviceCodeOk = req.QueryStringParameters["device_code"]
-		grantType, grantTypeOk   = req.QueryStringParameters["grant_type"]
-		// Read more about it: https://oauth.net/2/grant-types/device-code/
-		deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
-	)
-
-	/// TODO:improve it
-	if !deviceCodeOk {
-		return RequestSetOfToken(clientId), nil
-	} else if grantTypeOk && deviceCodeOk {
-		if grantType == deviceCodeGrantType {
-			return RequestJWTs(deviceCode, clientId), nil
-		} else {
-			return restApi.ApiResponse(http.StatusBadRequest, map[string]string{"message": "Unsupported grant type"}), nil
+	form, err := restApi.ParseForm(req)
+
+	if err != nil {
+		return buildOAuthError(errorInvalidRequest, "The body must be form encoded"), nil
+	}
+
+	switch req.HTTPMethod + " " + req.Resource {
+	case "POST /auth/device_authorization":
+		if form.Get("client_id") == "" {
+			return buildOAuthError(errorInvalidRequest, "The client_id parameter is missing"), nil
 		}
-	} else {
-		return restApi.ApiResponse(http.StatusBadRequest, map[string]string{"message": "Missing parameters"}), nil
+
+		// org_id is not part of RFC 8628; the CLI sends it so the pages can tell the user which org they sign in for
+		return RequestSetOfToken(form.Get("client_id"), form.Get("org_id"), req.RequestContext.Identity.SourceIP, req.RequestContext.Identity.UserAgent), nil
+	case "POST /auth/token":
+		if form.Get("grant_type") != deviceCodeGrantType {
+			return buildOAuthError(errorUnsupportedGrantType, "Only the device code grant is supported"), nil
+		}
+
+		if form.Get("device_code") == "" || form.Get("client_id") == "" {
+			return buildOAuthError(errorInvalidRequest, "The device_code and client_id parameters are required"), nil
+		}
+
+		return RequestJWTs(form.Get("device_code"), form.Get("client_id")), nil
+	default:
+		return restApi.UnhandledMethod(), nil
 	}
 }
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,7 +14,10 @@ import (
 	"time"
 
 	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
 	"github.com/PBH-Tech/moonenv/lambdas/util/oauth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/ratelimit"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 	"github.com/google/uuid"
 )
@@ -30,61 +35,105 @@ type CognitoTokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
-type APIResponse struct {
-	IdToken      string `json:"idToken"`
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    int    `json:"expiresIn"`
-	TokenType    string `json:"tokenType"`
-}
+// The error codes of RFC 6749 and RFC 8628 that the token endpoint answers with
+const (
+	errorAuthorizationPending = "authorization_pending"
+	errorSlowDown             = "slow_down"
+	errorExpiredToken         = "expired_token"
+	errorAccessDenied         = "access_denied"
+	errorInvalidGrant         = "invalid_grant"
+	errorInvalidRequest       = "invalid_request"
+	errorUnsupportedGrantType = "unsupported_grant_type"
+	// Devices that poll too fast have to wait this many more seconds on every later poll
+	slowDownIncrement = 5
+)
+
+// Refreshing and revoking look the client up through the device code, so a completed login is kept as long as
+// the refresh token of Cognito lives, which is 30 days unless the app client says otherwise
+const completedLoginLifetime = 30 * 24 * time.Hour
 
-func RequestSetOfToken(clientId string) restApi.Response {
+// Anyone can start a login, so each source IP can only create a few device codes at a time
+var deviceCodeLimit = ratelimit.Limit{Scope: "device-code", Max: 10, Window: 15 * time.Minute}
+
+// Starts a device authorization. The user finishes it on the verification page while the device polls the token endpoint
+func RequestSetOfToken(clientId string, orgId string, sourceIp string, userAgent string) restApi.Response {
 	var (
 		stateCode  = uuid.New().String()
 		deviceCode = uuid.New().String()
 		expiresIn  = 900 // 15 minutes
 	)
 
-	codeChallenge := generateCodeVerifierAndChallenge()
+	if result := ratelimit.Take(deviceCodeLimit, sourceIp); !result.Allowed {
+		return ratelimit.BuildLimitedResponse(result, "Too many logins were started from this address, try again later")
+	}
+
+	userCode, err := tokenCode.NewUserCode()
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the user code")
+	}
+
+	codeChallenge, err := generateCodeVerifierAndChallenge()
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the code verifier")
+	}
+
 	authorizationUri := fmt.Sprintf(
 		"%s/oauth2/authorize?response_type=code&client_id=%s&redirect_uri=%s&code_challenge=%s&code_challenge_method=S256&state=%s&scope=openid profile",
 		CognitoUrl, clientId, CallbackUri, codeChallenge.CodeChallenge, stateCode)
 
 	token, err := tokenCode.InsertToken(tokenCode.TokenCode{
 		DeviceCode:       deviceCode,
+		DeviceId:         uuid.New().String(),
+		UserCode:         userCode,
 		AuthorizationUri: authorizationUri,
 		ClientId:         clientId,
+		OrgId:            orgId,
+		SourceIp:         sourceIp,
+		UserAgent:        userAgent,
+		CreatedAt:        strconv.FormatInt(time.Now().Unix(), 10),
 		CodeChallenge:    codeChallenge.CodeChallenge,
 		CodeVerifier:     codeChallenge.CodeVerifier,
-		Status:           "authorization_pending",
+		Interval:         PollingIntervalInSeconds,
+		Status:           tokenCode.StatusPending,
 		State:            stateCode,
-		ExpireAt:         strconv.FormatInt(time.Now().Add(time.Duration(expiresIn)*time.Second).Unix(), 10),
+		ExpireAt:         time.Now().Add(time.Duration(expiresIn) * time.Second).Unix(),
 		LastCheckedAt:    strconv.FormatInt(time.Now().Unix(), 10),
 	})
 
 	if err != nil {
-		return restApi.ApiResponse(http.StatusBadRequest, err.Error())
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to start the authorization")
 	}
 
-	return restApi.ApiResponse(http.StatusCreated, map[string]string{
-		"authorizationUri": token.AuthorizationUri,
-		"deviceCode":       token.DeviceCode,
-		"expiresAt":        token.ExpireAt,
-		"lastCheckedAt":    token.LastCheckedAt,
-		"status":           token.Status,
-	})
+	return withNoStore(restApi.ApiResponse(http.StatusOK, map[string]interface{}{
+		"device_code":               token.DeviceCode,
+		"user_code":                 token.UserCode,
+		"verification_uri":          VerificationUri,
+		"verification_uri_complete": VerificationUri + "?user_code=" + url.QueryEscape(token.UserCode),
+		"expires_in":                expiresIn,
+		"interval":                  token.Interval,
+	}))
 }
 
+// Answers a poll of the device, with the tokens once the user authorized it or with the error code of RFC 8628 otherwise
 func RequestJWTs(deviceCode string, clientId string) restApi.Response {
 	token, err := tokenCode.GetToken(deviceCode)
 
-	if token == nil || err != nil {
-		return restApi.BuildErrorResponse(http.StatusNotFound, "Device code was not found")
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the device code")
 	}
 
-	response := validateTokenCode(*token, clientId)
+	// Device codes cannot be guessed, so one that is not found has most likely expired
+	if token == nil {
+		return buildOAuthError(errorExpiredToken, "The device code has expired, start the login again")
+	}
 
-	if response != nil {
+	if token.ClientId != clientId {
+		return buildOAuthError(errorInvalidGrant, "The device code is not valid for this client")
+	}
+
+	if response := validateTokenCode(*token); response != nil {
 		return *response
 	}
 
@@ -92,26 +141,67 @@ func RequestJWTs(deviceCode string, clientId string) restApi.Response {
 
 	if err != nil {
 		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update token")
+	}
 
+	if response := getPollError(token.Status); response != nil {
+		return *response
 	}
 
-	if token.Status == "authorization_pending" {
-		return restApi.BuildErrorResponse(http.StatusBadRequest, "Authorization is still pending")
-	} else if token.Status == "completed" {
-		return restApi.BuildErrorResponse(http.StatusBadRequest, "This authorization flow is already completed")
-	} else if token.LoginCode == "" {
+	if token.LoginCode == "" {
 		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Something went wrong while setting the login code")
-	} else {
+	}
 
-		err = tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{Status: "completed"})
+	// Decrypted before the login is completed, since completing it removes the secrets from the record
+	if err := token.OpenSecrets(); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to decrypt the login code")
+	}
 
-		if err != nil {
-			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update token to complete state")
+	// Two polls can both read the authorized status; only the one that completes the login redeems the code
+	err = tokenCode.TransitionToken(token.DeviceCode, tokenCode.StatusAuthorized, tokenCode.StatusCompleted, tokenCode.TokenCode{
+		ExpireAt: time.Now().Add(completedLoginLifetime).Unix(),
+	})
 
-		}
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return buildOAuthError(errorInvalidGrant, "The device code was already used")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update token to complete state")
+	}
 
-		return getToken(*token)
+	return getToken(*token)
+}
+
+// Only authorized device codes can be redeemed; every other status answers the poll with its error code
+func getPollError(status tokenCode.Status) *restApi.Response {
+	var response restApi.Response
+
+	switch status {
+	case tokenCode.StatusAuthorized:
+		return nil
+	case tokenCode.StatusPending:
+		response = buildOAuthError(errorAuthorizationPending, "The user has not finished the authorization yet")
+	case tokenCode.StatusDenied:
+		response = buildOAuthError(errorAccessDenied, "The user denied the authorization")
+	case tokenCode.StatusCompleted:
+		response = buildOAuthError(errorInvalidGrant, "The device code was already used")
+	case tokenCode.StatusRevoked:
+		response = buildOAuthError(errorInvalidGrant, "The device was signed out, start the login again")
+	default:
+		response = buildOAuthError(errorInvalidGrant, "The device code is not valid")
 	}
+
+	return &response
+}
+
+func buildOAuthError(code string, description string) restApi.Response {
+	return withNoStore(restApi.ApiResponse(http.StatusBadRequest, map[string]string{"error": code, "error_description": description}))
+}
+
+// Token responses must never be cached, as RFC 6749 requires
+func withNoStore(response restApi.Response) restApi.Response {
+	response.Headers["Cache-Control"] = "no-store"
+	response.Headers["Pragma"] = "no-cache"
+
+	return response
 }
 
 func getToken(token tokenCode.TokenCode) restApi.Response {
@@ -150,62 +240,103 @@ func getToken(token tokenCode.TokenCode) restApi.Response {
 		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Error decoding JSON response")
 	}
 
-	return restApi.ApiResponse(http.StatusCreated, APIResponse(tokenResponse))
-}
+	userId := getSubject(tokenResponse.IdToken)
+	refreshToken, err := recordSession(token, userId, tokenResponse.RefreshToken)
 
-func generateCodeVerifierAndChallenge() CodeChallenge {
-	var (
-		codeVerifier = uuid.New().String()
-	)
-	hasher := sha256.New()
+	// The device only ever gets the rotating refresh token, so it cannot sign in without it
+	if err != nil {
+		log.Printf("Failed to record the session of the device %s: %v", token.DeviceId, err)
 
-	hasher.Write([]byte(codeVerifier))
-	codeVerifierHash := hasher.Sum(nil)
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to record the session, start the login again")
+	}
 
-	codeChallenge := base64.URLEncoding.EncodeToString(codeVerifierHash)
-	codeChallenge = strings.TrimRight(codeChallenge, "=")
+	tokenResponse.RefreshToken = refreshToken
 
-	return CodeChallenge{
-		CodeChallenge: codeChallenge,
-		CodeVerifier:  codeVerifier,
-	}
+	publishLogin(userId, token)
+
+	return withNoStore(restApi.ApiResponse(http.StatusOK, tokenResponse))
 }
 
-// TODO: find a different way to validate it
-func validateTokenCode(token tokenCode.TokenCode, clientId string) *restApi.Response {
-	expiresAt, err := strconv.ParseInt(token.ExpireAt, 10, 64)
+func publishLogin(userId string, token tokenCode.TokenCode) {
+	events.Publish(events.Event{Type: events.TypeAuthLogin, ActorId: userId, ClientId: token.ClientId})
+}
+
+// Keeps who signed in and the refresh token of Cognito, so the user can list the device and sign it out later.
+// Returns the first refresh token of the family, the one the device gets instead of the one of Cognito
+func recordSession(token tokenCode.TokenCode, userId string, cognitoRefreshToken string) (string, error) {
+	sealedRefreshToken, err := token.SealSecret("refreshToken", cognitoRefreshToken)
 
 	if err != nil {
-		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Impossible to convert expires at")
+		return "", err
+	}
 
-		return &response
+	refreshToken, refreshTokenHash, err := tokenCode.NewRefreshToken()
+
+	if err != nil {
+		return "", err
 	}
 
-	var (
-		isExpired       = time.Now().Unix() > expiresAt
-		isStatusExpired = token.Status == "expired"
-	)
+	err = tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{
+		UserId:           userId,
+		RefreshToken:     sealedRefreshToken,
+		RefreshTokenHash: refreshTokenHash,
+	})
 
-	if isStatusExpired || isExpired {
-		response := restApi.BuildErrorResponse(http.StatusGone, "Token is expired")
+	if err != nil {
+		return "", err
+	}
 
-		if err == nil && !isStatusExpired {
-			err = tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{Status: "expired"})
+	return refreshToken, nil
+}
 
-			if err != nil {
-				response = restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update token")
-			}
-		}
+// Reads the `sub` claim of the ID token. It comes straight from Cognito, so its signature is not checked here
+func getSubject(idToken string) string {
+	parts := strings.Split(idToken, ".")
 
-		return &response
+	if len(parts) != 3 {
+		return ""
 	}
 
-	if token.ClientId != clientId {
-		response := restApi.BuildErrorResponse(http.StatusForbidden, "The client ID does not match")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 
-		return &response
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Sub string `json:"sub"`
 	}
 
+	json.Unmarshal(payload, &claims)
+
+	return claims.Sub
+}
+
+// The verifier is 32 random bytes in base64url, which gives the 43 characters RFC 7636 recommends
+func generateCodeVerifierAndChallenge() (*CodeChallenge, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	codeVerifier := base64.RawURLEncoding.EncodeToString(randomBytes)
+	hasher := sha256.New()
+
+	hasher.Write([]byte(codeVerifier))
+	codeVerifierHash := hasher.Sum(nil)
+
+	codeChallenge := base64.URLEncoding.EncodeToString(codeVerifierHash)
+	codeChallenge = strings.TrimRight(codeChallenge, "=")
+
+	return &CodeChallenge{
+		CodeChallenge: codeChallenge,
+		CodeVerifier:  codeVerifier,
+	}, nil
+}
+
+// Checks that the device respects its polling interval. Expired device codes are never loaded, so they need no check here
+func validateTokenCode(token tokenCode.TokenCode) *restApi.Response {
 	lastCheckedAt, err := strconv.ParseInt(token.LastCheckedAt, 10, 64)
 
 	if err != nil {
@@ -214,10 +345,15 @@ func validateTokenCode(token tokenCode.TokenCode, clientId string) *restApi.Resp
 		return &response
 	}
 
-	if time.Now().Unix() <= lastCheckedAt+PollingIntervalInSeconds {
+	interval := max(token.Interval, PollingIntervalInSeconds)
+
+	if time.Now().Unix() < lastCheckedAt+interval {
 		var response restApi.Response
 
-		err = tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{LastCheckedAt: strconv.FormatInt(time.Now().Unix(), 10)})
+		err = tokenCode.UpdateToken(token.DeviceCode, tokenCode.TokenCode{
+			LastCheckedAt: strconv.FormatInt(time.Now().Unix(), 10),
+			Interval:      interval + slowDownIncrement,
+		})
 
 		if err != nil {
 			response = restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update token")
@@ -225,7 +361,7 @@ func validateTokenCode(token tokenCode.TokenCode, clientId string) *restApi.Resp
 			return &response
 		}
 
-		response = restApi.BuildErrorResponse(http.StatusTooManyRequests, fmt.Sprintf("Respect the pooling interval of %d second(s)", PollingIntervalInSeconds))
+		response = buildOAuthError(errorSlowDown, fmt.Sprintf("Poll at most every %d second(s)", interval+slowDownIncrement))
 
 		return &response
 	}
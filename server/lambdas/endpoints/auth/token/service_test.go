@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	tokenCode "github.com/PBH-Tech/moonenv/lambdas/endpoints/auth"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+)
+
+// Package variables are set before init runs, which refuses to start without the polling interval
+var _ = os.Setenv("PollingIntervalInSeconds", "5")
+
+func TestGetPollError(t *testing.T) {
+	tests := []struct {
+		status    tokenCode.Status
+		wantError string
+	}{
+		{tokenCode.StatusAuthorized, ""},
+		{tokenCode.StatusPending, errorAuthorizationPending},
+		{tokenCode.StatusDenied, errorAccessDenied},
+		{tokenCode.StatusCompleted, errorInvalidGrant},
+		{tokenCode.StatusRevoked, errorInvalidGrant},
+		{tokenCode.Status(""), errorInvalidGrant},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.status), func(t *testing.T) {
+			response := getPollError(test.status)
+
+			if test.wantError == "" {
+				if response != nil {
+					t.Fatalf("getPollError(%q) = %s, want none", test.status, response.Body)
+				}
+
+				return
+			}
+
+			if response == nil {
+				t.Fatalf("getPollError(%q) = nil, want %s", test.status, test.wantError)
+			}
+
+			var body map[string]string
+
+			if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			if response.StatusCode != http.StatusBadRequest || body["error"] != test.wantError {
+				t.Errorf("getPollError(%q) = %d %s, want %d %s", test.status, response.StatusCode, body["error"], http.StatusBadRequest, test.wantError)
+			}
+
+			if response.Headers["Cache-Control"] != "no-store" {
+				t.Errorf("getPollError(%q) can be cached", test.status)
+			}
+		})
+	}
+}
+
+func TestPublishLogin(t *testing.T) {
+	sink := events.NewMemorySink()
+	events.SetPublisher(sink)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	publishLogin("user-1", tokenCode.TokenCode{DeviceCode: "device-code", ClientId: "cli-client"})
+
+	got := sink.Events()
+	want := events.Event{Type: events.TypeAuthLogin, ActorId: "user-1", ClientId: "cli-client"}
+
+	if len(got) != 1 || got[0].OccurredAt == "" {
+		t.Fatalf("publishLogin() published %+v, want one event with a time", got)
+	}
+
+	if got[0].OccurredAt = ""; got[0] != want {
+		t.Errorf("publishLogin() published %+v, want %+v", got[0], want)
+	}
+}
@@ -1,8 +1,19 @@
 package tokenCode
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,25 +22,93 @@ import (
 )
 
 type TokenCode struct {
-	DeviceCode       string `json:"deviceCode"`
+	DeviceCode string `json:"deviceCode"`
+	// Identifies the device to its user; unlike the device code, it is not a secret
+	DeviceId string `json:"deviceId"`
+	// Set once the login completes, from the subject of the ID token
+	UserId string `json:"userId"`
+	// Chosen by the user; the user agent is shown until then
+	DeviceName      string `json:"deviceName"`
+	LastRefreshedAt string `json:"lastRefreshedAt"`
+	// The refresh token of Cognito, kept after the login so the device can be signed out from anywhere. The device never sees it
+	RefreshToken string `json:"refreshToken"`
+	// Hash of the refresh token the device holds now; it changes on every refresh
+	RefreshTokenHash string `json:"refreshTokenHash"`
+	// Hashes of the refresh tokens the device held before. A string set, so it is left out until the first rotation
+	RotatedRefreshTokenHashes []string `json:"rotatedRefreshTokenHashes,omitempty"`
+	// What the user types or confirms on the verification page, such as WDJB-MJHT
+	UserCode         string `json:"userCode"`
 	State            string `json:"state"`
 	AuthorizationUri string `json:"authorizationUri"`
 	ClientId         string `json:"clientId"`
-	ExpireAt         string `json:"expireAt"`
-	LastCheckedAt    string `json:"lastCheckedAt"`
-	LoginCode        string `json:"loginCode"`
-	CodeChallenge    string `json:"codeChallenge"`
-	CodeVerifier     string `json:"codeVerifier"` // Omitting it
-	// TODO: find a way to turn it into something like an enum
-	Status string `json:"status"`
+	// The org the CLI logs in for, only shown to the user, since the tokens are not tied to it
+	OrgId string `json:"orgId"`
+	// What the device sent when it started the login, so the user can recognise it
+	SourceIp  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+	CreatedAt string `json:"createdAt"`
+	// Unix seconds; DynamoDB deletes the record some time after it, as the TTL attribute of the table
+	ExpireAt      int64  `json:"expireAt"`
+	LastCheckedAt string `json:"lastCheckedAt"`
+	LoginCode     string `json:"loginCode"`
+	CodeChallenge string `json:"codeChallenge"`
+	CodeVerifier  string `json:"codeVerifier"` // Omitting it
+	// The data key that encrypts the secret attributes, itself encrypted by KMS
+	DataKey string `json:"dataKey"`
+	// Seconds the device has to wait between polls; it grows each time the device polls too fast
+	Interval int64 `json:"interval"`
+	// Hash of the cookie given to the browser that confirmed the user code; the callback only accepts that browser
+	BrowserBinding string `json:"browserBinding"`
+	Status         Status `json:"status"`
 }
 
+type Status string
+
+const (
+	// The device is polling and nobody signed in for it yet
+	StatusPending Status = "authorization_pending"
+	// Cognito sent the login code back, and the next poll can redeem it
+	StatusAuthorized Status = "authorized"
+	StatusDenied     Status = "denied"
+	// The login code was exchanged for tokens; it cannot be redeemed again, and the device is signed in
+	StatusCompleted Status = "completed"
+	// The user signed the device out, and its refresh token was revoked in Cognito
+	StatusRevoked Status = "revoked"
+)
+
+// The only moves a device authorization can make; denied and revoked are final
+var statusTransitions = map[Status][]Status{
+	StatusPending:    {StatusAuthorized, StatusDenied},
+	StatusAuthorized: {StatusCompleted},
+	StatusCompleted:  {StatusRevoked},
+}
+
+func (status Status) CanMoveTo(to Status) bool {
+	return slices.Contains(statusTransitions[status], to)
+}
+
+// The secrets a status no longer needs, removed in the same write that moves the record into it
+var removedOnTransition = map[Status][]string{
+	StatusDenied:    loginSecrets,
+	StatusCompleted: loginSecrets,
+	StatusRevoked:   {"refreshToken"},
+}
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
 var (
 	tokenCodeTableName = aws.String(os.Getenv("TokenCodeTableName"))
 )
 
+// Stores the token with its secret attributes encrypted, and returns it as given
 func InsertToken(token TokenCode) (*TokenCode, error) {
-	item, err := dynamodbattribute.MarshalMap(token)
+	sealed := token
+
+	if err := sealed.sealSecrets(); err != nil {
+		return nil, err
+	}
+
+	item, err := dynamodbattribute.MarshalMap(sealed)
 
 	if err != nil {
 		return nil, err
@@ -46,7 +125,9 @@ func InsertToken(token TokenCode) (*TokenCode, error) {
 		return nil, err
 	}
 
-	client.PutItem(input)
+	if _, err := client.PutItem(input); err != nil {
+		return nil, err
+	}
 
 	return &token, nil
 }
@@ -77,7 +158,7 @@ func GetToken(deviceCode string) (*TokenCode, error) {
 
 	err = dynamodbattribute.UnmarshalMap(result.Item, tokenCode)
 
-	if result.Item == nil || err != nil {
+	if result.Item == nil || err != nil || tokenCode.IsExpired() {
 		return nil, err
 	}
 
@@ -108,10 +189,37 @@ func QueryToken(indexName string, keyConditions map[string]*dynamodbService.Cond
 		return nil, err
 	}
 
-	return tokens, nil
+	return slices.DeleteFunc(tokens, func(token *TokenCode) bool { return token.IsExpired() }), nil
 }
 
+// DynamoDB can take days to delete expired records, so reads skip them as if they were already gone
+func (token TokenCode) IsExpired() bool {
+	return time.Now().Unix() > token.ExpireAt
+}
+
+// Sets the non-zero fields of tokenCodeToUpdate, as long as the record was not deleted in the meantime
 func UpdateToken(deviceCode string, tokenCodeToUpdate TokenCode) error {
+	return updateToken(deviceCode, tokenCodeToUpdate, nil, "attribute_exists(deviceCode)", nil)
+}
+
+// Moves the record from one status to the next along with the other changes, in a single conditional write.
+// It fails with a conditional check error when the record is no longer in the from status or has expired,
+// so only one of two concurrent callers can make the same move
+func TransitionToken(deviceCode string, from Status, to Status, changes TokenCode) error {
+	if !from.CanMoveTo(to) {
+		return ErrInvalidTransition
+	}
+
+	// Also defines the #status placeholder the condition needs
+	changes.Status = to
+
+	return updateToken(deviceCode, changes, removedOnTransition[to], "#status = :fromStatus AND expireAt >= :now", map[string]*dynamodbService.AttributeValue{
+		":fromStatus": {S: aws.String(string(from))},
+		":now":        {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+	})
+}
+
+func updateToken(deviceCode string, tokenCodeToUpdate TokenCode, removed []string, condition string, conditionValues map[string]*dynamodbService.AttributeValue) error {
 	client, err := dynamodb.NewDynamodb()
 
 	if err != nil {
@@ -132,7 +240,7 @@ func UpdateToken(deviceCode string, tokenCodeToUpdate TokenCode) error {
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
 		typeField := v.Type().Field(i)
-		tag := typeField.Tag.Get("json")
+		tag, _, _ := strings.Cut(typeField.Tag.Get("json"), ",")
 
 		if tag == "" {
 			tag = typeField.Name
@@ -156,13 +264,24 @@ func UpdateToken(deviceCode string, tokenCodeToUpdate TokenCode) error {
 		}
 	}
 
+	updateExpression = "SET " + updateExpression
+
+	if len(removed) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removed, ", ")
+	}
+
+	for placeholder, value := range conditionValues {
+		expressionAttributeValues[placeholder] = value
+	}
+
 	input := dynamodbService.UpdateItemInput{
 		Key: map[string]*dynamodbService.AttributeValue{
 			"deviceCode": {
 				S: aws.String(deviceCode),
 			},
 		},
-		UpdateExpression:          aws.String("SET " + updateExpression),
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String(condition),
 		ExpressionAttributeValues: expressionAttributeValues,
 		ExpressionAttributeNames:  expressionAttributeNames,
 		TableName:                 tokenCodeTableName,
@@ -177,3 +296,71 @@ func UpdateToken(deviceCode string, tokenCodeToUpdate TokenCode) error {
 
 	return nil
 }
+
+// Consonants only, so codes never spell words and are hard to mistype, as RFC 8628 suggests
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Returns eight random characters from the alphabet, split in two groups for readability
+func NewUserCode() (string, error) {
+	code := make([]byte, 8)
+
+	for i := range code {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = userCodeAlphabet[index.Int64()]
+	}
+
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// Accepts what users tend to type, such as lowercase letters or a missing dash
+func NormalizeUserCode(userCode string) string {
+	var code []rune
+
+	for _, char := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, char) {
+			code = append(code, char)
+		}
+	}
+
+	if len(code) != 8 {
+		return ""
+	}
+
+	return string(code[:4]) + "-" + string(code[4:])
+}
+
+// The cookie that ties the browser confirming the user code to the one coming back from Cognito
+const BrowserBindingCookie = "moonenv_device_binding"
+
+// Returns the secret to set in the browser and the hash to store in the token code
+func NewBrowserBinding() (string, string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	return encodedSecret, hashBrowserBinding(encodedSecret), nil
+}
+
+// Whether the secret sent by the browser is the one given when the user code was confirmed
+func (token TokenCode) IsBoundTo(secret string) bool {
+	if token.BrowserBinding == "" || secret == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token.BrowserBinding), []byte(hashBrowserBinding(secret))) == 1
+}
+
+func hashBrowserBinding(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(hash[:])
+}
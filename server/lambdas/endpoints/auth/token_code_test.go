@@ -0,0 +1,36 @@
+package tokenCode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusCanMoveTo(t *testing.T) {
+	var (
+		statuses = []Status{StatusPending, StatusAuthorized, StatusDenied, StatusCompleted, StatusRevoked}
+		allowed  = map[Status]map[Status]bool{
+			StatusPending:    {StatusAuthorized: true, StatusDenied: true},
+			StatusAuthorized: {StatusCompleted: true},
+			StatusCompleted:  {StatusRevoked: true},
+		}
+	)
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			t.Run(string(from)+" to "+string(to), func(t *testing.T) {
+				want := allowed[from][to]
+
+				if got := from.CanMoveTo(to); got != want {
+					t.Errorf("Status(%q).CanMoveTo(%q) = %v, want %v", from, to, got, want)
+				}
+
+				// Invalid moves are refused before the record is touched
+				if !want {
+					if err := TransitionToken("device-code", from, to, TokenCode{}); !errors.Is(err, ErrInvalidTransition) {
+						t.Errorf("TransitionToken(%q, %q) error = %v, want %v", from, to, err, ErrInvalidTransition)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tokenCode
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/envelope"
+)
+
+// Only needed until the login code is redeemed
+var loginSecrets = []string{"codeVerifier", "loginCode", "authorizationUri"}
+
+var (
+	tokenCodeKeyId = os.Getenv("TokenCodeKeyId")
+)
+
+// Attributes that are encrypted at rest with the data key of the record
+func (token *TokenCode) secretFields() map[string]*string {
+	return map[string]*string{
+		"codeVerifier":     &token.CodeVerifier,
+		"loginCode":        &token.LoginCode,
+		"authorizationUri": &token.AuthorizationUri,
+		"refreshToken":     &token.RefreshToken,
+	}
+}
+
+// Gives the record a new data key and encrypts the secret attributes that are set
+func (token *TokenCode) sealSecrets() error {
+	key, encryptedKey, err := envelope.NewDataKey(tokenCodeKeyId)
+
+	if err != nil {
+		return err
+	}
+
+	token.DataKey = encryptedKey
+
+	for attribute, field := range token.secretFields() {
+		if *field == "" {
+			continue
+		}
+
+		if *field, err = envelope.Seal(key, *field, secretContext(*token, attribute)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Encrypts a value for one of the secret attributes of a stored record, such as the login code of the callback.
+// Records stored before encryption have no data key, and keep their values in plaintext until they expire
+func (token TokenCode) SealSecret(attribute string, value string) (string, error) {
+	if token.DataKey == "" {
+		return value, nil
+	}
+
+	key, err := envelope.OpenDataKey(token.DataKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	return envelope.Seal(key, value, secretContext(token, attribute))
+}
+
+// Decrypts the secret attributes of a loaded record in place. Only the lambdas that use them should call it,
+// so a read of the record does not need KMS
+func (token *TokenCode) OpenSecrets() error {
+	if token.DataKey == "" {
+		return nil
+	}
+
+	key, err := envelope.OpenDataKey(token.DataKey)
+
+	if err != nil {
+		return err
+	}
+
+	for attribute, field := range token.secretFields() {
+		if *field == "" {
+			continue
+		}
+
+		if *field, err = envelope.Open(key, *field, secretContext(*token, attribute)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ties each sealed value to its record and attribute
+func secretContext(token TokenCode, attribute string) string {
+	return token.DeviceCode + "#" + attribute
+}
@@ -0,0 +1,267 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	"github.com/PBH-Tech/moonenv/lambdas/util/cognito"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type EnvAccess string
+
+const (
+	EnvAccessRead  EnvAccess = "read"
+	EnvAccessWrite EnvAccess = "write"
+)
+
+// Returns the caller that the Lambda authorizer attached to the request
+func GetPrincipal(req restApi.Request) principal.Principal {
+	return principal.FromContext(req.RequestContext.Authorizer)
+}
+
+// Returns the user id of the caller; for personal access tokens, it is the id of the user who created them
+func GetCallerId(req restApi.Request) string {
+	return GetPrincipal(req).Id
+}
+
+func GetCallerGroups(req restApi.Request) []string {
+	return GetPrincipal(req).Groups
+}
+
+// Service credentials and personal access tokens can only pull and push, so the rest of the API
+// is kept to signed in users
+func RequireUser(req restApi.Request) *restApi.Response {
+	caller := GetPrincipal(req)
+
+	if caller.Id == "" {
+		response := restApi.BuildErrorResponse(http.StatusUnauthorized, "Caller identity is missing")
+
+		return &response
+	}
+
+	if caller.Type != principal.TypeUser {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, "Only signed in users can do this")
+
+		return &response
+	}
+
+	return nil
+}
+
+// Makes sure the caller is a signed in user who belongs to the org with, at least, the required role
+func AuthorizeOrgRole(req restApi.Request, orgId string, required orgs.Role) (*orgs.Membership, *restApi.Response) {
+	if errResponse := RequireUser(req); errResponse != nil {
+		return nil, errResponse
+	}
+
+	return authorizeMembership(GetCallerId(req), orgId, required)
+}
+
+func authorizeMembership(callerId string, orgId string, required orgs.Role) (*orgs.Membership, *restApi.Response) {
+	if callerId == "" {
+		response := restApi.BuildErrorResponse(http.StatusUnauthorized, "Caller identity is missing")
+
+		return nil, &response
+	}
+
+	membership, err := orgs.GetMembership(orgId, callerId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org membership")
+
+		return nil, &response
+	}
+
+	if membership == nil || !membership.Role.Includes(required) {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, "You do not have access to this org")
+
+		return nil, &response
+	}
+
+	return membership, nil
+}
+
+// Service credentials are limited by their OAuth scopes and personal access tokens by their pattern,
+// on top of the org role of whoever is behind them
+func getCredentialDenial(caller principal.Principal, orgId string, repoId string, env string, access EnvAccess) string {
+	switch caller.Type {
+	case principal.TypeService:
+		scope := cognito.EnvReadScope
+
+		if access == EnvAccessWrite {
+			scope = cognito.EnvWriteScope
+		}
+
+		if !caller.HasScope(scope) {
+			return fmt.Sprintf("The service credential is missing the %s scope", scope)
+		}
+	case principal.TypePersonalAccessToken:
+		if !caller.TokenAllows(orgId, repoId, env, principal.Access(access)) {
+			return fmt.Sprintf("The personal access token does not allow you to %s this env", access)
+		}
+	}
+
+	return ""
+}
+
+// Checks the caller rate limit, the org role and the env policy for the requested access, recording every denial
+// in the audit log. It returns the org, so callers can apply its settings
+func AuthorizeEnvAccess(req restApi.Request, orgId string, repoId string, env string, access EnvAccess) (*orgs.Org, *restApi.Response) {
+	var (
+		caller       = GetPrincipal(req)
+		callerId     = caller.Id
+		envPath      = orgs.GetEnvPath(repoId, env)
+		requiredRole = orgs.RoleReader
+	)
+
+	if access == EnvAccessWrite {
+		requiredRole = orgs.RoleWriter
+	}
+
+	if !orgs.IsValidName(repoId) || !orgs.IsValidName(env) {
+		response := restApi.BuildErrorResponse(http.StatusBadRequest, "Repository and env names cannot be empty or contain \"/\" or \"..\"")
+
+		return nil, &response
+	}
+
+	if errResponse := checkCallerLimit(callerId); errResponse != nil {
+		return nil, errResponse
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+
+		return nil, &response
+	}
+
+	if org == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+
+		return nil, &response
+	}
+
+	if reason := getCredentialDenial(caller, orgId, repoId, env, access); reason != "" {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, reason)
+
+		recordDenial(orgId, callerId, access, envPath, reason)
+
+		return nil, &response
+	}
+
+	if _, errResponse := authorizeMembership(callerId, orgId, requiredRole); errResponse != nil {
+		if errResponse.StatusCode == http.StatusForbidden {
+			recordDenial(orgId, callerId, access, envPath, "Caller does not have the required org role")
+		}
+
+		return nil, errResponse
+	}
+
+	if len(org.Settings.AllowedEnvs) > 0 && !slices.Contains(org.Settings.AllowedEnvs, env) {
+		response := restApi.BuildErrorResponse(http.StatusBadRequest, fmt.Sprintf("The env %s is not allowed in this org", env))
+
+		return nil, &response
+	}
+
+	policy, err := orgs.GetEnvPolicy(orgId, envPath)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env policy")
+
+		return nil, &response
+	}
+
+	if policy == nil {
+		return org, nil
+	}
+
+	rule := policy.Read
+
+	if access == EnvAccessWrite {
+		rule = policy.Write
+	}
+
+	if !rule.Allows(callerId, caller.Groups) {
+		reason := fmt.Sprintf("The env policy of %s does not allow you to %s it", envPath, access)
+		response := restApi.BuildErrorResponse(http.StatusForbidden, reason)
+
+		recordDenial(orgId, callerId, access, envPath, reason)
+
+		return nil, &response
+	}
+
+	return org, nil
+}
+
+func recordDenial(orgId string, callerId string, access EnvAccess, envPath string, reason string) {
+	audit.Record(audit.Event{
+		OrgId:    orgId,
+		ActorId:  callerId,
+		Action:   fmt.Sprintf("env.%s", access),
+		Resource: envPath,
+		Outcome:  audit.OutcomeDenied,
+		Reason:   reason,
+	})
+}
+
+// Makes sure the repo is registered and can receive pushes, registering it when the org auto creates repos
+func ResolveRepoForPush(org orgs.Org, repoId string, callerId string) (*orgs.Repo, *restApi.Response) {
+	repo, err := orgs.GetRepo(org.OrgId, repoId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the repository")
+
+		return nil, &response
+	}
+
+	if repo == nil && org.Settings.AutoCreateRepos {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		repo, err = orgs.InsertRepo(orgs.Repo{
+			OrgId:     org.OrgId,
+			RepoId:    repoId,
+			Status:    orgs.RepoStatusActive,
+			CreatedAt: now,
+			CreatedBy: callerId,
+			UpdatedAt: now,
+		})
+
+		if dynamodb.IsConditionalCheckFailed(err) {
+			repo, err = orgs.GetRepo(org.OrgId, repoId)
+		}
+
+		if err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to register the repository")
+
+			return nil, &response
+		}
+	}
+
+	if repo == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Repository not found")
+
+		return nil, &response
+	}
+
+	if repo.Status == orgs.RepoStatusArchived {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "Repository is archived and read-only")
+
+		return nil, &response
+	}
+
+	if repo.RenamingTo != "" || repo.RenamingFrom != "" {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "Repository is being renamed, push again once the rename finishes")
+
+		return nil, &response
+	}
+
+	return repo, nil
+}
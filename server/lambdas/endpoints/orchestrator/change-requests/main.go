@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/change-requests":
+		return ListChangeRequests(req), nil
+	case "GET /orgs/{orgId}/change-requests/{changeRequestId}":
+		return GetChangeRequest(req), nil
+	case "POST /orgs/{orgId}/change-requests/{changeRequestId}/approve":
+		return ApproveChangeRequest(ctx, req), nil
+	case "POST /orgs/{orgId}/change-requests/{changeRequestId}/reject":
+		return RejectChangeRequest(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/ratelimit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type ReviewChangeRequestRequest struct {
+	Comment string `json:"comment"`
+}
+
+// The proposed env file, base64 encoded, is only added for callers who can read the env
+type ChangeRequestResponse struct {
+	*orgs.ChangeRequest
+	Content string `json:"content,omitempty"`
+}
+
+func ListChangeRequests(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		status = orgs.ChangeRequestStatus(req.QueryStringParameters["status"])
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	changeRequests, err := orgs.QueryChangeRequests(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the change requests")
+	}
+
+	filtered := []*orgs.ChangeRequest{}
+
+	for _, changeRequest := range changeRequests {
+		if status == "" || changeRequest.Status == status {
+			filtered = append(filtered, changeRequest)
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].RequestedAt > filtered[j].RequestedAt
+	})
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.ChangeRequest{"changeRequests": filtered})
+}
+
+func GetChangeRequest(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	changeRequest, errResponse := getChangeRequest(orgId, req.PathParameters["changeRequestId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	// Reviewers need the values to review them, but the other members of the org only get the diff of the keys
+	_, errResponse = orchestrator.AuthorizeEnvAccess(req, orgId, changeRequest.RepoId, changeRequest.Env, orchestrator.EnvAccessRead)
+
+	if errResponse != nil && errResponse.StatusCode != http.StatusForbidden {
+		return *errResponse
+	}
+
+	response := ChangeRequestResponse{ChangeRequest: changeRequest}
+
+	if errResponse == nil {
+		response.Content = changeRequest.Content
+	}
+
+	return restApi.ApiResponse(http.StatusOK, response)
+}
+
+// Applies the proposed content through the same checks as a push. The reviewer must be able to write the env
+// and cannot be the requester, and the env cannot have changed since the request was opened
+func ApproveChangeRequest(ctx context.Context, req restApi.Request) restApi.Response {
+	org, changeRequest, comment, errResponse := startReview(req)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	caller := orchestrator.GetPrincipal(req)
+	callerId := caller.Id
+
+	if changeRequest.RequestedBy == callerId {
+		return restApi.BuildErrorResponse(http.StatusForbidden, "You cannot approve your own change request")
+	}
+
+	if errResponse := review(*changeRequest, orgs.ChangeRequestStatusApproved, callerId, comment); errResponse != nil {
+		return *errResponse
+	}
+
+	// The requester is the author of the change; the reviewer only let it through
+	stored, errResponse := orchestrator.StoreEnvFile(ctx, orchestrator.EnvWrite{
+		Org:           *org,
+		RepoId:        changeRequest.RepoId,
+		Env:           changeRequest.Env,
+		B64Str:        changeRequest.Content,
+		Caller:        caller,
+		Author:        changeRequest.RequestedBy,
+		ChangeRequest: changeRequest,
+		Metadata: map[string]string{
+			"requested-by":      changeRequest.RequestedBy,
+			"approved-by":       callerId,
+			"change-request-id": changeRequest.ChangeRequestId,
+		},
+	})
+
+	if errResponse != nil {
+		orgs.ReopenChangeRequest(*changeRequest)
+
+		return *errResponse
+	}
+
+	audit.Record(audit.Event{OrgId: changeRequest.OrgId, ActorId: callerId, Action: "change-request.approved", Resource: changeRequest.EnvPath, Outcome: audit.OutcomeAllowed, Reason: changeRequest.ChangeRequestId})
+
+	body := map[string]interface{}{"message": "Change request approved and applied", "versionId": stored.VersionId}
+
+	if len(stored.Findings) > 0 {
+		body["warnings"] = stored.Findings
+	}
+
+	response := restApi.ApiResponse(http.StatusOK, body)
+	ratelimit.SetHeaders(&response, stored.Quota)
+
+	return response
+}
+
+// The requester can reject their own change request to withdraw it
+func RejectChangeRequest(req restApi.Request) restApi.Response {
+	_, changeRequest, comment, errResponse := startReview(req)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	callerId := orchestrator.GetCallerId(req)
+
+	if errResponse := review(*changeRequest, orgs.ChangeRequestStatusRejected, callerId, comment); errResponse != nil {
+		return *errResponse
+	}
+
+	audit.Record(audit.Event{OrgId: changeRequest.OrgId, ActorId: callerId, Action: "change-request.rejected", Resource: changeRequest.EnvPath, Outcome: audit.OutcomeAllowed, Reason: changeRequest.ChangeRequestId})
+
+	return restApi.ApiResponse(http.StatusOK, map[string]string{"message": "Change request rejected"})
+}
+
+// Loads the pending change request and makes sure the caller is a user who can write its env
+func startReview(req restApi.Request) (*orgs.Org, *orgs.ChangeRequest, string, *restApi.Response) {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		requestData ReviewChangeRequestRequest
+	)
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return nil, nil, "", errResponse
+	}
+
+	if req.Body != "" {
+		if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil {
+			response := restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+
+			return nil, nil, "", &response
+		}
+	}
+
+	changeRequest, errResponse := getChangeRequest(orgId, req.PathParameters["changeRequestId"])
+
+	if errResponse != nil {
+		return nil, nil, "", errResponse
+	}
+
+	org, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, changeRequest.RepoId, changeRequest.Env, orchestrator.EnvAccessWrite)
+
+	if errResponse != nil {
+		return nil, nil, "", errResponse
+	}
+
+	if changeRequest.Status != orgs.ChangeRequestStatusPending {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "Change request was already reviewed")
+
+		return nil, nil, "", &response
+	}
+
+	return org, changeRequest, requestData.Comment, nil
+}
+
+func review(changeRequest orgs.ChangeRequest, status orgs.ChangeRequestStatus, callerId string, comment string) *restApi.Response {
+	err := orgs.ReviewChangeRequest(changeRequest, status, callerId, strconv.FormatInt(time.Now().Unix(), 10), comment)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "Change request was already reviewed")
+
+		return &response
+	} else if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to review the change request")
+
+		return &response
+	}
+
+	return nil
+}
+
+func getChangeRequest(orgId string, changeRequestId string) (*orgs.ChangeRequest, *restApi.Response) {
+	changeRequest, err := orgs.GetChangeRequest(orgId, changeRequestId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the change request")
+
+		return nil, &response
+	}
+
+	if changeRequest == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Change request not found")
+
+		return nil, &response
+	}
+
+	return changeRequest, nil
+}
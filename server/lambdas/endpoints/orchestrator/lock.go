@@ -0,0 +1,83 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+// Refuses changes to a locked env with 423, unless the caller holds the override role of the org
+func CheckEnvLock(orgId string, callerId string, repoId string, env string) *restApi.Response {
+	lock, err := orgs.GetEnvLock(orgId, orgs.GetEnvPath(repoId, env))
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env lock")
+
+		return &response
+	}
+
+	if lock == nil {
+		return nil
+	}
+
+	return checkLock(orgId, callerId, *lock)
+}
+
+// Same as CheckEnvLock, for changes that touch every env of the repo, such as renaming or deleting it
+func CheckRepoLocks(orgId string, callerId string, repoId string) *restApi.Response {
+	locks, err := orgs.QueryEnvLocks(orgId, repoId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env locks")
+
+		return &response
+	}
+
+	for _, lock := range locks {
+		if errResponse := checkLock(orgId, callerId, *lock); errResponse != nil {
+			return errResponse
+		}
+	}
+
+	return nil
+}
+
+// The org is only loaded when the lock holds, to find its override role
+func checkLock(orgId string, callerId string, lock orgs.EnvLock) *restApi.Response {
+	if !lock.IsActive(time.Now().Unix()) {
+		return nil
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil || org == nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+
+		return &response
+	}
+
+	membership, err := orgs.GetMembership(orgId, callerId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org membership")
+
+		return &response
+	}
+
+	if membership != nil && membership.Role.Includes(org.Settings.GetLockOverrideRole()) {
+		audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.lock-overridden", Resource: lock.EnvPath, Outcome: audit.OutcomeAllowed, Reason: lock.Reason})
+
+		return nil
+	}
+
+	reason := fmt.Sprintf("The env %s is locked by %s: %s", lock.EnvPath, lock.LockedBy, lock.Reason)
+	response := restApi.BuildErrorResponse(http.StatusLocked, reason)
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.write", Resource: lock.EnvPath, Outcome: audit.OutcomeDenied, Reason: reason})
+
+	return &response
+}
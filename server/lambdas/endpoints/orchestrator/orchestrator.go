@@ -1,12 +1,23 @@
 package orchestrator
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	lambdaSdk "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
 )
 
 func GetHeader(headers map[string]string, key string) string {
@@ -23,3 +34,133 @@ func GetLambdaClient() *lambdaSdk.Lambda {
 
 	return lambdaSdk.New(newSession, &aws.Config{Region: aws.String(os.Getenv("AwsRegion"))})
 }
+
+// Reads the env file through the download lambda, returning it base64 encoded
+func DownloadEnvFile(orgId string, repoId string, env string) (string, *restApi.Response) {
+	result, errResponse := DownloadEnvFileIfChanged(orgId, repoId, env, "")
+
+	if errResponse != nil {
+		return "", errResponse
+	}
+
+	return result.File, nil
+}
+
+// Same as DownloadEnvFile, but leaves the file out when its ETag still matches ifNoneMatch
+func DownloadEnvFileIfChanged(orgId string, repoId string, env string, ifNoneMatch string) (*bucketService.DownloadFileResult, *restApi.Response) {
+	pathRequest := bucketService.DownloadFileData{Key: fmt.Sprintf("%s/%s/%s", orgId, repoId, env), IfNoneMatch: ifNoneMatch}
+	client := GetLambdaClient()
+	payload, err := json.Marshal(pathRequest)
+
+	if err != nil {
+		response := restApi.ApiResponse(http.StatusInternalServerError, "Failed while preparing the payload")
+
+		return nil, &response
+	}
+
+	result, err := client.Invoke(&lambdaSdk.InvokeInput{Payload: payload, FunctionName: aws.String(os.Getenv("DownloadFuncName"))})
+
+	if err != nil {
+		response := restApi.ApiResponse(http.StatusInternalServerError, "Failed invoking function")
+
+		return nil, &response
+	}
+
+	var file bucketService.DownloadFileResult
+
+	if result.FunctionError != nil || json.Unmarshal(result.Payload, &file) != nil {
+		response := restApi.ApiResponse(http.StatusNotFound, "File does not exist")
+
+		return nil, &response
+	}
+
+	return &file, nil
+}
+
+// Writes the env file through the upload lambda, returning the S3 version it created
+func UploadEnvFile(orgId string, repoId string, env string, b64Str string, metadata map[string]string) (string, *restApi.Response) {
+	request := bucketService.UploadFileData{B64Str: b64Str, ObjName: fmt.Sprintf("%s/%s/%s", orgId, repoId, env), Metadata: metadata}
+	client := GetLambdaClient()
+	payload, err := json.Marshal(request)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed while preparing the payload")
+
+		return "", &response
+	}
+
+	result, err := client.Invoke(&lambdaSdk.InvokeInput{FunctionName: aws.String(os.Getenv("UploadFuncName")), Payload: payload})
+
+	if err != nil || result.FunctionError != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed invoking function")
+
+		return "", &response
+	}
+
+	var uploadResponse restApi.Response
+
+	if err := json.Unmarshal(result.Payload, &uploadResponse); err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to read the upload result")
+
+		return "", &response
+	}
+
+	if uploadResponse.StatusCode >= http.StatusBadRequest {
+		return "", &uploadResponse
+	}
+
+	var uploadResult bucketService.UploadFileResult
+
+	json.Unmarshal([]byte(uploadResponse.Body), &uploadResult)
+
+	return uploadResult.VersionId, nil
+}
+
+// Hands the event to the webhook delivery lambda without waiting for it, so slow endpoints never hold a push back,
+// and to the event bus
+func PublishEnvEvent(event orgs.EnvEvent) {
+	event.EventId = uuid.New().String()
+	event.OccurredAt = strconv.FormatInt(time.Now().Unix(), 10)
+	busEventType := events.TypeEnvPushed
+
+	if event.Type == orgs.EnvEventDelete {
+		busEventType = events.TypeEnvDeleted
+	}
+
+	events.Publish(events.Event{
+		Type:       busEventType,
+		OrgId:      event.OrgId,
+		RepoId:     event.RepoId,
+		Env:        event.Env,
+		VersionId:  event.VersionId,
+		ActorId:    event.Author,
+		OccurredAt: event.OccurredAt,
+	})
+
+	if err := invokeAsync(os.Getenv("DeliverWebhookFuncName"), event); err != nil {
+		log.Printf("Failed to publish the %s event of %s: %v", event.Type, event.OrgId, err)
+	}
+}
+
+// Asks the sync lambda to copy the env to its SSM and Secrets Manager targets
+func SyncEnv(request orgs.SyncRequest) {
+	if err := invokeAsync(os.Getenv("SyncEnvFuncName"), request); err != nil {
+		log.Printf("Failed to sync %s of %s: %v", orgs.GetEnvPath(request.RepoId, request.Env), request.OrgId, err)
+	}
+}
+
+func invokeAsync(functionName string, input any) error {
+	payload, err := json.Marshal(input)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = GetLambdaClient().Invoke(&lambdaSdk.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		InvocationType: aws.String(lambdaSdk.InvocationTypeEvent),
+		Payload:        payload,
+	})
+
+	return err
+}
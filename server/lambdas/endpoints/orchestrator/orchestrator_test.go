@@ -0,0 +1,43 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+)
+
+func TestPublishEnvEvent(t *testing.T) {
+	// Without a webhook lambda to invoke, only the event bus gets the events
+	t.Setenv("AwsRegion", "us-east-1")
+	t.Setenv("DeliverWebhookFuncName", "")
+
+	sink := events.NewMemorySink()
+	events.SetPublisher(sink)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	PublishEnvEvent(orgs.EnvEvent{Type: orgs.EnvEventPush, OrgId: "acme", RepoId: "api", Env: "prod", VersionId: "v2", Author: "user-1"})
+	PublishEnvEvent(orgs.EnvEvent{Type: orgs.EnvEventDelete, OrgId: "acme", RepoId: "api", Env: "dev", Author: "user-2"})
+
+	want := []events.Event{
+		{Type: events.TypeEnvPushed, OrgId: "acme", RepoId: "api", Env: "prod", VersionId: "v2", ActorId: "user-1"},
+		{Type: events.TypeEnvDeleted, OrgId: "acme", RepoId: "api", Env: "dev", ActorId: "user-2"},
+	}
+	got := sink.Events()
+
+	if len(got) != len(want) {
+		t.Fatalf("PublishEnvEvent() published %d events, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].OccurredAt == "" {
+			t.Errorf("event %d has no time", i)
+		}
+
+		got[i].OccurredAt = ""
+
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -1,40 +1,51 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
-	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
-	"github.com/aws/aws-sdk-go/aws"
-	lambdaSdk "github.com/aws/aws-sdk-go/service/lambda"
 )
 
 func PullCommand(req restApi.Request) restApi.Response {
 	pathData := req.PathParameters
 	queryDate := req.QueryStringParameters
-	pathRequest := bucketService.DownloadFileData{Key: fmt.Sprintf("%s/%s/%s", pathData["orgId"], pathData["repoId"], queryDate["env"])}
-	client := orchestrator.GetLambdaClient()
-	payload, err := json.Marshal(pathRequest)
 
-	if err != nil {
-		return restApi.ApiResponse(http.StatusInternalServerError, "Failed while preparing the payload")
+	if _, errResponse := orchestrator.AuthorizeEnvAccess(req, pathData["orgId"], pathData["repoId"], queryDate["env"], orchestrator.EnvAccessRead); errResponse != nil {
+		return *errResponse
 	}
 
-	result, err := client.Invoke(&lambdaSdk.InvokeInput{Payload: payload, FunctionName: aws.String(os.Getenv("DownloadFuncName"))})
+	file, errResponse := orchestrator.DownloadEnvFileIfChanged(pathData["orgId"], pathData["repoId"], queryDate["env"], orchestrator.GetHeader(req.Headers, "If-None-Match"))
 
-	if err != nil {
-		return restApi.ApiResponse(http.StatusInternalServerError, "Failed invoking function")
+	if errResponse != nil {
+		return *errResponse
 	}
 
-	var response string
-
-	if err := json.Unmarshal(result.Payload, &response); err != nil {
-		return restApi.ApiResponse(http.StatusNotFound, "File does not exist")
+	// The caller already has this version, so there is nothing to send or to report as pulled
+	if file.NotModified {
+		return withETag(restApi.ApiResponse(http.StatusNotModified, nil), file.ETag)
 	}
 
-	return restApi.ApiResponse(http.StatusOK, map[string]string{"file": response})
+	publishPulled(req)
+
+	return withETag(restApi.ApiResponse(http.StatusOK, map[string]string{"file": file.File, "versionId": file.VersionId}), file.ETag)
+}
+
+// Browsers only let clients read the ETag, to send it back in If-None-Match, when it is exposed
+func withETag(response restApi.Response, eTag string) restApi.Response {
+	response.Headers["ETag"] = eTag
+	response.Headers["Access-Control-Expose-Headers"] = "ETag"
+
+	return response
+}
+
+func publishPulled(req restApi.Request) {
+	events.Publish(events.Event{
+		Type:    events.TypeEnvPulled,
+		OrgId:   req.PathParameters["orgId"],
+		RepoId:  req.PathParameters["repoId"],
+		Env:     req.QueryStringParameters["env"],
+		ActorId: orchestrator.GetCallerId(req),
+	})
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+func TestPublishPulled(t *testing.T) {
+	sink := events.NewMemorySink()
+	events.SetPublisher(sink)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	req := restApi.Request{
+		PathParameters:        map[string]string{"orgId": "acme", "repoId": "api"},
+		QueryStringParameters: map[string]string{"env": "prod"},
+	}
+	req.RequestContext.Authorizer = principal.Principal{Id: "user-1", Type: principal.TypeUser}.ToContext()
+
+	publishPulled(req)
+
+	got := sink.Events()
+	want := events.Event{Type: events.TypeEnvPulled, OrgId: "acme", RepoId: "api", Env: "prod", ActorId: "user-1"}
+
+	if len(got) != 1 || got[0].OccurredAt == "" {
+		t.Fatalf("publishPulled() published %+v, want one event with a time", got)
+	}
+
+	if got[0].OccurredAt = ""; got[0] != want {
+		t.Errorf("publishPulled() published %+v, want %+v", got[0], want)
+	}
+}
+
+func TestWithETag(t *testing.T) {
+	for _, statusCode := range []int{http.StatusOK, http.StatusNotModified} {
+		response := withETag(restApi.ApiResponse(statusCode, nil), `"abc"`)
+
+		if response.Headers["ETag"] != `"abc"` || response.Headers["Access-Control-Expose-Headers"] != "ETag" {
+			t.Errorf("withETag() on a %d response set the headers %v", statusCode, response.Headers)
+		}
+	}
+}
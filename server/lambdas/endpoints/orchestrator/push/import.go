@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretstore"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+type ImportEnvRequest struct {
+	// Imports use the same stores as the sync targets
+	Type orgs.SyncTargetType `json:"type"`
+	// The parameter path for SSM, or the secret name for Secrets Manager, under the store namespace of the org
+	Source string `json:"source"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// Builds a new version of the env from the parameters under an SSM path or the keys of a JSON secret.
+// The lambda reads them with its own role, so only org admins can import
+func ImportEnv(ctx context.Context, req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		repoId      = req.PathParameters["repoId"]
+		env         = req.QueryStringParameters["env"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData ImportEnvRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	org, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, repoId, env, orchestrator.EnvAccessWrite)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Source == "" || !requestData.Type.IsValid() {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if !orgs.IsInStoreNamespace(requestData.Type, orgId, requestData.Source) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The source must be under "+orgs.GetStoreNamespace(requestData.Type, orgId))
+	}
+
+	values, errResponse := readSource(requestData)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if len(values) == 0 {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "The source has no keys to import")
+	}
+
+	content, err := dotenv.Format(values)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusUnprocessableEntity, "Failed to write the env file: "+err.Error())
+	}
+
+	if requestData.DryRun {
+		return diffWithCurrent(orgId, repoId, env, content)
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.imported", Resource: orgs.GetEnvPath(repoId, env), Outcome: audit.OutcomeAllowed, Reason: string(requestData.Type) + " " + requestData.Source})
+
+	return pushEnvFile(ctx, req, *org, base64.StdEncoding.EncodeToString([]byte(content)))
+}
+
+func readSource(requestData ImportEnvRequest) (map[string]string, *restApi.Response) {
+	newSession, err := secretstore.NewSession()
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load SDK Configuration")
+
+		return nil, &response
+	}
+
+	var values map[string]string
+
+	if requestData.Type == orgs.SyncTargetSsm {
+		values, err = secretstore.ReadParameters(ssm.New(newSession), requestData.Source)
+	} else {
+		values, err = secretstore.ReadSecret(secretsmanager.New(newSession), requestData.Source)
+	}
+
+	if secretstore.IsNotFound(err) {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "The source does not exist")
+
+		return nil, &response
+	} else if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusBadGateway, "Failed to read the source: "+err.Error())
+
+		return nil, &response
+	}
+
+	return values, nil
+}
+
+// Lists the keys the import would add, remove or change, without their values
+func diffWithCurrent(orgId string, repoId string, env string, content string) restApi.Response {
+	current, errResponse := orchestrator.DownloadEnvFile(orgId, repoId, env)
+
+	if errResponse != nil && errResponse.StatusCode != http.StatusNotFound {
+		return *errResponse
+	}
+
+	currentContent, err := base64.StdEncoding.DecodeString(current)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to read the current env file")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string]interface{}{
+		"dryRun": true,
+		"diff":   dotenv.Diff(string(currentContent), content),
+	})
+}
@@ -11,6 +11,13 @@ func main() {
 	lambda.Start(handler)
 }
 
-func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
-	return PushCommand(req), nil
+func handler(ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "POST /orgs/{orgId}/repos/{repoId}":
+		return PushCommand(ctx, req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/import":
+		return ImportEnv(ctx, req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
 }
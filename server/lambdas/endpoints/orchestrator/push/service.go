@@ -1,26 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
-	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/ratelimit"
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
-	"github.com/aws/aws-sdk-go/aws"
-	lambdaSdk "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretscan"
 )
 
 type PushCommandRequest struct {
 	B64Str string `json:"b64String"`
 }
 
-func PushCommand(req restApi.Request) restApi.Response {
+func PushCommand(ctx context.Context, req restApi.Request) restApi.Response {
 	pathData := req.PathParameters
 	queryDate := req.QueryStringParameters
 
+	org, errResponse := orchestrator.AuthorizeEnvAccess(req, pathData["orgId"], pathData["repoId"], queryDate["env"], orchestrator.EnvAccessWrite)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
 	var commandData PushCommandRequest
 
 	err := json.Unmarshal([]byte(req.Body), &commandData)
@@ -29,19 +34,42 @@ func PushCommand(req restApi.Request) restApi.Response {
 		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
 	}
 
-	request := bucketService.UploadFileData{B64Str: commandData.B64Str, ObjName: fmt.Sprintf("%s/%s/%s", pathData["orgId"], pathData["repoId"], queryDate["env"])}
-	client := orchestrator.GetLambdaClient()
-	payload, err := json.Marshal(request)
+	return pushEnvFile(ctx, req, *org, commandData.B64Str)
+}
 
-	if err != nil {
-		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed while preparing the payload")
+// Counts the push against the quotas of the org, whose usage is returned in the rate limit headers
+func pushEnvFile(ctx context.Context, req restApi.Request, org orgs.Org, b64Str string) restApi.Response {
+	stored, errResponse := orchestrator.StoreEnvFile(ctx, orchestrator.EnvWrite{
+		Org:    org,
+		RepoId: req.PathParameters["repoId"],
+		Env:    req.QueryStringParameters["env"],
+		B64Str: b64Str,
+		Caller: orchestrator.GetPrincipal(req),
+		Author: orchestrator.GetCallerId(req),
+	})
+
+	if errResponse != nil {
+		return *errResponse
 	}
 
-	result, err := client.Invoke(&lambdaSdk.InvokeInput{FunctionName: aws.String(os.Getenv("UploadFuncName")), Payload: payload})
+	response := restApi.ApiResponse(http.StatusOK, withWarnings(map[string]interface{}{"message": "File uploaded", "versionId": stored.VersionId}, stored.Findings))
 
-	if err != nil {
-		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed invoking function")
+	if stored.ChangeRequest != nil {
+		response = restApi.ApiResponse(http.StatusAccepted, withWarnings(map[string]interface{}{
+			"message":       "The env is protected, so the push is waiting for approval",
+			"changeRequest": stored.ChangeRequest,
+		}, stored.Findings))
+	}
+
+	ratelimit.SetHeaders(&response, stored.Quota)
+
+	return response
+}
+
+func withWarnings(body map[string]interface{}, findings []secretscan.Finding) map[string]interface{} {
+	if len(findings) > 0 {
+		body["warnings"] = findings
 	}
 
-	return restApi.ApiResponse(int(*result.StatusCode), map[string]string{"message": "File uploaded"})
+	return body
 }
@@ -0,0 +1,158 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/ratelimit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Every caller, whatever the org, can only pull or push this often
+var callerLimit = ratelimit.Limit{Scope: "caller", Max: 120, Window: time.Minute}
+
+func checkCallerLimit(callerId string) *restApi.Response {
+	if result := ratelimit.Take(callerLimit, callerId); !result.Allowed {
+		response := ratelimit.BuildLimitedResponse(result, "Too many requests, slow down")
+
+		return &response
+	}
+
+	return nil
+}
+
+// Counts the push against the hourly quota of the org. The result is meant to be added to the response headers
+func TakePushQuota(org orgs.Org) (ratelimit.Result, *restApi.Response) {
+	limit := ratelimit.Limit{Scope: "push", Max: org.Quota.WithDefaults().PushesPerHour, Window: orgs.PushQuotaWindow}
+	result := ratelimit.Take(limit, org.OrgId)
+
+	if !result.Allowed {
+		response := ratelimit.BuildLimitedResponse(result, fmt.Sprintf("The org has reached its quota of %d pushes per hour", limit.Max))
+
+		return result, &response
+	}
+
+	return result, nil
+}
+
+// Refuses a push that would take the org over the number of envs or the bytes it can store.
+// change is what the push adds to the usage of the org, which shrinks when a smaller version replaces a bigger one
+func CheckStorageQuota(ctx context.Context, org orgs.Org, change orgs.OrgUsage) *restApi.Response {
+	usage, errResponse := getOrgUsage(ctx, org)
+
+	if errResponse != nil {
+		return errResponse
+	}
+
+	return getStorageDenial(org.Quota, orgs.OrgUsage{EnvCount: usage.EnvCount + change.EnvCount, StoredBytes: usage.StoredBytes + change.StoredBytes}, change)
+}
+
+// Counts the write in the usage of the org right before it is uploaded, refusing it when a concurrent push
+// took the rest of the quota since CheckStorageQuota
+func ReserveStorage(org orgs.Org, change orgs.OrgUsage) *restApi.Response {
+	err := orgs.AddOrgUsage(org.OrgId, change.EnvCount, change.StoredBytes, org.Quota)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		quota := org.Quota.WithDefaults()
+
+		return getStorageDenial(org.Quota, orgs.OrgUsage{EnvCount: quota.MaxEnvs + 1, StoredBytes: quota.MaxBytes + 1}, change)
+	} else if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to count the storage used by the org")
+
+		return &response
+	}
+
+	return nil
+}
+
+// Gives back what ReserveStorage counted, when the upload failed
+func ReleaseStorage(org orgs.Org, change orgs.OrgUsage) {
+	if err := orgs.AddOrgUsage(org.OrgId, -change.EnvCount, -change.StoredBytes, org.Quota); err != nil {
+		log.Printf("Failed to give back the storage reserved in %s: %v", org.OrgId, err)
+	}
+}
+
+func getStorageDenial(quota orgs.OrgQuota, usage orgs.OrgUsage, change orgs.OrgUsage) *restApi.Response {
+	quota = quota.WithDefaults()
+
+	if change.EnvCount > 0 && usage.EnvCount > quota.MaxEnvs {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, fmt.Sprintf("The org has reached its quota of %d envs", quota.MaxEnvs))
+
+		return &response
+	}
+
+	if change.StoredBytes > 0 && usage.StoredBytes > quota.MaxBytes {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, fmt.Sprintf("The push would take the org over its quota of %d stored bytes", quota.MaxBytes))
+
+		return &response
+	}
+
+	return nil
+}
+
+// Orgs created before storage was counted list the bucket once, and keep the counters from then on
+func getOrgUsage(ctx context.Context, org orgs.Org) (*orgs.OrgUsage, *restApi.Response) {
+	if org.Usage != nil {
+		return org.Usage, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load SDK Configuration")
+
+		return nil, &response
+	}
+
+	usage, err := CountStorage(ctx, s3.NewFromConfig(cfg), org.OrgId+"/")
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the storage used by the org")
+
+		return nil, &response
+	}
+
+	err = orgs.InitOrgUsage(org.OrgId, *usage)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		// Another push counted it first
+		current, err := orgs.GetOrg(org.OrgId)
+
+		if err == nil && current != nil && current.Usage != nil {
+			return current.Usage, nil
+		}
+	}
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to count the storage used by the org")
+
+		return nil, &response
+	}
+
+	return usage, nil
+}
+
+// Counts the envs under the prefix and the bytes of their current versions
+func CountStorage(ctx context.Context, s3Client *s3.Client, prefix string) (*orgs.OrgUsage, error) {
+	sizes, err := bucketService.ListObjectSizes(ctx, s3Client, prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	usage := orgs.OrgUsage{EnvCount: int64(len(sizes))}
+
+	for _, size := range sizes {
+		usage.StoredBytes += size
+	}
+
+	return &usage, nil
+}
@@ -0,0 +1,40 @@
+package orchestrator
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+)
+
+func TestGetStorageDenial(t *testing.T) {
+	quota := orgs.OrgQuota{MaxEnvs: 10, MaxBytes: 1000}
+
+	tests := []struct {
+		name   string
+		usage  orgs.OrgUsage
+		change orgs.OrgUsage
+		denied bool
+	}{
+		{"within the quota", orgs.OrgUsage{EnvCount: 5, StoredBytes: 500}, orgs.OrgUsage{EnvCount: 1, StoredBytes: 100}, false},
+		{"reaching the quota", orgs.OrgUsage{EnvCount: 10, StoredBytes: 1000}, orgs.OrgUsage{EnvCount: 1, StoredBytes: 100}, false},
+		{"one env too many", orgs.OrgUsage{EnvCount: 11, StoredBytes: 500}, orgs.OrgUsage{EnvCount: 1, StoredBytes: 100}, true},
+		{"too many bytes", orgs.OrgUsage{EnvCount: 5, StoredBytes: 1001}, orgs.OrgUsage{StoredBytes: 100}, true},
+		{"shrinking an org over its quota", orgs.OrgUsage{EnvCount: 20, StoredBytes: 2000}, orgs.OrgUsage{StoredBytes: -100}, false},
+		{"replacing an env of an org over its env quota", orgs.OrgUsage{EnvCount: 20, StoredBytes: 500}, orgs.OrgUsage{StoredBytes: 10}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := getStorageDenial(quota, test.usage, test.change)
+
+			if (response != nil) != test.denied {
+				t.Fatalf("getStorageDenial(%+v, %+v) = %v, want denied %v", test.usage, test.change, response, test.denied)
+			}
+
+			if response != nil && response.StatusCode != http.StatusForbidden {
+				t.Errorf("getStorageDenial() status = %d, want %d", response.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package orchestrator
+
+import (
+	"encoding/base64"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretscan"
+)
+
+// Records when the keys of the env got a new value, by comparing the new version with the previous one.
+// Unchanged keys that were never tracked, such as those pushed before the tracking existed, are recorded as of
+// the previous version, since they hold the same value at least since then. Their fingerprint is refreshed when it
+// was made with another key.
+// It only logs failures, since the version is already uploaded
+func TrackKeyChanges(orgId string, repoId string, env string, previousVersion bucketService.DownloadFileResult, currentB64 string, changedBy string, versionId string) {
+	previous, err := base64.StdEncoding.DecodeString(previousVersion.File)
+
+	if err != nil {
+		log.Printf("Failed to read the previous version of %s in %s: %v", orgs.GetEnvPath(repoId, env), orgId, err)
+
+		return
+	}
+
+	current, err := base64.StdEncoding.DecodeString(currentB64)
+
+	if err != nil {
+		log.Printf("Failed to read the new version of %s in %s: %v", orgs.GetEnvPath(repoId, env), orgId, err)
+
+		return
+	}
+
+	var (
+		changes   = dotenv.Diff(string(previous), string(current))
+		changedAt = strconv.FormatInt(time.Now().Unix(), 10)
+		values    = make(map[string]string)
+	)
+
+	for _, entry := range dotenv.Parse(string(current)) {
+		values[entry.Key] = entry.Value
+	}
+
+	fingerprints := getFingerprints(orgId, values)
+
+	for _, key := range append(changes.Added, changes.Changed...) {
+		err := orgs.InsertKeyRotation(orgs.KeyRotation{
+			OrgId:         orgId,
+			KeyPath:       orgs.GetKeyPath(repoId, env, key),
+			RepoId:        repoId,
+			Env:           env,
+			Key:           key,
+			LastChangedAt: changedAt,
+			LastChangedBy: changedBy,
+			VersionId:     versionId,
+			Fingerprint:   fingerprints[key],
+		})
+
+		if err != nil {
+			log.Printf("Failed to record the change of %s in %s: %v", orgs.GetKeyPath(repoId, env, key), orgId, err)
+		}
+	}
+
+	for _, key := range changes.Removed {
+		if err := orgs.DeleteKeyRotation(orgId, orgs.GetKeyPath(repoId, env, key)); err != nil {
+			log.Printf("Failed to forget the removed key %s in %s: %v", orgs.GetKeyPath(repoId, env, key), orgId, err)
+		}
+	}
+
+	if previousVersion.VersionId != "" {
+		trackUnchangedKeys(orgId, repoId, env, previousVersion, fingerprints, changes)
+	}
+}
+
+// Fingerprints the values of the env, leaving them out when the key cannot be derived; the change is still tracked
+func getFingerprints(orgId string, values map[string]string) map[string]string {
+	fingerprints := make(map[string]string)
+	key, err := getFingerprintKey(orgId)
+
+	if err != nil {
+		log.Printf("Failed to derive the fingerprint key of %s: %v", orgId, err)
+
+		return fingerprints
+	}
+
+	for name, value := range values {
+		fingerprints[name] = secretscan.Fingerprint(key, orgId, value)
+	}
+
+	return fingerprints
+}
+
+func trackUnchangedKeys(orgId string, repoId string, env string, previousVersion bucketService.DownloadFileResult, fingerprints map[string]string, changes dotenv.Changes) {
+	rotations, err := orgs.QueryKeyRotations(orgId, orgs.GetEnvPath(repoId, env)+"/")
+
+	if err != nil {
+		log.Printf("Failed to load the tracked keys of %s in %s: %v", orgs.GetEnvPath(repoId, env), orgId, err)
+
+		return
+	}
+
+	tracked := make(map[string]*orgs.KeyRotation)
+
+	for _, rotation := range rotations {
+		tracked[rotation.Key] = rotation
+	}
+
+	for key, fingerprint := range fingerprints {
+		if slices.Contains(changes.Added, key) || slices.Contains(changes.Changed, key) {
+			continue
+		}
+
+		if rotation, ok := tracked[key]; ok {
+			if fingerprint == "" || rotation.Fingerprint == fingerprint {
+				continue
+			}
+
+			rotation.Fingerprint = fingerprint
+
+			if err := orgs.InsertKeyRotation(*rotation); err != nil {
+				log.Printf("Failed to refresh the fingerprint of %s in %s: %v", rotation.KeyPath, orgId, err)
+			}
+
+			continue
+		}
+
+		err := orgs.InsertKeyRotation(orgs.KeyRotation{
+			OrgId:         orgId,
+			KeyPath:       orgs.GetKeyPath(repoId, env, key),
+			RepoId:        repoId,
+			Env:           env,
+			Key:           key,
+			LastChangedAt: previousVersion.LastModified,
+			VersionId:     previousVersion.VersionId,
+			Fingerprint:   fingerprint,
+		})
+
+		if err != nil {
+			log.Printf("Failed to record the age of %s in %s: %v", orgs.GetKeyPath(repoId, env, key), orgId, err)
+		}
+	}
+}
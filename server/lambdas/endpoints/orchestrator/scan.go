@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/envelope"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretscan"
+)
+
+var (
+	fingerprintKeyId = os.Getenv("FingerprintKeyId")
+	// Derived keys are kept while the Lambda is warm, so KMS is only asked once per org
+	fingerprintKeys      = make(map[string][]byte)
+	fingerprintKeysMutex sync.Mutex
+)
+
+// Looks for credentials in the pushed content, and for values that other repos of the org already hold.
+// Duplicates are only located in envs the caller can read; the others are counted.
+// The caller decides what to do with the findings from the scan action of the org
+func ScanEnvFile(org orgs.Org, caller principal.Principal, repoId string, content string) ([]secretscan.Finding, *restApi.Response) {
+	if org.Settings.SecretScan.Action == orgs.ScanActionOff {
+		return nil, nil
+	}
+
+	entries := dotenv.Parse(content)
+	findings := secretscan.Scan(entries, org.Settings.SecretScan.NonSensitiveKeys)
+	key, err := getFingerprintKey(org.OrgId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to look for duplicated secrets")
+
+		return nil, &response
+	}
+
+	readable := make(map[string]bool)
+
+	for _, entry := range entries {
+		fingerprint := secretscan.Fingerprint(key, org.OrgId, entry.Value)
+
+		if fingerprint == "" {
+			continue
+		}
+
+		rotations, err := orgs.QueryKeyRotationsByFingerprint(fingerprint)
+
+		if err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to look for duplicated secrets")
+
+			return nil, &response
+		}
+
+		hidden := 0
+
+		for _, rotation := range rotations {
+			if rotation.RepoId == repoId {
+				continue
+			}
+
+			envPath := orgs.GetEnvPath(rotation.RepoId, rotation.Env)
+
+			if _, ok := readable[envPath]; !ok {
+				canRead, err := canReadEnv(caller, org.OrgId, rotation.RepoId, rotation.Env)
+
+				if err != nil {
+					response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to look for duplicated secrets")
+
+					return nil, &response
+				}
+
+				readable[envPath] = canRead
+			}
+
+			if !readable[envPath] {
+				hidden++
+
+				continue
+			}
+
+			findings = append(findings, secretscan.Finding{
+				Key:     entry.Key,
+				Rule:    secretscan.RuleDuplicateValue,
+				Message: fmt.Sprintf("The same value is used by %s in %s", rotation.Key, envPath),
+			})
+		}
+
+		if hidden > 0 {
+			findings = append(findings, secretscan.Finding{
+				Key:     entry.Key,
+				Rule:    secretscan.RuleDuplicateValue,
+				Message: fmt.Sprintf("The same value is used in %d other env(s) that you cannot read", hidden),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// The caller already belongs to the org, so only their credential and the read rule of the env policy are left
+func canReadEnv(caller principal.Principal, orgId string, repoId string, env string) (bool, error) {
+	if getCredentialDenial(caller, orgId, repoId, env, EnvAccessRead) != "" {
+		return false, nil
+	}
+
+	policy, err := orgs.GetEnvPolicy(orgId, orgs.GetEnvPath(repoId, env))
+
+	if err != nil {
+		return false, err
+	}
+
+	return policy == nil || policy.Read.Allows(caller.Id, caller.Groups), nil
+}
+
+// Each org fingerprints with its own key, derived from the KMS HMAC key
+func getFingerprintKey(orgId string) ([]byte, error) {
+	fingerprintKeysMutex.Lock()
+	defer fingerprintKeysMutex.Unlock()
+
+	if key, ok := fingerprintKeys[orgId]; ok {
+		return key, nil
+	}
+
+	key, err := envelope.DeriveKey(fingerprintKeyId, "fingerprint#"+orgId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprintKeys[orgId] = key
+
+	return key, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/repos/{repoId}/share-links":
+		return ListShareLinks(req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/share-links":
+		return CreateShareLink(req), nil
+	case "DELETE /orgs/{orgId}/repos/{repoId}/share-links/{linkId}":
+		return RevokeShareLink(req), nil
+	case "GET /share/{token}":
+		return OpenShareLink(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/google/uuid"
+)
+
+// A share link cannot outlive a week
+const maxExpiresInMinutes = 7 * 24 * 60
+
+type CreateShareLinkRequest struct {
+	Env              string   `json:"env"`
+	Keys             []string `json:"keys"`
+	MaxUses          int      `json:"maxUses"`
+	ExpiresInMinutes int64    `json:"expiresInMinutes"`
+}
+
+// The link is only returned when it is created
+type ShareLinkResponse struct {
+	*orgs.ShareLink
+	Url string `json:"url"`
+}
+
+type OpenShareLinkResponse struct {
+	File     string `json:"file"`
+	OrgId    string `json:"orgId"`
+	RepoId   string `json:"repoId"`
+	Env      string `json:"env"`
+	ExpireAt string `json:"expireAt"`
+}
+
+var (
+	shareLinkUri = os.Getenv("ShareLinkUri")
+)
+
+func ListShareLinks(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		repoId = req.PathParameters["repoId"]
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	links, err := orgs.QueryShareLinks(orgId, repoId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the share links")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.ShareLink{"shareLinks": links})
+}
+
+func CreateShareLink(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		repoId      = req.PathParameters["repoId"]
+		callerId    = orchestrator.GetCallerId(req)
+		now         = time.Now()
+		requestData CreateShareLinkRequest
+	)
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Env == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.ExpiresInMinutes < 1 || requestData.ExpiresInMinutes > maxExpiresInMinutes {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "A share link must expire within a week")
+	}
+
+	if requestData.MaxUses < 0 {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The max uses cannot be negative")
+	}
+
+	// Nobody can share more than they can read themselves
+	if _, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, repoId, requestData.Env, orchestrator.EnvAccessRead); errResponse != nil {
+		return *errResponse
+	}
+
+	secret, err := orgs.GenerateShareLinkSecret()
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the share link")
+	}
+
+	link, err := orgs.InsertShareLink(orgs.ShareLink{
+		LinkId:        uuid.New().String(),
+		SecretHash:    orgs.HashShareLinkSecret(secret),
+		OrgId:         orgId,
+		EnvPath:       orgs.GetEnvPath(repoId, requestData.Env),
+		RepoId:        repoId,
+		Env:           requestData.Env,
+		Keys:          requestData.Keys,
+		MaxUses:       requestData.MaxUses,
+		ExpireAt:      strconv.FormatInt(now.Add(time.Duration(requestData.ExpiresInMinutes)*time.Minute).Unix(), 10),
+		CreatedAt:     strconv.FormatInt(now.Unix(), 10),
+		CreatedBy:     callerId,
+		CreatorGroups: orchestrator.GetCallerGroups(req),
+	})
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the share link")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "share-link.created", Resource: link.EnvPath, Outcome: audit.OutcomeAllowed, Reason: link.LinkId})
+
+	return restApi.ApiResponse(http.StatusCreated, ShareLinkResponse{
+		ShareLink: link,
+		Url:       fmt.Sprintf("%s/%s.%s", shareLinkUri, link.LinkId, secret),
+	})
+}
+
+// The creator of the link and the org admins can revoke it
+func RevokeShareLink(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		repoId   = req.PathParameters["repoId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	membership, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	link, err := orgs.GetShareLink(req.PathParameters["linkId"])
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the share link")
+	}
+
+	if link == nil || link.OrgId != orgId || link.RepoId != repoId {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Share link not found")
+	}
+
+	if link.CreatedBy != callerId && !membership.Role.Includes(orgs.RoleAdmin) {
+		return restApi.BuildErrorResponse(http.StatusForbidden, "Only the creator of the link or an admin can revoke it")
+	}
+
+	err = orgs.RevokeShareLink(link.LinkId, callerId, strconv.FormatInt(time.Now().Unix(), 10))
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "Share link is already revoked")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to revoke the share link")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "share-link.revoked", Resource: link.EnvPath, Outcome: audit.OutcomeAllowed, Reason: link.LinkId})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+// Public endpoint: the link itself is the credential, in the form {linkId}.{secret}
+func OpenShareLink(req restApi.Request) restApi.Response {
+	linkId, secret, found := strings.Cut(req.PathParameters["token"], ".")
+
+	if !found {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Share link not found")
+	}
+
+	link, err := orgs.GetShareLink(linkId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the share link")
+	}
+
+	if link == nil || subtle.ConstantTimeCompare([]byte(link.SecretHash), []byte(orgs.HashShareLinkSecret(secret))) != 1 {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Share link not found")
+	}
+
+	creator, err := orgs.GetMembership(link.OrgId, link.CreatedBy)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org membership")
+	}
+
+	policy, err := orgs.GetEnvPolicy(link.OrgId, link.EnvPath)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env policy")
+	}
+
+	actorId := fmt.Sprintf("share-link:%s", link.LinkId)
+
+	if reason := getUnusableReason(*link, creator, policy); reason != "" {
+		audit.Record(audit.Event{OrgId: link.OrgId, ActorId: actorId, Action: "share-link.used", Resource: link.EnvPath, Outcome: audit.OutcomeDenied, Reason: reason})
+
+		return restApi.BuildErrorResponse(http.StatusGone, reason)
+	}
+
+	err = orgs.ConsumeShareLink(link.LinkId)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusGone, "Share link is no longer usable")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to use the share link")
+	}
+
+	file, errResponse := orchestrator.DownloadEnvFile(link.OrgId, link.RepoId, link.Env)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if len(link.Keys) > 0 {
+		content, err := base64.StdEncoding.DecodeString(file)
+
+		if err != nil {
+			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to read the env file")
+		}
+
+		file = base64.StdEncoding.EncodeToString([]byte(dotenv.FilterKeys(string(content), link.Keys)))
+	}
+
+	audit.Record(audit.Event{OrgId: link.OrgId, ActorId: actorId, Action: "share-link.used", Resource: link.EnvPath, Outcome: audit.OutcomeAllowed})
+	publishLinkPulled(*link, actorId)
+
+	return restApi.ApiResponse(http.StatusOK, OpenShareLinkResponse{
+		File:     file,
+		OrgId:    link.OrgId,
+		RepoId:   link.RepoId,
+		Env:      link.Env,
+		ExpireAt: link.ExpireAt,
+	})
+}
+
+// Opening a link counts as a pull of the env by the link itself
+func publishLinkPulled(link orgs.ShareLink, actorId string) {
+	events.Publish(events.Event{Type: events.TypeEnvPulled, OrgId: link.OrgId, RepoId: link.RepoId, Env: link.Env, ActorId: actorId})
+}
+
+// A link stops working once revoked, expired or used up, and as soon as its creator could no longer read the env
+// themselves, such as after leaving the org or being left out of the env policy
+func getUnusableReason(link orgs.ShareLink, creator *orgs.Membership, policy *orgs.EnvPolicy) string {
+	expireAt, err := strconv.ParseInt(link.ExpireAt, 10, 64)
+
+	switch {
+	case link.RevokedAt != "":
+		return "Share link was revoked"
+	case err != nil || time.Now().Unix() > expireAt:
+		return "Share link has expired"
+	case link.MaxUses > 0 && link.UseCount >= link.MaxUses:
+		return "Share link has been used up"
+	case creator == nil || !creator.Role.Includes(orgs.RoleReader):
+		return "The creator of the share link left the org"
+	case policy != nil && !policy.Read.Allows(link.CreatedBy, link.CreatorGroups):
+		return "The creator of the share link can no longer read the env"
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/events"
+)
+
+func TestGetUnusableReason(t *testing.T) {
+	var (
+		expireAt = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		link     = orgs.ShareLink{CreatedBy: "user-1", CreatorGroups: []string{"devs"}, ExpireAt: expireAt}
+		reader   = &orgs.Membership{UserId: "user-1", Role: orgs.RoleReader}
+		withLink = func(change func(*orgs.ShareLink)) orgs.ShareLink {
+			link := link
+			change(&link)
+
+			return link
+		}
+	)
+
+	tests := []struct {
+		name    string
+		link    orgs.ShareLink
+		creator *orgs.Membership
+		policy  *orgs.EnvPolicy
+		want    bool
+	}{
+		{"usable", link, reader, nil, false},
+		{"creator allowed by the policy", link, reader, &orgs.EnvPolicy{Read: &orgs.AccessRule{Users: []string{"user-1"}}}, false},
+		{"creator group allowed by the policy", link, reader, &orgs.EnvPolicy{Read: &orgs.AccessRule{Groups: []string{"devs"}}}, false},
+		{"policy without a read rule", link, reader, &orgs.EnvPolicy{Write: &orgs.AccessRule{Users: []string{"user-2"}}}, false},
+		{"creator left out of the policy", link, reader, &orgs.EnvPolicy{Read: &orgs.AccessRule{Users: []string{"user-2"}}}, true},
+		{"creator left the org", link, nil, nil, true},
+		{"creator with an unknown role", link, &orgs.Membership{UserId: "user-1", Role: "guest"}, nil, true},
+		{"revoked", withLink(func(l *orgs.ShareLink) { l.RevokedAt = "1" }), reader, nil, true},
+		{"expired", withLink(func(l *orgs.ShareLink) { l.ExpireAt = "1" }), reader, nil, true},
+		{"used up", withLink(func(l *orgs.ShareLink) { l.MaxUses, l.UseCount = 1, 1 }), reader, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if reason := getUnusableReason(test.link, test.creator, test.policy); (reason != "") != test.want {
+				t.Errorf("getUnusableReason() = %q, want unusable %v", reason, test.want)
+			}
+		})
+	}
+}
+
+func TestPublishLinkPulled(t *testing.T) {
+	sink := events.NewMemorySink()
+	events.SetPublisher(sink)
+	t.Cleanup(func() { events.SetPublisher(nil) })
+
+	publishLinkPulled(orgs.ShareLink{LinkId: "link-1", OrgId: "acme", RepoId: "api", Env: "prod", CreatedBy: "user-1"}, "share-link:link-1")
+
+	got := sink.Events()
+	want := events.Event{Type: events.TypeEnvPulled, OrgId: "acme", RepoId: "api", Env: "prod", ActorId: "share-link:link-1"}
+
+	if len(got) != 1 || got[0].OccurredAt == "" {
+		t.Fatalf("publishLinkPulled() published %+v, want one event with a time", got)
+	}
+
+	if got[0].OccurredAt = ""; got[0] != want {
+		t.Errorf("publishLinkPulled() published %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,198 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	"github.com/PBH-Tech/moonenv/lambdas/util/ratelimit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretscan"
+	"github.com/google/uuid"
+)
+
+// A new version of an env, once the caller was allowed to write it
+type EnvWrite struct {
+	Org    orgs.Org
+	RepoId string
+	Env    string
+	B64Str string
+	// Who sent the request, and who wrote the content; they only differ when a change request is approved
+	Caller principal.Principal
+	Author string
+	// Set when the write applies an approved change request, which skips the env protection but is refused
+	// when the env moved on from the version the request was opened against
+	ChangeRequest *orgs.ChangeRequest
+	// Saved as user metadata of the new version
+	Metadata map[string]string
+}
+
+type StoredEnv struct {
+	VersionId string
+	// Set instead of the version when the env is protected and the write waits for approval
+	ChangeRequest *orgs.ChangeRequest
+	Findings      []secretscan.Finding
+	Quota         ratelimit.Result
+}
+
+// Uploads the new version of the env, or keeps it for approval when the env is protected.
+// Secrets found in the content are returned as findings, or block the write when the org asks for it.
+// The push quota is only taken once every check let the write through
+func StoreEnvFile(ctx context.Context, write EnvWrite) (*StoredEnv, *restApi.Response) {
+	envPath := orgs.GetEnvPath(write.RepoId, write.Env)
+
+	if _, errResponse := ResolveRepoForPush(write.Org, write.RepoId, write.Author); errResponse != nil {
+		return nil, errResponse
+	}
+
+	if errResponse := CheckEnvLock(write.Org.OrgId, write.Caller.Id, write.RepoId, write.Env); errResponse != nil {
+		return nil, errResponse
+	}
+
+	content, err := base64.StdEncoding.DecodeString(write.B64Str)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid base64 string")
+
+		return nil, &response
+	}
+
+	previous, errResponse := DownloadEnvFileIfChanged(write.Org.OrgId, write.RepoId, write.Env, "")
+
+	if errResponse != nil && errResponse.StatusCode != http.StatusNotFound {
+		return nil, errResponse
+	}
+
+	storageChange := orgs.OrgUsage{StoredBytes: int64(len(content))}
+
+	if previous == nil {
+		previous = &bucketService.DownloadFileResult{}
+		storageChange.EnvCount = 1
+	} else {
+		previousContent, _ := base64.StdEncoding.DecodeString(previous.File)
+		storageChange.StoredBytes -= int64(len(previousContent))
+	}
+
+	if errResponse := CheckStorageQuota(ctx, write.Org, storageChange); errResponse != nil {
+		return nil, errResponse
+	}
+
+	findings, errResponse := ScanEnvFile(write.Org, write.Caller, write.RepoId, string(content))
+
+	if errResponse != nil {
+		return nil, errResponse
+	}
+
+	if len(findings) > 0 && write.Org.Settings.SecretScan.Action == orgs.ScanActionBlock {
+		audit.Record(audit.Event{OrgId: write.Org.OrgId, ActorId: write.Caller.Id, Action: "env.write", Resource: envPath, Outcome: audit.OutcomeDenied, Reason: "Blocked by the secret scan"})
+
+		response := restApi.ApiResponse(http.StatusUnprocessableEntity, map[string]interface{}{
+			"message":  "The push was blocked because it looks like it holds secrets that should not be there",
+			"findings": findings,
+		})
+
+		return nil, &response
+	}
+
+	protected := false
+
+	if write.ChangeRequest == nil {
+		policy, err := orgs.GetEnvPolicy(write.Org.OrgId, envPath)
+
+		if err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env policy")
+
+			return nil, &response
+		}
+
+		protected = policy != nil && policy.Protected
+	} else if previous.VersionId != write.ChangeRequest.BaseVersionId {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "The env changed since the change request was opened, so it has to be pushed again")
+
+		return nil, &response
+	}
+
+	quotaResult, errResponse := TakePushQuota(write.Org)
+
+	if errResponse != nil {
+		return nil, errResponse
+	}
+
+	if protected {
+		changeRequest, errResponse := requestChange(write, previous, string(content))
+
+		if errResponse != nil {
+			return nil, errResponse
+		}
+
+		return &StoredEnv{ChangeRequest: changeRequest, Findings: findings, Quota: quotaResult}, nil
+	}
+
+	if errResponse := ReserveStorage(write.Org, storageChange); errResponse != nil {
+		return nil, errResponse
+	}
+
+	versionId, errResponse := UploadEnvFile(write.Org.OrgId, write.RepoId, write.Env, write.B64Str, write.Metadata)
+
+	if errResponse != nil {
+		ReleaseStorage(write.Org, storageChange)
+
+		return nil, errResponse
+	}
+
+	TrackKeyChanges(write.Org.OrgId, write.RepoId, write.Env, *previous, write.B64Str, write.Author, versionId)
+	PublishEnvEvent(orgs.EnvEvent{
+		Type:      orgs.EnvEventPush,
+		OrgId:     write.Org.OrgId,
+		RepoId:    write.RepoId,
+		Env:       write.Env,
+		VersionId: versionId,
+		Author:    write.Author,
+	})
+	SyncEnv(orgs.SyncRequest{OrgId: write.Org.OrgId, RepoId: write.RepoId, Env: write.Env, VersionId: versionId})
+
+	return &StoredEnv{VersionId: versionId, Findings: findings, Quota: quotaResult}, nil
+}
+
+// Keeps the write of a protected env as a change request, with the keys it changes and the version it was
+// based on, until someone approves it
+func requestChange(write EnvWrite, current *bucketService.DownloadFileResult, proposed string) (*orgs.ChangeRequest, *restApi.Response) {
+	currentContent, err := base64.StdEncoding.DecodeString(current.File)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to read the current env file")
+
+		return nil, &response
+	}
+
+	changeRequest, err := orgs.InsertChangeRequest(orgs.ChangeRequest{
+		OrgId:           write.Org.OrgId,
+		ChangeRequestId: uuid.New().String(),
+		RepoId:          write.RepoId,
+		Env:             write.Env,
+		EnvPath:         orgs.GetEnvPath(write.RepoId, write.Env),
+		Content:         write.B64Str,
+		Diff:            dotenv.Diff(string(currentContent), proposed),
+		BaseVersionId:   current.VersionId,
+		Status:          orgs.ChangeRequestStatusPending,
+		RequestedBy:     write.Author,
+		RequestedAt:     strconv.FormatInt(time.Now().Unix(), 10),
+	})
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the change request")
+
+		return nil, &response
+	}
+
+	audit.Record(audit.Event{OrgId: write.Org.OrgId, ActorId: write.Caller.Id, Action: "change-request.created", Resource: changeRequest.EnvPath, Outcome: audit.OutcomeAllowed, Reason: changeRequest.ChangeRequestId})
+
+	return changeRequest, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+func ListAuditEvents(req restApi.Request) restApi.Response {
+	var (
+		orgId = req.PathParameters["orgId"]
+		limit = int64(defaultLimit)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if limitStr, ok := req.QueryStringParameters["limit"]; ok {
+		parsedLimit, err := strconv.ParseInt(limitStr, 10, 64)
+
+		if err != nil || parsedLimit < 1 || parsedLimit > maxLimit {
+			return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid limit")
+		}
+
+		limit = parsedLimit
+	}
+
+	events, err := audit.QueryEvents(orgId, limit)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the audit log")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*audit.Event{"events": events})
+}
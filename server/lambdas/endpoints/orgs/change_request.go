@@ -0,0 +1,189 @@
+package orgs
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type ChangeRequestStatus string
+
+const (
+	ChangeRequestStatusPending  ChangeRequestStatus = "pending"
+	ChangeRequestStatusApproved ChangeRequestStatus = "approved"
+	ChangeRequestStatusRejected ChangeRequestStatus = "rejected"
+)
+
+// A push to a protected env waiting for review. The proposed content is kept out of the JSON of the
+// request, so listing them does not leak secrets; the diff only names the keys
+type ChangeRequest struct {
+	OrgId           string         `json:"orgId"`
+	ChangeRequestId string         `json:"changeRequestId"`
+	RepoId          string         `json:"repoId"`
+	Env             string         `json:"env"`
+	EnvPath         string         `json:"envPath"`
+	Content         string         `json:"-"`
+	Diff            dotenv.Changes `json:"diff"`
+	// The version of the env the request was opened against; empty when the env did not exist yet
+	BaseVersionId string              `json:"baseVersionId,omitempty"`
+	Status        ChangeRequestStatus `json:"status"`
+	RequestedBy   string              `json:"requestedBy"`
+	RequestedAt   string              `json:"requestedAt"`
+	ReviewedBy    string              `json:"reviewedBy,omitempty"`
+	ReviewedAt    string              `json:"reviewedAt,omitempty"`
+	Comment       string              `json:"comment,omitempty"`
+}
+
+var (
+	changeRequestTableName = aws.String(os.Getenv("ChangeRequestTableName"))
+)
+
+func InsertChangeRequest(changeRequest ChangeRequest) (*ChangeRequest, error) {
+	item, err := dynamodbattribute.MarshalMap(changeRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item["content"] = &dynamodbService.AttributeValue{S: aws.String(changeRequest.Content)}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: changeRequestTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &changeRequest, nil
+}
+
+func GetChangeRequest(orgId string, changeRequestId string) (*ChangeRequest, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       changeRequestKey(orgId, changeRequestId),
+		TableName: changeRequestTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	return unmarshalChangeRequest(result.Item)
+}
+
+func QueryChangeRequests(orgId string) ([]*ChangeRequest, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var changeRequests []*ChangeRequest
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: changeRequestTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		for _, item := range page.Items {
+			if changeRequest, err := unmarshalChangeRequest(item); err == nil {
+				changeRequests = append(changeRequests, changeRequest)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return changeRequests, nil
+}
+
+// Moves a pending request to its review outcome, failing if someone else reviewed it first
+func ReviewChangeRequest(changeRequest ChangeRequest, status ChangeRequestStatus, reviewedBy string, reviewedAt string, comment string) error {
+	return updateChangeRequestStatus(changeRequest, ChangeRequestStatusPending, &dynamodbService.UpdateItemInput{
+		UpdateExpression: aws.String("SET #status = :status, reviewedBy = :reviewedBy, reviewedAt = :reviewedAt, #comment = :comment"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status":  aws.String("status"),
+			"#comment": aws.String("comment"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":status":     {S: aws.String(string(status))},
+			":reviewedBy": {S: aws.String(reviewedBy)},
+			":reviewedAt": {S: aws.String(reviewedAt)},
+			":comment":    {S: aws.String(comment)},
+		},
+	})
+}
+
+// Puts an approved request back to pending when its change could not be applied
+func ReopenChangeRequest(changeRequest ChangeRequest) error {
+	return updateChangeRequestStatus(changeRequest, ChangeRequestStatusApproved, &dynamodbService.UpdateItemInput{
+		UpdateExpression:         aws.String("SET #status = :status REMOVE reviewedBy, reviewedAt, #comment"),
+		ExpressionAttributeNames: map[string]*string{"#status": aws.String("status"), "#comment": aws.String("comment")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":status": {S: aws.String(string(ChangeRequestStatusPending))},
+		},
+	})
+}
+
+func updateChangeRequestStatus(changeRequest ChangeRequest, currentStatus ChangeRequestStatus, input *dynamodbService.UpdateItemInput) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	input.Key = changeRequestKey(changeRequest.OrgId, changeRequest.ChangeRequestId)
+	input.TableName = changeRequestTableName
+	input.ConditionExpression = aws.String("#status = :currentStatus")
+	input.ExpressionAttributeValues[":currentStatus"] = &dynamodbService.AttributeValue{S: aws.String(string(currentStatus))}
+
+	_, err = client.UpdateItem(input)
+
+	return err
+}
+
+func unmarshalChangeRequest(item map[string]*dynamodbService.AttributeValue) (*ChangeRequest, error) {
+	changeRequest := new(ChangeRequest)
+
+	if err := dynamodbattribute.UnmarshalMap(item, changeRequest); err != nil {
+		return nil, err
+	}
+
+	if content, ok := item["content"]; ok && content.S != nil {
+		changeRequest.Content = *content.S
+	}
+
+	return changeRequest, nil
+}
+
+func changeRequestKey(orgId string, changeRequestId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":           {S: aws.String(orgId)},
+		"changeRequestId": {S: aws.String(changeRequestId)},
+	}
+}
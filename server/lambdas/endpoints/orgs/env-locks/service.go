@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type LockEnvRequest struct {
+	Env    string `json:"env"`
+	Reason string `json:"reason"`
+	// Leaving it out keeps the env locked until someone unlocks it
+	ExpiresInMinutes int64 `json:"expiresInMinutes"`
+}
+
+// Returns the locks that still hold in the repo
+func ListEnvLocks(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		repoId = req.PathParameters["repoId"]
+		now    = time.Now().Unix()
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	locks, err := orgs.QueryEnvLocks(orgId, repoId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env locks")
+	}
+
+	locks = slices.DeleteFunc(locks, func(lock *orgs.EnvLock) bool {
+		return !lock.IsActive(now)
+	})
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.EnvLock{"locks": locks})
+}
+
+// Freezes the env, so pushes, approvals and repo renames or deletes are refused until it is unlocked or the lock expires
+func LockEnv(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		repoId      = req.PathParameters["repoId"]
+		callerId    = orchestrator.GetCallerId(req)
+		now         = time.Now().Unix()
+		requestData LockEnvRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleWriter); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Env == "" || requestData.Reason == "" || requestData.ExpiresInMinutes < 0 {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if _, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, repoId, requestData.Env, orchestrator.EnvAccessWrite); errResponse != nil {
+		return *errResponse
+	}
+
+	envPath := orgs.GetEnvPath(repoId, requestData.Env)
+	existingLock, err := orgs.GetEnvLock(orgId, envPath)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env lock")
+	}
+
+	if existingLock != nil && existingLock.IsActive(now) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The env is already locked")
+	}
+
+	lock := orgs.EnvLock{
+		OrgId:    orgId,
+		EnvPath:  envPath,
+		RepoId:   repoId,
+		Env:      requestData.Env,
+		Reason:   requestData.Reason,
+		LockedBy: callerId,
+		LockedAt: strconv.FormatInt(now, 10),
+	}
+
+	if requestData.ExpiresInMinutes > 0 {
+		lock.ExpireAt = strconv.FormatInt(now+requestData.ExpiresInMinutes*60, 10)
+	}
+
+	if _, err := orgs.InsertEnvLock(lock); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to lock the env")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.locked", Resource: envPath, Outcome: audit.OutcomeAllowed, Reason: lock.Reason})
+
+	return restApi.ApiResponse(http.StatusCreated, lock)
+}
+
+// Only whoever locked the env, or a member with the override role, can unlock it
+func UnlockEnv(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		repoId   = req.PathParameters["repoId"]
+		env      = req.PathParameters["env"]
+		envPath  = orgs.GetEnvPath(repoId, env)
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	membership, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleWriter)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	org, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, repoId, env, orchestrator.EnvAccessWrite)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	lock, err := orgs.GetEnvLock(orgId, envPath)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env lock")
+	}
+
+	if lock == nil || !lock.IsActive(time.Now().Unix()) {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "The env is not locked")
+	}
+
+	if lock.LockedBy != callerId && !membership.Role.Includes(org.Settings.GetLockOverrideRole()) {
+		audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.unlocked", Resource: envPath, Outcome: audit.OutcomeDenied, Reason: "Caller neither locked the env nor holds the override role"})
+
+		return restApi.BuildErrorResponse(http.StatusForbidden, "Only whoever locked the env or a member with the override role can unlock it")
+	}
+
+	if err := orgs.DeleteEnvLock(orgId, envPath); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to unlock the env")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.unlocked", Resource: envPath, Outcome: audit.OutcomeAllowed, Reason: lock.Reason})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
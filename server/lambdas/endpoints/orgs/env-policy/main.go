@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		return GetPolicy(req), nil
+	case http.MethodPut:
+		return SavePolicy(req), nil
+	case http.MethodDelete:
+		return RemovePolicy(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type SavePolicyRequest struct {
+	Read      *orgs.AccessRule `json:"read"`
+	Write     *orgs.AccessRule `json:"write"`
+	Protected bool             `json:"protected"`
+}
+
+func GetPolicy(req restApi.Request) restApi.Response {
+	orgId, envPath := getEnvPath(req)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	policy, err := orgs.GetEnvPolicy(orgId, envPath)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env policy")
+	}
+
+	if policy == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "This env has no policy")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, policy)
+}
+
+func SavePolicy(req restApi.Request) restApi.Response {
+	var (
+		orgId, envPath = getEnvPath(req)
+		callerId       = orchestrator.GetCallerId(req)
+		requestData    SavePolicyRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if !orgs.IsValidName(req.PathParameters["repoId"]) || !orgs.IsValidName(req.QueryStringParameters["env"]) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Repository and env names cannot be empty or contain \"/\" or \"..\"")
+	}
+
+	policy, err := orgs.InsertEnvPolicy(orgs.EnvPolicy{
+		OrgId:     orgId,
+		EnvPath:   envPath,
+		Read:      requestData.Read,
+		Write:     requestData.Write,
+		Protected: requestData.Protected,
+		UpdatedAt: strconv.FormatInt(time.Now().Unix(), 10),
+		UpdatedBy: callerId,
+	})
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the env policy")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.policy.saved", Resource: envPath, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusOK, policy)
+}
+
+func RemovePolicy(req restApi.Request) restApi.Response {
+	var (
+		orgId, envPath = getEnvPath(req)
+		callerId       = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := orgs.DeleteEnvPolicy(orgId, envPath); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to remove the env policy")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "env.policy.removed", Resource: envPath, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+func getEnvPath(req restApi.Request) (string, string) {
+	return req.PathParameters["orgId"], orgs.GetEnvPath(req.PathParameters["repoId"], req.QueryStringParameters["env"])
+}
@@ -0,0 +1,158 @@
+package orgs
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Freezes an env, such as during a release or an incident, so only members with the override role can change it
+type EnvLock struct {
+	OrgId    string `json:"orgId"`
+	EnvPath  string `json:"envPath"`
+	RepoId   string `json:"repoId"`
+	Env      string `json:"env"`
+	Reason   string `json:"reason"`
+	LockedBy string `json:"lockedBy"`
+	LockedAt string `json:"lockedAt"`
+	// Empty means the lock holds until someone unlocks the env
+	ExpireAt string `json:"expireAt,omitempty"`
+}
+
+var (
+	envLockTableName = aws.String(os.Getenv("EnvLockTableName"))
+)
+
+func (lock EnvLock) IsActive(now int64) bool {
+	if lock.ExpireAt == "" {
+		return true
+	}
+
+	expireAt, err := strconv.ParseInt(lock.ExpireAt, 10, 64)
+
+	return err != nil || now < expireAt
+}
+
+// Members whose role includes this one can change locked envs; owners when the org did not choose
+func (settings OrgSettings) GetLockOverrideRole() Role {
+	if settings.LockOverrideRole.IsValid() {
+		return settings.LockOverrideRole
+	}
+
+	return RoleOwner
+}
+
+func InsertEnvLock(lock EnvLock) (*EnvLock, error) {
+	item, err := dynamodbattribute.MarshalMap(lock)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: envLockTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &lock, nil
+}
+
+func GetEnvLock(orgId string, envPath string) (*EnvLock, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       envLockKey(orgId, envPath),
+		TableName: envLockTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	lock := new(EnvLock)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, lock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Returns the locks of every env in the repo, including expired ones
+func QueryEnvLocks(orgId string, repoId string) ([]*EnvLock, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []*EnvLock
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: envLockTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+			"envPath": {
+				ComparisonOperator: aws.String("BEGINS_WITH"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(GetEnvPath(repoId, ""))}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*EnvLock
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			locks = append(locks, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+func DeleteEnvLock(orgId string, envPath string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       envLockKey(orgId, envPath),
+		TableName: envLockTableName,
+	})
+
+	return err
+}
+
+func envLockKey(orgId string, envPath string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":   {S: aws.String(orgId)},
+		"envPath": {S: aws.String(envPath)},
+	}
+}
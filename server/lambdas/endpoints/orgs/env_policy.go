@@ -0,0 +1,173 @@
+package orgs
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// A rule without users and groups allows nobody
+type AccessRule struct {
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"`
+}
+
+// Restricts an env on top of the org membership; a nil rule leaves that access to the org roles
+type EnvPolicy struct {
+	OrgId   string      `json:"orgId"`
+	EnvPath string      `json:"envPath"`
+	Read    *AccessRule `json:"read,omitempty"`
+	Write   *AccessRule `json:"write,omitempty"`
+	// Pushes to a protected env become change requests that another member has to approve
+	Protected bool   `json:"protected"`
+	UpdatedAt string `json:"updatedAt"`
+	UpdatedBy string `json:"updatedBy"`
+}
+
+var (
+	envPolicyTableName = aws.String(os.Getenv("EnvPolicyTableName"))
+)
+
+func (rule *AccessRule) Allows(userId string, groups []string) bool {
+	if rule == nil {
+		return true
+	}
+
+	if slices.Contains(rule.Users, userId) {
+		return true
+	}
+
+	for _, group := range groups {
+		if slices.Contains(rule.Groups, group) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Repo ids and env names are segments of S3 keys and of token scopes, so they cannot hold a "/" or ".."
+func IsValidName(name string) bool {
+	return name != "" && !strings.Contains(name, "/") && !strings.Contains(name, "..")
+}
+
+func GetEnvPath(repoId string, env string) string {
+	return fmt.Sprintf("%s/%s", repoId, env)
+}
+
+func InsertEnvPolicy(policy EnvPolicy) (*EnvPolicy, error) {
+	item, err := dynamodbattribute.MarshalMap(policy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: envPolicyTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func GetEnvPolicy(orgId string, envPath string) (*EnvPolicy, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       envPolicyKey(orgId, envPath),
+		TableName: envPolicyTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	policy := new(EnvPolicy)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Returns the policies of every env in the repo
+func QueryEnvPolicies(orgId string, repoId string) ([]*EnvPolicy, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []*EnvPolicy
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: envPolicyTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+			"envPath": {
+				ComparisonOperator: aws.String("BEGINS_WITH"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(GetEnvPath(repoId, ""))}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*EnvPolicy
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			policies = append(policies, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func DeleteEnvPolicy(orgId string, envPath string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       envPolicyKey(orgId, envPath),
+		TableName: envPolicyTableName,
+	})
+
+	return err
+}
+
+func envPolicyKey(orgId string, envPath string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":   {S: aws.String(orgId)},
+		"envPath": {S: aws.String(envPath)},
+	}
+}
@@ -0,0 +1,31 @@
+package orgs
+
+import "testing"
+
+func TestAccessRuleAllows(t *testing.T) {
+	rule := &AccessRule{Users: []string{"user-1"}, Groups: []string{"admins"}}
+
+	tests := []struct {
+		name   string
+		rule   *AccessRule
+		userId string
+		groups []string
+		want   bool
+	}{
+		{"no rule leaves it to the org roles", nil, "user-2", nil, true},
+		{"listed user", rule, "user-1", nil, true},
+		{"listed group", rule, "user-2", []string{"devs", "admins"}, true},
+		{"neither user nor group", rule, "user-2", []string{"devs"}, false},
+		{"no groups", rule, "user-2", nil, false},
+		{"empty rule allows nobody", &AccessRule{}, "user-1", []string{"admins"}, false},
+		{"user id is not a group", &AccessRule{Groups: []string{"user-1"}}, "user-1", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rule.Allows(test.userId, test.groups); got != test.want {
+				t.Errorf("Allows(%q, %v) = %v, want %v", test.userId, test.groups, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package orgs
+
+import (
+	"os"
+	"path"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Keys matching the pattern must get a new value at least every MaxAgeDays
+type RotationPolicy struct {
+	// A glob on the key name such as "DB_PASSWORD" or "*_SECRET"
+	KeyPattern string `json:"keyPattern"`
+	MaxAgeDays int    `json:"maxAgeDays"`
+}
+
+// When the value of one key of an env last changed
+type KeyRotation struct {
+	OrgId string `json:"orgId"`
+	// repoId/env/key, so the keys of a repo or an env can be queried together
+	KeyPath       string `json:"keyPath"`
+	RepoId        string `json:"repoId"`
+	Env           string `json:"env"`
+	Key           string `json:"key"`
+	LastChangedAt string `json:"lastChangedAt"`
+	LastChangedBy string `json:"lastChangedBy"`
+	VersionId     string `json:"versionId,omitempty"`
+	// Finds the same value in other envs of the org; left out for short values
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+var (
+	keyRotationTableName            = aws.String(os.Getenv("KeyRotationTableName"))
+	keyRotationFingerprintIndexName = aws.String(os.Getenv("KeyRotationFingerprintIndexName"))
+)
+
+// Returns the strictest max age of the policies matching the key
+func (settings OrgSettings) GetMaxAgeDays(key string) (int, bool) {
+	maxAgeDays := 0
+
+	for _, policy := range settings.RotationPolicies {
+		if matched, err := path.Match(policy.KeyPattern, key); err != nil || !matched {
+			continue
+		}
+
+		if maxAgeDays == 0 || policy.MaxAgeDays < maxAgeDays {
+			maxAgeDays = policy.MaxAgeDays
+		}
+	}
+
+	return maxAgeDays, maxAgeDays > 0
+}
+
+func GetKeyPath(repoId string, env string, key string) string {
+	return GetEnvPath(repoId, env) + "/" + key
+}
+
+func InsertKeyRotation(rotation KeyRotation) error {
+	item, err := dynamodbattribute.MarshalMap(rotation)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: keyRotationTableName,
+	})
+
+	return err
+}
+
+// Returns the keys whose path starts with the prefix, such as "repoId/" or "repoId/env/"
+func QueryKeyRotations(orgId string, keyPathPrefix string) ([]*KeyRotation, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rotations []*KeyRotation
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: keyRotationTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+			"keyPath": {
+				ComparisonOperator: aws.String("BEGINS_WITH"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(keyPathPrefix)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*KeyRotation
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			rotations = append(rotations, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rotations, nil
+}
+
+// Returns the keys of the org that hold the value with this fingerprint
+func QueryKeyRotationsByFingerprint(fingerprint string) ([]*KeyRotation, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Query(&dynamodbService.QueryInput{
+		TableName: keyRotationTableName,
+		IndexName: keyRotationFingerprintIndexName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"fingerprint": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(fingerprint)}},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rotations []*KeyRotation
+
+	if err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &rotations); err != nil {
+		return nil, err
+	}
+
+	return rotations, nil
+}
+
+func DeleteKeyRotation(orgId string, keyPath string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key: map[string]*dynamodbService.AttributeValue{
+			"orgId":   {S: aws.String(orgId)},
+			"keyPath": {S: aws.String(keyPath)},
+		},
+		TableName: keyRotationTableName,
+	})
+
+	return err
+}
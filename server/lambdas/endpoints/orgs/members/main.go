@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		return ListMembers(req), nil
+	case http.MethodPut:
+		return SaveMember(req), nil
+	case http.MethodDelete:
+		return RemoveMember(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
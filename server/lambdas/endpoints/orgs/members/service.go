@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type SaveMemberRequest struct {
+	Role orgs.Role `json:"role"`
+}
+
+func ListMembers(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	memberships, err := orgs.QueryMemberships(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org members")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.Membership{"members": memberships})
+}
+
+func SaveMember(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		userId      = req.PathParameters["userId"]
+		requestData SaveMemberRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || !requestData.Role.IsValid() {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.Role == orgs.RoleOwner {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The owner role can only be transferred")
+	}
+
+	if errResponse := ensureIsNotOwner(orgId, userId); errResponse != nil {
+		return *errResponse
+	}
+
+	membership, err := orgs.InsertMembership(orgs.Membership{
+		OrgId:     orgId,
+		UserId:    userId,
+		Role:      requestData.Role,
+		CreatedAt: strconv.FormatInt(time.Now().Unix(), 10),
+	})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusForbidden, "The org owner cannot be changed")
+	}
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the org member")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, membership)
+}
+
+func RemoveMember(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		userId = req.PathParameters["userId"]
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := ensureIsNotOwner(orgId, userId); errResponse != nil {
+		return *errResponse
+	}
+
+	err := orgs.DeleteMembership(orgId, userId)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The org owner cannot be removed")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to remove the org member")
+	}
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+func ensureIsNotOwner(orgId string, userId string) *restApi.Response {
+	membership, err := orgs.GetMembership(orgId, userId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org membership")
+
+		return &response
+	}
+
+	if membership != nil && membership.Role == orgs.RoleOwner {
+		response := restApi.BuildErrorResponse(http.StatusForbidden, "The org owner cannot be changed")
+
+		return &response
+	}
+
+	return nil
+}
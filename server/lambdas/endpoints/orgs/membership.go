@@ -0,0 +1,185 @@
+package orgs
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleWriter Role = "writer"
+	RoleAdmin  Role = "admin"
+	RoleOwner  Role = "owner"
+)
+
+// Each role grants everything the roles ranked below it grant
+var roleRank = map[Role]int{
+	RoleReader: 1,
+	RoleWriter: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func (role Role) IsValid() bool {
+	_, ok := roleRank[role]
+
+	return ok
+}
+
+func (role Role) Includes(required Role) bool {
+	return role.IsValid() && roleRank[role] >= roleRank[required]
+}
+
+type Membership struct {
+	OrgId     string `json:"orgId"`
+	UserId    string `json:"userId"`
+	Role      Role   `json:"role"`
+	CreatedAt string `json:"createdAt"`
+}
+
+var (
+	orgMemberTableName     = aws.String(os.Getenv("OrgMemberTableName"))
+	orgMemberUserIndexName = aws.String(os.Getenv("OrgMemberUserIndexName"))
+)
+
+// Saves the membership, refusing to overwrite the owner's one so the owner role only moves through TransferOwnership
+func InsertMembership(membership Membership) (*Membership, error) {
+	item, err := dynamodbattribute.MarshalMap(membership)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:                     item,
+		TableName:                orgMemberTableName,
+		ConditionExpression:      aws.String("attribute_not_exists(userId) OR #role <> :owner"),
+		ExpressionAttributeNames: map[string]*string{"#role": aws.String("role")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":owner": {S: aws.String(string(RoleOwner))},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func GetMembership(orgId string, userId string) (*Membership, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       membershipKey(orgId, userId),
+		TableName: orgMemberTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	membership := new(Membership)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, membership); err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+func QueryMemberships(orgId string) ([]*Membership, error) {
+	return queryMemberships(&dynamodbService.QueryInput{
+		TableName: orgMemberTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	})
+}
+
+// Returns every membership of the user, across all orgs
+func QueryMembershipsByUser(userId string) ([]*Membership, error) {
+	return queryMemberships(&dynamodbService.QueryInput{
+		TableName: orgMemberTableName,
+		IndexName: orgMemberUserIndexName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"userId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(userId)}},
+			},
+		},
+	})
+}
+
+func queryMemberships(input *dynamodbService.QueryInput) ([]*Membership, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var memberships []*Membership
+
+	err = client.QueryPages(input, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*Membership
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			memberships = append(memberships, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// Removes the membership, refusing to remove the owner's one even if the owner changed since it was checked
+func DeleteMembership(orgId string, userId string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:                      membershipKey(orgId, userId),
+		TableName:                orgMemberTableName,
+		ConditionExpression:      aws.String("attribute_not_exists(userId) OR #role <> :owner"),
+		ExpressionAttributeNames: map[string]*string{"#role": aws.String("role")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":owner": {S: aws.String(string(RoleOwner))},
+		},
+	})
+
+	return err
+}
+
+func membershipKey(orgId string, userId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":  {S: aws.String(orgId)},
+		"userId": {S: aws.String(userId)},
+	}
+}
@@ -0,0 +1,31 @@
+package orgs
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleWriter, false},
+		{RoleWriter, RoleReader, true},
+		{RoleWriter, RoleWriter, true},
+		{RoleWriter, RoleAdmin, false},
+		{RoleAdmin, RoleWriter, true},
+		{RoleAdmin, RoleOwner, false},
+		{RoleOwner, RoleReader, true},
+		{RoleOwner, RoleOwner, true},
+		{Role(""), RoleReader, false},
+		{Role("superuser"), RoleReader, false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.role)+" includes "+string(test.required), func(t *testing.T) {
+			if got := test.role.Includes(test.required); got != test.want {
+				t.Errorf("Role(%q).Includes(%q) = %v, want %v", test.role, test.required, got, test.want)
+			}
+		})
+	}
+}
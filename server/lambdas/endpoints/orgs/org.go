@@ -0,0 +1,257 @@
+package orgs
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type ScanAction string
+
+const (
+	ScanActionWarn  ScanAction = "warn"
+	ScanActionBlock ScanAction = "block"
+	ScanActionOff   ScanAction = "off"
+)
+
+// What pushes are checked for; findings are only warnings unless the action is block
+type SecretScanSettings struct {
+	Action ScanAction `json:"action,omitempty"`
+	// Globs on key names whose values should never look like a secret, such as "PUBLIC_*"
+	NonSensitiveKeys []string `json:"nonSensitiveKeys,omitempty"`
+}
+
+type OrgSettings struct {
+	// When set, only these env names can be pulled or pushed
+	AllowedEnvs []string `json:"allowedEnvs,omitempty"`
+	// Pushing to an unknown repo registers it instead of failing
+	AutoCreateRepos bool `json:"autoCreateRepos"`
+	// How often the matching keys have to be rotated; the strictest matching policy applies
+	RotationPolicies []RotationPolicy   `json:"rotationPolicies,omitempty"`
+	SecretScan       SecretScanSettings `json:"secretScan"`
+	// The least role that can still change locked envs; defaults to owner
+	LockOverrideRole Role `json:"lockOverrideRole,omitempty"`
+}
+
+type Org struct {
+	OrgId       string      `json:"orgId"`
+	DisplayName string      `json:"displayName"`
+	OwnerId     string      `json:"ownerId"`
+	Settings    OrgSettings `json:"settings"`
+	Quota       OrgQuota    `json:"quota"`
+	// Missing on orgs created before storage was counted, until their first push counts it
+	Usage     *OrgUsage `json:"usage,omitempty"`
+	CreatedAt string    `json:"createdAt"`
+	UpdatedAt string    `json:"updatedAt"`
+}
+
+var (
+	orgTableName = aws.String(os.Getenv("OrgTableName"))
+)
+
+// Creates the org and its owner membership, failing if the org id is taken
+func InsertOrg(org Org, ownerMembership Membership) (*Org, error) {
+	orgItem, err := dynamodbattribute.MarshalMap(org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	membershipItem, err := dynamodbattribute.MarshalMap(ownerMembership)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{
+		TransactItems: []*dynamodbService.TransactWriteItem{
+			{
+				Put: &dynamodbService.Put{
+					Item:                orgItem,
+					TableName:           orgTableName,
+					ConditionExpression: aws.String("attribute_not_exists(orgId)"),
+				},
+			},
+			{
+				Put: &dynamodbService.Put{
+					Item:      membershipItem,
+					TableName: orgMemberTableName,
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+func GetOrg(orgId string) (*Org, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       orgKey(orgId),
+		TableName: orgTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	org := new(Org)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, org); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func GetOrgs(orgIds []string) ([]*Org, error) {
+	var orgs []*Org
+
+	if len(orgIds) == 0 {
+		return orgs, nil
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// BatchGetItem accepts up to 100 keys per call
+	for start := 0; start < len(orgIds); start += 100 {
+		var keys []map[string]*dynamodbService.AttributeValue
+
+		for _, orgId := range orgIds[start:min(start+100, len(orgIds))] {
+			keys = append(keys, orgKey(orgId))
+		}
+
+		requestItems := map[string]*dynamodbService.KeysAndAttributes{*orgTableName: {Keys: keys}}
+
+		for len(requestItems) > 0 {
+			result, err := client.BatchGetItem(&dynamodbService.BatchGetItemInput{RequestItems: requestItems})
+
+			if err != nil {
+				return nil, err
+			}
+
+			var items []*Org
+
+			if err = dynamodbattribute.UnmarshalListOfMaps(result.Responses[*orgTableName], &items); err != nil {
+				return nil, err
+			}
+
+			orgs = append(orgs, items...)
+			requestItems = result.UnprocessedKeys
+		}
+	}
+
+	return orgs, nil
+}
+
+// Saves the editable fields only, so a concurrent ownership transfer is never reverted
+func UpdateOrg(org Org) (*Org, error) {
+	settings, err := dynamodbattribute.Marshal(org.Settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                 orgKey(org.OrgId),
+		TableName:           orgTableName,
+		ConditionExpression: aws.String("attribute_exists(orgId)"),
+		UpdateExpression:    aws.String("SET displayName = :displayName, settings = :settings, updatedAt = :updatedAt"),
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":displayName": {S: aws.String(org.DisplayName)},
+			":settings":    settings,
+			":updatedAt":   {S: aws.String(org.UpdatedAt)},
+		},
+		ReturnValues: aws.String(dynamodbService.ReturnValueAllNew),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated := new(Org)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Attributes, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Hands the owner role over to another member, downgrading the current owner to admin
+func TransferOwnership(org Org, newOwnerId string, updatedAt string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	setRole := func(userId string, role Role) *dynamodbService.TransactWriteItem {
+		return &dynamodbService.TransactWriteItem{
+			Update: &dynamodbService.Update{
+				Key:                       membershipKey(org.OrgId, userId),
+				TableName:                 orgMemberTableName,
+				ConditionExpression:       aws.String("attribute_exists(userId)"),
+				UpdateExpression:          aws.String("SET #role = :role"),
+				ExpressionAttributeNames:  map[string]*string{"#role": aws.String("role")},
+				ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":role": {S: aws.String(string(role))}},
+			},
+		}
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{
+		TransactItems: []*dynamodbService.TransactWriteItem{
+			{
+				Update: &dynamodbService.Update{
+					Key:                 orgKey(org.OrgId),
+					TableName:           orgTableName,
+					ConditionExpression: aws.String("ownerId = :currentOwnerId"),
+					UpdateExpression:    aws.String("SET ownerId = :newOwnerId, updatedAt = :updatedAt"),
+					ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+						":currentOwnerId": {S: aws.String(org.OwnerId)},
+						":newOwnerId":     {S: aws.String(newOwnerId)},
+						":updatedAt":      {S: aws.String(updatedAt)},
+					},
+				},
+			},
+			setRole(newOwnerId, RoleOwner),
+			setRole(org.OwnerId, RoleAdmin),
+		},
+	})
+
+	return err
+}
+
+func orgKey(orgId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId": {S: aws.String(orgId)},
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	_, hasOrgId := req.PathParameters["orgId"]
+
+	switch {
+	case req.HTTPMethod == http.MethodGet && !hasOrgId:
+		return ListOrgs(req), nil
+	case req.HTTPMethod == http.MethodPost && !hasOrgId:
+		return CreateOrg(ctx, req), nil
+	case req.HTTPMethod == http.MethodGet:
+		return GetOrg(req), nil
+	case req.HTTPMethod == http.MethodPatch:
+		return UpdateOrg(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
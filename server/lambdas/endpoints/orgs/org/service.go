@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type CreateOrgRequest struct {
+	OrgId       string           `json:"orgId"`
+	DisplayName string           `json:"displayName"`
+	Settings    orgs.OrgSettings `json:"settings"`
+}
+
+type UpdateOrgRequest struct {
+	DisplayName *string           `json:"displayName"`
+	Settings    *orgs.OrgSettings `json:"settings"`
+}
+
+func ListOrgs(req restApi.Request) restApi.Response {
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	memberships, err := orgs.QueryMembershipsByUser(orchestrator.GetCallerId(req))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load your memberships")
+	}
+
+	var orgIds []string
+
+	for _, membership := range memberships {
+		orgIds = append(orgIds, membership.OrgId)
+	}
+
+	orgList, err := orgs.GetOrgs(orgIds)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load your orgs")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.Org{"orgs": orgList})
+}
+
+func CreateOrg(ctx context.Context, req restApi.Request) restApi.Response {
+	var (
+		callerId    = orchestrator.GetCallerId(req)
+		now         = strconv.FormatInt(time.Now().Unix(), 10)
+		requestData CreateOrgRequest
+	)
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || !orgs.IsValidName(requestData.OrgId) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if errResponse := validateSettings(requestData.Settings); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := ensureOrgIdIsFree(ctx, requestData.OrgId, callerId); errResponse != nil {
+		return *errResponse
+	}
+
+	org, err := orgs.InsertOrg(orgs.Org{
+		OrgId:       requestData.OrgId,
+		DisplayName: requestData.DisplayName,
+		OwnerId:     callerId,
+		Settings:    requestData.Settings,
+		Usage:       &orgs.OrgUsage{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, orgs.Membership{
+		OrgId:     requestData.OrgId,
+		UserId:    callerId,
+		Role:      orgs.RoleOwner,
+		CreatedAt: now,
+	})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "This org already exists")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to create the org")
+	}
+
+	audit.Record(audit.Event{OrgId: org.OrgId, ActorId: callerId, Action: "org.created", Resource: org.OrgId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusCreated, org)
+}
+
+func GetOrg(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+	}
+
+	if org == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, org)
+}
+
+func UpdateOrg(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData UpdateOrgRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.Settings != nil {
+		if errResponse := validateSettings(*requestData.Settings); errResponse != nil {
+			return *errResponse
+		}
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+	}
+
+	if org == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+	}
+
+	if requestData.DisplayName != nil {
+		org.DisplayName = *requestData.DisplayName
+	}
+
+	if requestData.Settings != nil {
+		org.Settings = *requestData.Settings
+	}
+
+	org.UpdatedAt = strconv.FormatInt(time.Now().Unix(), 10)
+	org, err = orgs.UpdateOrg(*org)
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+	}
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update the org")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "org.updated", Resource: orgId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusOK, org)
+}
+
+// Orgs used to be created implicitly on the first push, so an id that already holds envs can only be registered
+// by an operator through the register-org lambda
+func ensureOrgIdIsFree(ctx context.Context, orgId string, callerId string) *restApi.Response {
+	memberships, err := orgs.QueryMemberships(orgId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org members")
+
+		return &response
+	}
+
+	for _, membership := range memberships {
+		if membership.Role == orgs.RoleOwner && membership.UserId != callerId {
+			response := restApi.BuildErrorResponse(http.StatusConflict, "This org already exists")
+
+			return &response
+		}
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load SDK Configuration")
+
+		return &response
+	}
+
+	hasObjects, err := bucketService.HasObjects(ctx, s3.NewFromConfig(cfg), orgId+"/")
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to check the org files")
+
+		return &response
+	}
+
+	if hasObjects {
+		response := restApi.BuildErrorResponse(http.StatusConflict, "This org already holds env files, ask an operator to register it")
+
+		return &response
+	}
+
+	return nil
+}
+
+func validateSettings(settings orgs.OrgSettings) *restApi.Response {
+	for _, policy := range settings.RotationPolicies {
+		if _, err := path.Match(policy.KeyPattern, ""); err != nil || policy.KeyPattern == "" || policy.MaxAgeDays < 1 {
+			response := restApi.BuildErrorResponse(http.StatusBadRequest, "Each rotation policy needs a key glob and a max age of at least one day")
+
+			return &response
+		}
+	}
+
+	if settings.LockOverrideRole != "" && !settings.LockOverrideRole.IsValid() {
+		response := restApi.BuildErrorResponse(http.StatusBadRequest, "The lock override role must be one of reader, writer, admin or owner")
+
+		return &response
+	}
+
+	for _, pattern := range settings.SecretScan.NonSensitiveKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			response := restApi.BuildErrorResponse(http.StatusBadRequest, "The non-sensitive keys must be globs on key names")
+
+			return &response
+		}
+	}
+
+	return nil
+}
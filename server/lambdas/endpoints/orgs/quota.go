@@ -0,0 +1,115 @@
+package orgs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Limits on how much an org can push and store. They are set by the operators of the service
+// on the org item, not through the API; zero values fall back to the defaults
+type OrgQuota struct {
+	PushesPerHour int64 `json:"pushesPerHour,omitempty"`
+	MaxEnvs       int64 `json:"maxEnvs,omitempty"`
+	MaxBytes      int64 `json:"maxBytes,omitempty"`
+}
+
+// What the org stores, counted on every write and delete so pushes never have to list the bucket
+type OrgUsage struct {
+	EnvCount    int64 `json:"envCount"`
+	StoredBytes int64 `json:"storedBytes"`
+}
+
+const (
+	DefaultPushesPerHour = 300
+	DefaultMaxEnvs       = 500
+	DefaultMaxBytes      = 50 * 1024 * 1024
+	PushQuotaWindow      = time.Hour
+)
+
+func (quota OrgQuota) WithDefaults() OrgQuota {
+	if quota.PushesPerHour <= 0 {
+		quota.PushesPerHour = DefaultPushesPerHour
+	}
+
+	if quota.MaxEnvs <= 0 {
+		quota.MaxEnvs = DefaultMaxEnvs
+	}
+
+	if quota.MaxBytes <= 0 {
+		quota.MaxBytes = DefaultMaxBytes
+	}
+
+	return quota
+}
+
+// Sets the usage of an org created before it was counted, unless another request already did
+func InitOrgUsage(orgId string, usage OrgUsage) error {
+	item, err := dynamodbattribute.Marshal(usage)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                       orgKey(orgId),
+		TableName:                 orgTableName,
+		ConditionExpression:       aws.String("attribute_exists(orgId) AND attribute_not_exists(#usage)"),
+		UpdateExpression:          aws.String("SET #usage = :usage"),
+		ExpressionAttributeNames:  map[string]*string{"#usage": aws.String("usage")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":usage": item},
+	})
+
+	return err
+}
+
+// Adds the envs and bytes to the usage of the org. When either grows, the write fails with a conditional check
+// error if it would take the org over its quota, so concurrent pushes cannot both take the last of it
+func AddOrgUsage(orgId string, envs int64, bytes int64, quota OrgQuota) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		quotaWithDefaults = quota.WithDefaults()
+		conditions        = []string{"attribute_exists(#usage)"}
+		values            = map[string]*dynamodbService.AttributeValue{
+			":envs":  {N: aws.String(strconv.FormatInt(envs, 10))},
+			":bytes": {N: aws.String(strconv.FormatInt(bytes, 10))},
+		}
+	)
+
+	if envs > 0 {
+		conditions = append(conditions, "#usage.envCount <= :maxEnvs")
+		values[":maxEnvs"] = &dynamodbService.AttributeValue{N: aws.String(strconv.FormatInt(quotaWithDefaults.MaxEnvs-envs, 10))}
+	}
+
+	if bytes > 0 {
+		conditions = append(conditions, "#usage.storedBytes <= :maxBytes")
+		values[":maxBytes"] = &dynamodbService.AttributeValue{N: aws.String(strconv.FormatInt(quotaWithDefaults.MaxBytes-bytes, 10))}
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                       orgKey(orgId),
+		TableName:                 orgTableName,
+		ConditionExpression:       aws.String(strings.Join(conditions, " AND ")),
+		UpdateExpression:          aws.String("SET #usage.envCount = #usage.envCount + :envs, #usage.storedBytes = #usage.storedBytes + :bytes"),
+		ExpressionAttributeNames:  map[string]*string{"#usage": aws.String("usage")},
+		ExpressionAttributeValues: values,
+	})
+
+	return err
+}
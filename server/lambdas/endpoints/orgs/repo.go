@@ -0,0 +1,258 @@
+package orgs
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type RepoStatus string
+
+const (
+	RepoStatusActive   RepoStatus = "active"
+	RepoStatusArchived RepoStatus = "archived"
+)
+
+type Repo struct {
+	OrgId     string     `json:"orgId"`
+	RepoId    string     `json:"repoId"`
+	Status    RepoStatus `json:"status"`
+	CreatedAt string     `json:"createdAt"`
+	CreatedBy string     `json:"createdBy"`
+	UpdatedAt string     `json:"updatedAt"`
+	// Set on both entries while the envs are moved, so neither id takes pushes until the rename finishes
+	RenamingTo   string `json:"renamingTo,omitempty"`
+	RenamingFrom string `json:"renamingFrom,omitempty"`
+}
+
+var (
+	repoTableName = aws.String(os.Getenv("RepoTableName"))
+)
+
+// Registers the repo, failing if the repo id is taken in the org
+func InsertRepo(repo Repo) (*Repo, error) {
+	item, err := dynamodbattribute.MarshalMap(repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:                item,
+		TableName:           repoTableName,
+		ConditionExpression: aws.String("attribute_not_exists(repoId)"),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func GetRepo(orgId string, repoId string) (*Repo, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       repoKey(orgId, repoId),
+		TableName: repoTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	repo := new(Repo)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, repo); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func QueryRepos(orgId string) ([]*Repo, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []*Repo
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: repoTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*Repo
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			repos = append(repos, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func UpdateRepoStatus(orgId string, repoId string, status RepoStatus, updatedAt string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                      repoKey(orgId, repoId),
+		TableName:                repoTableName,
+		ConditionExpression:      aws.String("attribute_exists(repoId)"),
+		UpdateExpression:         aws.String("SET #status = :status, updatedAt = :updatedAt"),
+		ExpressionAttributeNames: map[string]*string{"#status": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":status":    {S: aws.String(string(status))},
+			":updatedAt": {S: aws.String(updatedAt)},
+		},
+	})
+
+	return err
+}
+
+// Marks the repo as being renamed and reserves the new id. Starting the same rename again succeeds, so a rename
+// that failed part way can be resumed
+func StartRepoRename(repo Repo, newRepoId string, updatedAt string) error {
+	oldRepoId := repo.RepoId
+	repo.RepoId = newRepoId
+	repo.UpdatedAt = updatedAt
+	repo.RenamingTo = ""
+	repo.RenamingFrom = oldRepoId
+
+	item, err := dynamodbattribute.MarshalMap(repo)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{
+		TransactItems: []*dynamodbService.TransactWriteItem{
+			{
+				Update: &dynamodbService.Update{
+					Key:                 repoKey(repo.OrgId, oldRepoId),
+					TableName:           repoTableName,
+					ConditionExpression: aws.String("attribute_exists(repoId) AND (attribute_not_exists(renamingTo) OR renamingTo = :newRepoId)"),
+					UpdateExpression:    aws.String("SET renamingTo = :newRepoId, updatedAt = :updatedAt"),
+					ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+						":newRepoId": {S: aws.String(newRepoId)},
+						":updatedAt": {S: aws.String(updatedAt)},
+					},
+				},
+			},
+			{
+				Put: &dynamodbService.Put{
+					Item:                      item,
+					TableName:                 repoTableName,
+					ConditionExpression:       aws.String("attribute_not_exists(repoId) OR renamingFrom = :oldRepoId"),
+					ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":oldRepoId": {S: aws.String(oldRepoId)}},
+				},
+			},
+		},
+	})
+
+	return err
+}
+
+// Takes the new id out of the rename and removes the old entry in a single transaction
+func FinishRepoRename(repo Repo, newRepoId string, updatedAt string) (*Repo, error) {
+	oldRepoId := repo.RepoId
+	repo.RepoId = newRepoId
+	repo.UpdatedAt = updatedAt
+	repo.RenamingTo = ""
+	repo.RenamingFrom = ""
+
+	item, err := dynamodbattribute.MarshalMap(repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{
+		TransactItems: []*dynamodbService.TransactWriteItem{
+			{
+				Put: &dynamodbService.Put{
+					Item:                      item,
+					TableName:                 repoTableName,
+					ConditionExpression:       aws.String("renamingFrom = :oldRepoId"),
+					ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":oldRepoId": {S: aws.String(oldRepoId)}},
+				},
+			},
+			{
+				Delete: &dynamodbService.Delete{
+					Key:       repoKey(repo.OrgId, oldRepoId),
+					TableName: repoTableName,
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func DeleteRepo(orgId string, repoId string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       repoKey(orgId, repoId),
+		TableName: repoTableName,
+	})
+
+	return err
+}
+
+func repoKey(orgId string, repoId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":  {S: aws.String(orgId)},
+		"repoId": {S: aws.String(repoId)},
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/repos":
+		return ListRepos(req), nil
+	case "POST /orgs/{orgId}/repos":
+		return CreateRepo(req), nil
+	case "DELETE /orgs/{orgId}/repos/{repoId}":
+		return DeleteRepo(ctx, req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/rename":
+		return RenameRepo(ctx, req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/archive":
+		return SetRepoStatus(req, orgs.RepoStatusArchived), nil
+	case "DELETE /orgs/{orgId}/repos/{repoId}/archive":
+		return SetRepoStatus(req, orgs.RepoStatusActive), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
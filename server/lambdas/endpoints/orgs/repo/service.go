@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type CreateRepoRequest struct {
+	RepoId string `json:"repoId"`
+}
+
+type RenameRepoRequest struct {
+	NewRepoId string `json:"newRepoId"`
+}
+
+func ListRepos(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleReader); errResponse != nil {
+		return *errResponse
+	}
+
+	repos, err := orgs.QueryRepos(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the repositories")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.Repo{"repos": repos})
+}
+
+func CreateRepo(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		callerId    = orchestrator.GetCallerId(req)
+		now         = strconv.FormatInt(time.Now().Unix(), 10)
+		requestData CreateRepoRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || !orgs.IsValidName(requestData.RepoId) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	repo, err := orgs.InsertRepo(orgs.Repo{
+		OrgId:     orgId,
+		RepoId:    requestData.RepoId,
+		Status:    orgs.RepoStatusActive,
+		CreatedAt: now,
+		CreatedBy: callerId,
+		UpdatedAt: now,
+	})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "This repository already exists")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to create the repository")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "repo.created", Resource: repo.RepoId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusCreated, repo)
+}
+
+// Moves every env, with its history and policy, to the new repo id. Neither id takes pushes until the move
+// finishes, and renaming the repo to the same id again resumes a move that failed part way
+func RenameRepo(ctx context.Context, req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		repoId      = req.PathParameters["repoId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData RenameRepoRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || !orgs.IsValidName(requestData.NewRepoId) || requestData.NewRepoId == repoId {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	repo, errResponse := getRepo(orgId, repoId)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if repo.RenamingFrom != "" {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The repository is being renamed from "+repo.RenamingFrom+", finish that rename first")
+	}
+
+	if repo.RenamingTo != "" && repo.RenamingTo != requestData.NewRepoId {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The repository is being renamed to "+repo.RenamingTo+", finish that rename first")
+	}
+
+	if errResponse := orchestrator.CheckRepoLocks(orgId, callerId, repoId); errResponse != nil {
+		return *errResponse
+	}
+
+	existingRepo, err := orgs.GetRepo(orgId, requestData.NewRepoId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the repository")
+	}
+
+	if existingRepo != nil && existingRepo.RenamingFrom != repoId {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The new repository id is already taken")
+	}
+
+	if errResponse := ensureRepoHasNoDependents(orgId, repoId, "renaming"); errResponse != nil {
+		return *errResponse
+	}
+
+	s3Client, errResponse := getS3Client(ctx)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	err = orgs.StartRepoRename(*repo, requestData.NewRepoId, strconv.FormatInt(time.Now().Unix(), 10))
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The repository changed while starting the rename, try again")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to start the rename")
+	}
+
+	if err := bucketService.MoveObjects(ctx, s3Client, getRepoPrefix(orgId, repoId), getRepoPrefix(orgId, requestData.NewRepoId)); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to move the repository envs, rename it again to resume")
+	}
+
+	if errResponse := moveEnvPolicies(orgId, repoId, &requestData.NewRepoId); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := moveKeyRotations(orgId, repoId, &requestData.NewRepoId); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := moveEnvLocks(orgId, repoId, &requestData.NewRepoId); errResponse != nil {
+		return *errResponse
+	}
+
+	repo, err = orgs.FinishRepoRename(*repo, requestData.NewRepoId, strconv.FormatInt(time.Now().Unix(), 10))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to rename the repository")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "repo.renamed", Resource: repoId + " -> " + repo.RepoId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusOK, repo)
+}
+
+func SetRepoStatus(req restApi.Request, status orgs.RepoStatus) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		repoId   = req.PathParameters["repoId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	err := orgs.UpdateRepoStatus(orgId, repoId, status, strconv.FormatInt(time.Now().Unix(), 10))
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Repository not found")
+	} else if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to update the repository")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "repo." + string(status), Resource: repoId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+// Permanently removes the repository, including the history of its envs
+func DeleteRepo(ctx context.Context, req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		repoId   = req.PathParameters["repoId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleOwner); errResponse != nil {
+		return *errResponse
+	}
+
+	repo, errResponse := getRepo(orgId, repoId)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if repo.RenamingTo != "" || repo.RenamingFrom != "" {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The repository is being renamed, finish the rename before deleting it")
+	}
+
+	if errResponse := orchestrator.CheckRepoLocks(orgId, callerId, repoId); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := ensureRepoHasNoDependents(orgId, repoId, "deleting"); errResponse != nil {
+		return *errResponse
+	}
+
+	s3Client, errResponse := getS3Client(ctx)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	usage, err := orchestrator.CountStorage(ctx, s3Client, getRepoPrefix(orgId, repoId))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the storage used by the repository")
+	}
+
+	deletedKeys, err := bucketService.DeleteObjects(ctx, s3Client, getRepoPrefix(orgId, repoId))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the repository envs")
+	}
+
+	// Orgs whose storage was never counted are counted from the bucket on their next push
+	err = orgs.AddOrgUsage(orgId, -usage.EnvCount, -usage.StoredBytes, orgs.OrgQuota{})
+
+	if err != nil && !dynamodb.IsConditionalCheckFailed(err) {
+		log.Printf("Failed to give back the storage of %s in %s: %v", repoId, orgId, err)
+	}
+
+	if errResponse := moveEnvPolicies(orgId, repoId, nil); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := moveKeyRotations(orgId, repoId, nil); errResponse != nil {
+		return *errResponse
+	}
+
+	if errResponse := moveEnvLocks(orgId, repoId, nil); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := orgs.DeleteRepo(orgId, repoId); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the repository")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "repo.deleted", Resource: repoId, Outcome: audit.OutcomeAllowed})
+
+	for _, key := range deletedKeys {
+		orchestrator.PublishEnvEvent(orgs.EnvEvent{
+			Type:   orgs.EnvEventDelete,
+			OrgId:  orgId,
+			RepoId: repoId,
+			Env:    strings.TrimPrefix(key, getRepoPrefix(orgId, repoId)),
+			Author: callerId,
+		})
+	}
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+func getRepo(orgId string, repoId string) (*orgs.Repo, *restApi.Response) {
+	repo, err := orgs.GetRepo(orgId, repoId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the repository")
+
+		return nil, &response
+	}
+
+	if repo == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Repository not found")
+
+		return nil, &response
+	}
+
+	return repo, nil
+}
+
+// Sync targets, share links, pending change requests and webhooks point at the repo by id, so they would
+// silently stop working after a rename or a delete; they have to be removed, or reviewed, first
+func ensureRepoHasNoDependents(orgId string, repoId string, action string) *restApi.Response {
+	conflict := func(message string) *restApi.Response {
+		response := restApi.BuildErrorResponse(http.StatusConflict, message)
+
+		return &response
+	}
+	failure := func(message string) *restApi.Response {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, message)
+
+		return &response
+	}
+
+	targets, err := orgs.QuerySyncTargets(orgId, repoId)
+
+	if err != nil {
+		return failure("Failed to load the sync targets")
+	}
+
+	if len(targets) > 0 {
+		return conflict("Remove the sync targets of the repository before " + action + " it")
+	}
+
+	links, err := orgs.QueryShareLinks(orgId, repoId)
+
+	if err != nil {
+		return failure("Failed to load the share links")
+	}
+
+	now := time.Now().Unix()
+
+	for _, link := range links {
+		expireAt, err := strconv.ParseInt(link.ExpireAt, 10, 64)
+
+		if link.RevokedAt == "" && err == nil && expireAt >= now {
+			return conflict("Revoke the share links of the repository before " + action + " it")
+		}
+	}
+
+	changeRequests, err := orgs.QueryChangeRequests(orgId)
+
+	if err != nil {
+		return failure("Failed to load the change requests")
+	}
+
+	for _, changeRequest := range changeRequests {
+		if changeRequest.RepoId == repoId && changeRequest.Status == orgs.ChangeRequestStatusPending {
+			return conflict("Review the pending change requests of the repository before " + action + " it")
+		}
+	}
+
+	webhooks, err := orgs.QueryWebhooks(orgId)
+
+	if err != nil {
+		return failure("Failed to load the webhooks")
+	}
+
+	for _, webhook := range webhooks {
+		if strings.HasPrefix(webhook.EnvPattern, repoId+"/") {
+			return conflict("Remove the webhooks that name the repository before " + action + " it")
+		}
+	}
+
+	return nil
+}
+
+// Re-keys the env policies of the repo to the new repo id, or only removes them when there is none
+func moveEnvPolicies(orgId string, repoId string, newRepoId *string) *restApi.Response {
+	policies, err := orgs.QueryEnvPolicies(orgId, repoId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env policies")
+
+		return &response
+	}
+
+	for _, policy := range policies {
+		oldEnvPath := policy.EnvPath
+
+		if newRepoId != nil {
+			policy.EnvPath = orgs.GetEnvPath(*newRepoId, oldEnvPath[len(repoId)+1:])
+
+			if _, err := orgs.InsertEnvPolicy(*policy); err != nil {
+				response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to move the env policies")
+
+				return &response
+			}
+		}
+
+		if err := orgs.DeleteEnvPolicy(orgId, oldEnvPath); err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to remove the env policies")
+
+			return &response
+		}
+	}
+
+	return nil
+}
+
+// Keeps when each key last changed across a rename, so renaming a repo does not reset the age of its secrets
+func moveKeyRotations(orgId string, repoId string, newRepoId *string) *restApi.Response {
+	rotations, err := orgs.QueryKeyRotations(orgId, repoId+"/")
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the key rotations")
+
+		return &response
+	}
+
+	for _, rotation := range rotations {
+		oldKeyPath := rotation.KeyPath
+
+		if newRepoId != nil {
+			rotation.RepoId = *newRepoId
+			rotation.KeyPath = orgs.GetKeyPath(*newRepoId, rotation.Env, rotation.Key)
+
+			if err := orgs.InsertKeyRotation(*rotation); err != nil {
+				response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to move the key rotations")
+
+				return &response
+			}
+		}
+
+		if err := orgs.DeleteKeyRotation(orgId, oldKeyPath); err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to remove the key rotations")
+
+			return &response
+		}
+	}
+
+	return nil
+}
+
+// Keeps the envs locked after a rename, since only the override role could rename them
+func moveEnvLocks(orgId string, repoId string, newRepoId *string) *restApi.Response {
+	locks, err := orgs.QueryEnvLocks(orgId, repoId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the env locks")
+
+		return &response
+	}
+
+	for _, lock := range locks {
+		oldEnvPath := lock.EnvPath
+
+		if newRepoId != nil {
+			lock.RepoId = *newRepoId
+			lock.EnvPath = orgs.GetEnvPath(*newRepoId, lock.Env)
+
+			if _, err := orgs.InsertEnvLock(*lock); err != nil {
+				response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to move the env locks")
+
+				return &response
+			}
+		}
+
+		if err := orgs.DeleteEnvLock(orgId, oldEnvPath); err != nil {
+			response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to remove the env locks")
+
+			return &response
+		}
+	}
+
+	return nil
+}
+
+func getRepoPrefix(orgId string, repoId string) string {
+	return orgId + "/" + repoId + "/"
+}
+
+func getS3Client(ctx context.Context) (*s3.Client, *restApi.Response) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load SDK Configuration")
+
+		return nil, &response
+	}
+
+	return s3.NewFromConfig(cfg), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+type OverdueKey struct {
+	RepoId        string `json:"repoId"`
+	Env           string `json:"env"`
+	Key           string `json:"key"`
+	LastChangedAt string `json:"lastChangedAt"`
+	LastChangedBy string `json:"lastChangedBy"`
+	AgeDays       int64  `json:"ageDays"`
+	MaxAgeDays    int    `json:"maxAgeDays"`
+}
+
+// Lists the keys that are older than the rotation policies of the org allow, optionally for one repo or env.
+// Only key names and ages are reported, never values
+func GetRotationReport(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		repoId = req.QueryStringParameters["repoId"]
+		env    = req.QueryStringParameters["env"]
+		now    = time.Now().Unix()
+		prefix = ""
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if env != "" && repoId == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Filtering by env requires a repoId")
+	}
+
+	if repoId != "" {
+		prefix = repoId + "/"
+	}
+
+	if env != "" {
+		prefix = orgs.GetEnvPath(repoId, env) + "/"
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+	}
+
+	if org == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+	}
+
+	rotations, err := orgs.QueryKeyRotations(orgId, prefix)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the key rotations")
+	}
+
+	overdueKeys := []OverdueKey{}
+
+	for _, rotation := range rotations {
+		maxAgeDays, ok := org.Settings.GetMaxAgeDays(rotation.Key)
+
+		if !ok {
+			continue
+		}
+
+		lastChangedAt, err := strconv.ParseInt(rotation.LastChangedAt, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		if ageDays := (now - lastChangedAt) / secondsPerDay; ageDays >= int64(maxAgeDays) {
+			overdueKeys = append(overdueKeys, OverdueKey{
+				RepoId:        rotation.RepoId,
+				Env:           rotation.Env,
+				Key:           rotation.Key,
+				LastChangedAt: rotation.LastChangedAt,
+				LastChangedBy: rotation.LastChangedBy,
+				AgeDays:       ageDays,
+				MaxAgeDays:    maxAgeDays,
+			})
+		}
+	}
+
+	slices.SortFunc(overdueKeys, func(a OverdueKey, b OverdueKey) int {
+		return cmp.Or(cmp.Compare(a.RepoId, b.RepoId), cmp.Compare(a.Env, b.Env), cmp.Compare(a.Key, b.Key))
+	})
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]OverdueKey{"overdue": overdueKeys})
+}
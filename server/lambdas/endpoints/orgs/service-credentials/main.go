@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/service-credentials":
+		return ListServiceCredentials(req), nil
+	case "POST /orgs/{orgId}/service-credentials":
+		return CreateServiceCredential(req), nil
+	case "POST /orgs/{orgId}/service-credentials/{credentialId}/rotate":
+		return RotateServiceCredential(req), nil
+	case "DELETE /orgs/{orgId}/service-credentials/{credentialId}":
+		return DeleteServiceCredential(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
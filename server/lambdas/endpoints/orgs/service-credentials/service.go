@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	"github.com/PBH-Tech/moonenv/lambdas/util/cognito"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/google/uuid"
+)
+
+type CreateServiceCredentialRequest struct {
+	Name string    `json:"name"`
+	Role orgs.Role `json:"role"`
+}
+
+// The client secret is only returned when the credential is created or rotated
+type ServiceCredentialResponse struct {
+	*orgs.ServiceCredential
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+}
+
+func ListServiceCredentials(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	credentials, err := orgs.QueryServiceCredentials(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the service credentials")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.ServiceCredential{"serviceCredentials": credentials})
+}
+
+func CreateServiceCredential(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData CreateServiceCredentialRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Name == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.Role != orgs.RoleReader && requestData.Role != orgs.RoleWriter {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Service credentials can only be readers or writers")
+	}
+
+	return issueCredential(orgs.ServiceCredential{
+		OrgId:        orgId,
+		CredentialId: uuid.New().String(),
+		Name:         requestData.Name,
+		Role:         requestData.Role,
+		CreatedAt:    strconv.FormatInt(time.Now().Unix(), 10),
+		CreatedBy:    callerId,
+	}, callerId, "service-credential.created")
+}
+
+// Cognito cannot rotate the secret of a client, so a new client replaces the old one,
+// which stops getting tokens right away
+func RotateServiceCredential(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	credential, errResponse := getCredential(orgId, req.PathParameters["credentialId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	credential.RotatedAt = strconv.FormatInt(time.Now().Unix(), 10)
+
+	return issueCredential(*credential, callerId, "service-credential.rotated")
+}
+
+func DeleteServiceCredential(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	credential, errResponse := getCredential(orgId, req.PathParameters["credentialId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := cognito.DeleteClient(credential.ClientId); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the app client")
+	}
+
+	if err := orgs.DeleteServiceCredential(*credential); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the service credential")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "service-credential.deleted", Resource: credential.CredentialId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+// Creates a new app client for the credential, replacing the previous one if there is any
+func issueCredential(credential orgs.ServiceCredential, callerId string, action string) restApi.Response {
+	var (
+		previousClientId = credential.ClientId
+		scopes           = []string{cognito.EnvReadScope}
+	)
+
+	if credential.Role == orgs.RoleWriter {
+		scopes = append(scopes, cognito.EnvWriteScope)
+	}
+
+	appClient, err := cognito.CreateMachineClient(fmt.Sprintf("moonenv-%s-%s", credential.OrgId, credential.Name), scopes)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to create the app client")
+	}
+
+	credential.ClientId = *appClient.ClientId
+
+	savedCredential, err := orgs.InsertServiceCredential(credential, previousClientId)
+
+	if err != nil {
+		cognito.DeleteClient(credential.ClientId)
+
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the service credential")
+	}
+
+	if previousClientId != "" {
+		if err := cognito.DeleteClient(previousClientId); err != nil {
+			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the previous app client")
+		}
+	}
+
+	audit.Record(audit.Event{OrgId: credential.OrgId, ActorId: callerId, Action: action, Resource: credential.CredentialId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusCreated, ServiceCredentialResponse{
+		ServiceCredential: savedCredential,
+		ClientSecret:      *appClient.ClientSecret,
+		Scopes:            scopes,
+	})
+}
+
+func getCredential(orgId string, credentialId string) (*orgs.ServiceCredential, *restApi.Response) {
+	credential, err := orgs.GetServiceCredential(orgId, credentialId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the service credential")
+
+		return nil, &response
+	}
+
+	if credential == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Service credential not found")
+
+		return nil, &response
+	}
+
+	return credential, nil
+}
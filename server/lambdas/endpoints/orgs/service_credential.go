@@ -0,0 +1,156 @@
+package orgs
+
+import (
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// A Cognito app client that CI pipelines use with the client credentials grant.
+// Its client id is the `sub` of the tokens it gets, so it joins the org as a member with Role
+type ServiceCredential struct {
+	OrgId        string `json:"orgId"`
+	CredentialId string `json:"credentialId"`
+	Name         string `json:"name"`
+	ClientId     string `json:"clientId"`
+	Role         Role   `json:"role"`
+	CreatedAt    string `json:"createdAt"`
+	CreatedBy    string `json:"createdBy"`
+	RotatedAt    string `json:"rotatedAt,omitempty"`
+}
+
+var (
+	serviceCredentialTableName = aws.String(os.Getenv("ServiceCredentialTableName"))
+)
+
+// Saves the credential together with the membership of its client
+func InsertServiceCredential(credential ServiceCredential, previousClientId string) (*ServiceCredential, error) {
+	credentialItem, err := dynamodbattribute.MarshalMap(credential)
+
+	if err != nil {
+		return nil, err
+	}
+
+	membershipItem, err := dynamodbattribute.MarshalMap(Membership{
+		OrgId:     credential.OrgId,
+		UserId:    credential.ClientId,
+		Role:      credential.Role,
+		CreatedAt: credential.CreatedAt,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	transactItems := []*dynamodbService.TransactWriteItem{
+		{Put: &dynamodbService.Put{Item: credentialItem, TableName: serviceCredentialTableName}},
+		{Put: &dynamodbService.Put{Item: membershipItem, TableName: orgMemberTableName}},
+	}
+
+	if previousClientId != "" {
+		transactItems = append(transactItems, &dynamodbService.TransactWriteItem{
+			Delete: &dynamodbService.Delete{Key: membershipKey(credential.OrgId, previousClientId), TableName: orgMemberTableName},
+		})
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{TransactItems: transactItems})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+func GetServiceCredential(orgId string, credentialId string) (*ServiceCredential, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       serviceCredentialKey(orgId, credentialId),
+		TableName: serviceCredentialTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	credential := new(ServiceCredential)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, credential); err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func QueryServiceCredentials(orgId string) ([]*ServiceCredential, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []*ServiceCredential
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: serviceCredentialTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*ServiceCredential
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			credentials = append(credentials, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// Removes the credential together with the membership of its client
+func DeleteServiceCredential(credential ServiceCredential) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.TransactWriteItems(&dynamodbService.TransactWriteItemsInput{
+		TransactItems: []*dynamodbService.TransactWriteItem{
+			{Delete: &dynamodbService.Delete{Key: serviceCredentialKey(credential.OrgId, credential.CredentialId), TableName: serviceCredentialTableName}},
+			{Delete: &dynamodbService.Delete{Key: membershipKey(credential.OrgId, credential.ClientId), TableName: orgMemberTableName}},
+		},
+	})
+
+	return err
+}
+
+func serviceCredentialKey(orgId string, credentialId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":        {S: aws.String(orgId)},
+		"credentialId": {S: aws.String(credentialId)},
+	}
+}
@@ -0,0 +1,220 @@
+package orgs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Lets anyone holding the link read one env until it expires, runs out of uses or is revoked.
+// Only the hash of the secret part of the link is stored
+type ShareLink struct {
+	LinkId     string `json:"linkId"`
+	SecretHash string `json:"-"`
+	OrgId      string `json:"orgId"`
+	EnvPath    string `json:"envPath"`
+	RepoId     string `json:"repoId"`
+	Env        string `json:"env"`
+	// When set, only these keys of the env are shared
+	Keys []string `json:"keys,omitempty"`
+	// Zero means the link can be used until it expires
+	MaxUses   int    `json:"maxUses"`
+	UseCount  int    `json:"useCount"`
+	ExpireAt  string `json:"expireAt"`
+	CreatedAt string `json:"createdAt"`
+	CreatedBy string `json:"createdBy"`
+	// The groups of the creator when the link was made, to check the env policy against when it is opened
+	CreatorGroups []string `json:"creatorGroups,omitempty"`
+	RevokedAt     string   `json:"revokedAt,omitempty"`
+	RevokedBy     string   `json:"revokedBy,omitempty"`
+}
+
+var (
+	shareLinkTableName     = aws.String(os.Getenv("ShareLinkTableName"))
+	shareLinkOrgIndexName  = aws.String(os.Getenv("ShareLinkOrgIndexName"))
+	shareLinkSecretEncoder = base64.RawURLEncoding
+)
+
+func GenerateShareLinkSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return shareLinkSecretEncoder.EncodeToString(secret), nil
+}
+
+func HashShareLinkSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// The secret hash is left out of the JSON of the link, so it is marshalled on its own
+func marshalShareLink(link ShareLink) (map[string]*dynamodbService.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(link)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item["secretHash"] = &dynamodbService.AttributeValue{S: aws.String(link.SecretHash)}
+
+	return item, nil
+}
+
+func unmarshalShareLink(item map[string]*dynamodbService.AttributeValue) (*ShareLink, error) {
+	link := new(ShareLink)
+
+	if err := dynamodbattribute.UnmarshalMap(item, link); err != nil {
+		return nil, err
+	}
+
+	if secretHash, ok := item["secretHash"]; ok && secretHash.S != nil {
+		link.SecretHash = *secretHash.S
+	}
+
+	return link, nil
+}
+
+func InsertShareLink(link ShareLink) (*ShareLink, error) {
+	item, err := marshalShareLink(link)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:                item,
+		TableName:           shareLinkTableName,
+		ConditionExpression: aws.String("attribute_not_exists(linkId)"),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func GetShareLink(linkId string) (*ShareLink, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       shareLinkKey(linkId),
+		TableName: shareLinkTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	return unmarshalShareLink(result.Item)
+}
+
+// Returns the links of every env in the repo
+func QueryShareLinks(orgId string, repoId string) ([]*ShareLink, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*ShareLink
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: shareLinkTableName,
+		IndexName: shareLinkOrgIndexName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+			"envPath": {
+				ComparisonOperator: aws.String("BEGINS_WITH"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(GetEnvPath(repoId, ""))}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		for _, item := range page.Items {
+			if link, err := unmarshalShareLink(item); err == nil {
+				links = append(links, link)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// Counts one use of the link, failing if it was revoked or used up in the meantime
+func ConsumeShareLink(linkId string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                 shareLinkKey(linkId),
+		TableName:           shareLinkTableName,
+		ConditionExpression: aws.String("attribute_exists(linkId) AND attribute_not_exists(revokedAt) AND (maxUses = :zero OR useCount < maxUses)"),
+		UpdateExpression:    aws.String("SET useCount = useCount + :one"),
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":zero": {N: aws.String("0")},
+			":one":  {N: aws.String("1")},
+		},
+	})
+
+	return err
+}
+
+func RevokeShareLink(linkId string, revokedBy string, revokedAt string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                 shareLinkKey(linkId),
+		TableName:           shareLinkTableName,
+		ConditionExpression: aws.String("attribute_exists(linkId) AND attribute_not_exists(revokedAt)"),
+		UpdateExpression:    aws.String("SET revokedAt = :revokedAt, revokedBy = :revokedBy"),
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":revokedAt": {S: aws.String(revokedAt)},
+			":revokedBy": {S: aws.String(revokedBy)},
+		},
+	})
+
+	return err
+}
+
+func shareLinkKey(linkId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"linkId": {S: aws.String(linkId)},
+	}
+}
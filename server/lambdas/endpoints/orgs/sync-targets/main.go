@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/repos/{repoId}/sync-targets":
+		return ListSyncTargets(req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/sync-targets":
+		return CreateSyncTarget(req), nil
+	case "DELETE /orgs/{orgId}/repos/{repoId}/sync-targets/{targetId}":
+		return DeleteSyncTarget(req), nil
+	case "POST /orgs/{orgId}/repos/{repoId}/sync-targets/{targetId}/sync":
+		return RetrySync(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
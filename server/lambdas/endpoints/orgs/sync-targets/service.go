@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/google/uuid"
+)
+
+type CreateSyncTargetRequest struct {
+	Env         string              `json:"env"`
+	Type        orgs.SyncTargetType `json:"type"`
+	Destination string              `json:"destination"`
+}
+
+var (
+	ssmPathPattern    = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+	secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9/_+=.@-]{1,512}$`)
+)
+
+func ListSyncTargets(req restApi.Request) restApi.Response {
+	var (
+		orgId  = req.PathParameters["orgId"]
+		repoId = req.PathParameters["repoId"]
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	targets, err := orgs.QuerySyncTargets(orgId, repoId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the sync targets")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.SyncTarget{"syncTargets": targets})
+}
+
+// Registers the target and copies the current env to it right away
+func CreateSyncTarget(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		repoId      = req.PathParameters["repoId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData CreateSyncTargetRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Env == "" || !requestData.Type.IsValid() {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.Type == orgs.SyncTargetSsm && !ssmPathPattern.MatchString(requestData.Destination) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The destination must be an SSM parameter path such as /moonenv/"+orgId+"/app/prod")
+	}
+
+	if requestData.Type == orgs.SyncTargetSecretsManager && !secretNamePattern.MatchString(requestData.Destination) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The destination must be a Secrets Manager secret name")
+	}
+
+	if !orgs.IsInStoreNamespace(requestData.Type, orgId, requestData.Destination) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The destination must be under "+orgs.GetStoreNamespace(requestData.Type, orgId))
+	}
+
+	// Whoever syncs an env copies its values out of moonenv, so they must be able to read it
+	if _, errResponse := orchestrator.AuthorizeEnvAccess(req, orgId, repoId, requestData.Env, orchestrator.EnvAccessRead); errResponse != nil {
+		return *errResponse
+	}
+
+	repo, err := orgs.GetRepo(orgId, repoId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the repository")
+	}
+
+	if repo == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Repository not found")
+	}
+
+	// Two envs syncing to the same place would overwrite each other after every push
+	existing, err := orgs.FindSyncTargetByDestination(orgId, requestData.Type, requestData.Destination)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the sync targets")
+	}
+
+	if existing != nil {
+		return restApi.BuildErrorResponse(http.StatusConflict, "The destination is already used by the sync target of "+existing.EnvPath)
+	}
+
+	target, err := orgs.InsertSyncTarget(orgs.SyncTarget{
+		OrgId:       orgId,
+		TargetId:    uuid.New().String(),
+		EnvPath:     orgs.GetEnvPath(repoId, requestData.Env),
+		RepoId:      repoId,
+		Env:         requestData.Env,
+		Type:        requestData.Type,
+		Destination: requestData.Destination,
+		Status:      orgs.SyncStatusPending,
+		CreatedAt:   strconv.FormatInt(time.Now().Unix(), 10),
+		CreatedBy:   callerId,
+	})
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the sync target")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "sync-target.created", Resource: target.EnvPath, Outcome: audit.OutcomeAllowed, Reason: string(target.Type) + " " + target.Destination})
+	orchestrator.SyncEnv(orgs.SyncRequest{OrgId: orgId, RepoId: repoId, Env: target.Env, TargetId: target.TargetId})
+
+	return restApi.ApiResponse(http.StatusCreated, target)
+}
+
+// Stops syncing the env; what was already written to the target is left in place
+func DeleteSyncTarget(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	target, errResponse := getSyncTarget(req)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := orgs.DeleteSyncTarget(orgId, target.TargetId); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the sync target")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "sync-target.deleted", Resource: target.EnvPath, Outcome: audit.OutcomeAllowed, Reason: string(target.Type) + " " + target.Destination})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+// Syncs the target again, such as after fixing what made the last sync fail
+func RetrySync(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	target, errResponse := getSyncTarget(req)
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	orchestrator.SyncEnv(orgs.SyncRequest{OrgId: orgId, RepoId: target.RepoId, Env: target.Env, TargetId: target.TargetId})
+
+	return restApi.ApiResponse(http.StatusAccepted, map[string]string{"message": "Sync started"})
+}
+
+func getSyncTarget(req restApi.Request) (*orgs.SyncTarget, *restApi.Response) {
+	target, err := orgs.GetSyncTarget(req.PathParameters["orgId"], req.PathParameters["targetId"])
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the sync target")
+
+		return nil, &response
+	}
+
+	if target == nil || target.RepoId != req.PathParameters["repoId"] {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Sync target not found")
+
+		return nil, &response
+	}
+
+	return target, nil
+}
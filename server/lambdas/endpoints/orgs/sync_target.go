@@ -0,0 +1,258 @@
+package orgs
+
+import (
+	"os"
+	"strings"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type SyncTargetType string
+
+const (
+	// Every key becomes a SecureString parameter under the target path
+	SyncTargetSsm SyncTargetType = "ssm"
+	// The whole env is written to one secret as a JSON object
+	SyncTargetSecretsManager SyncTargetType = "secrets-manager"
+)
+
+type SyncStatus string
+
+const (
+	SyncStatusPending   SyncStatus = "pending"
+	SyncStatusSucceeded SyncStatus = "succeeded"
+	SyncStatusFailed    SyncStatus = "failed"
+)
+
+// An external store that receives the env after every push
+type SyncTarget struct {
+	OrgId    string         `json:"orgId"`
+	TargetId string         `json:"targetId"`
+	EnvPath  string         `json:"envPath"`
+	RepoId   string         `json:"repoId"`
+	Env      string         `json:"env"`
+	Type     SyncTargetType `json:"type"`
+	// The parameter path for SSM, or the secret name for Secrets Manager, under the store namespace of the org
+	Destination string     `json:"destination"`
+	CreatedAt   string     `json:"createdAt"`
+	CreatedBy   string     `json:"createdBy"`
+	Status      SyncStatus `json:"status"`
+	// Keys that the target could not store, such as empty values in SSM
+	SkippedKeys   []string `json:"skippedKeys,omitempty"`
+	LastError     string   `json:"lastError,omitempty"`
+	LastVersionId string   `json:"lastVersionId,omitempty"`
+	LastSyncedAt  string   `json:"lastSyncedAt,omitempty"`
+}
+
+// What the sync lambda is invoked with; an empty target id syncs every target of the env
+type SyncRequest struct {
+	OrgId     string `json:"orgId"`
+	RepoId    string `json:"repoId"`
+	Env       string `json:"env"`
+	VersionId string `json:"versionId,omitempty"`
+	TargetId  string `json:"targetId,omitempty"`
+}
+
+var (
+	syncTargetTableName = aws.String(os.Getenv("SyncTargetTableName"))
+)
+
+func (targetType SyncTargetType) IsValid() bool {
+	return targetType == SyncTargetSsm || targetType == SyncTargetSecretsManager
+}
+
+// The SSM path, or the secret name prefix, that the lambdas may write to and read from for the org.
+// The IAM roles are limited to the moonenv namespace, and each org to its own part of it
+func GetStoreNamespace(targetType SyncTargetType, orgId string) string {
+	if targetType == SyncTargetSsm {
+		return "/moonenv/" + orgId + "/"
+	}
+
+	return "moonenv/" + orgId + "/"
+}
+
+// Tells whether the SSM path or secret name lives under the namespace of the org
+func IsInStoreNamespace(targetType SyncTargetType, orgId string, destination string) bool {
+	namespace := GetStoreNamespace(targetType, orgId)
+
+	return IsValidName(orgId) && strings.HasPrefix(destination, namespace) && !strings.Contains(destination, "..")
+}
+
+func InsertSyncTarget(target SyncTarget) (*SyncTarget, error) {
+	item, err := dynamodbattribute.MarshalMap(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: syncTargetTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &target, nil
+}
+
+func GetSyncTarget(orgId string, targetId string) (*SyncTarget, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       syncTargetKey(orgId, targetId),
+		TableName: syncTargetTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	target := new(SyncTarget)
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, target); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// Returns the targets of every env in the repo
+func QuerySyncTargets(orgId string, repoId string) ([]*SyncTarget, error) {
+	return querySyncTargets(&dynamodbService.QueryInput{
+		TableName: syncTargetTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+		FilterExpression:          aws.String("repoId = :repoId"),
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":repoId": {S: aws.String(repoId)}},
+	})
+}
+
+// Returns the target of the org that already writes to the destination, if any. A trailing slash does not make
+// an SSM path another destination
+func FindSyncTargetByDestination(orgId string, targetType SyncTargetType, destination string) (*SyncTarget, error) {
+	targets, err := querySyncTargets(&dynamodbService.QueryInput{
+		TableName: syncTargetTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+		FilterExpression:          aws.String("#type = :type"),
+		ExpressionAttributeNames:  map[string]*string{"#type": aws.String("type")},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":type": {S: aws.String(string(targetType))}},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, target := range targets {
+		if strings.TrimSuffix(target.Destination, "/") == strings.TrimSuffix(destination, "/") {
+			return target, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func querySyncTargets(input *dynamodbService.QueryInput) ([]*SyncTarget, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*SyncTarget
+
+	err = client.QueryPages(input, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		var items []*SyncTarget
+
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err == nil {
+			targets = append(targets, items...)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// Records the outcome of a sync, unless the target was deleted in the meantime
+func UpdateSyncTargetStatus(target SyncTarget) error {
+	skippedKeys, err := dynamodbattribute.Marshal(target.SkippedKeys)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                 syncTargetKey(target.OrgId, target.TargetId),
+		TableName:           syncTargetTableName,
+		ConditionExpression: aws.String("attribute_exists(targetId)"),
+		UpdateExpression:    aws.String("SET #status = :status, skippedKeys = :skippedKeys, lastError = :lastError, lastVersionId = :lastVersionId, lastSyncedAt = :lastSyncedAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":status":        {S: aws.String(string(target.Status))},
+			":skippedKeys":   skippedKeys,
+			":lastError":     {S: aws.String(target.LastError)},
+			":lastVersionId": {S: aws.String(target.LastVersionId)},
+			":lastSyncedAt":  {S: aws.String(target.LastSyncedAt)},
+		},
+	})
+
+	return err
+}
+
+func DeleteSyncTarget(orgId string, targetId string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       syncTargetKey(orgId, targetId),
+		TableName: syncTargetTableName,
+	})
+
+	return err
+}
+
+func syncTargetKey(orgId string, targetId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":    {S: aws.String(orgId)},
+		"targetId": {S: aws.String(targetId)},
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+)
+
+type TransferOwnershipRequest struct {
+	UserId string `json:"userId"`
+}
+
+func TransferOwnership(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData TransferOwnershipRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleOwner); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.UserId == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if requestData.UserId == callerId {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "You already own this org")
+	}
+
+	org, err := orgs.GetOrg(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org")
+	}
+
+	if org == nil {
+		return restApi.BuildErrorResponse(http.StatusNotFound, "Org not found")
+	}
+
+	newOwner, err := orgs.GetMembership(orgId, requestData.UserId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the org membership")
+	}
+
+	if newOwner == nil {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The new owner must be a member of the org")
+	}
+
+	if err = orgs.TransferOwnership(*org, requestData.UserId, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to transfer the org ownership")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "org.ownership.transferred", Resource: requestData.UserId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
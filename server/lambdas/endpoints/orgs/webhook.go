@@ -0,0 +1,310 @@
+package orgs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/envelope"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+type EnvEventType string
+
+const (
+	EnvEventPush   EnvEventType = "push"
+	EnvEventDelete EnvEventType = "delete"
+)
+
+func (eventType EnvEventType) IsValid() bool {
+	return eventType == EnvEventPush || eventType == EnvEventDelete
+}
+
+// What happened to an env, as sent to the webhooks of its org
+type EnvEvent struct {
+	EventId    string       `json:"eventId"`
+	Type       EnvEventType `json:"type"`
+	OrgId      string       `json:"orgId"`
+	RepoId     string       `json:"repoId"`
+	Env        string       `json:"env"`
+	VersionId  string       `json:"versionId,omitempty"`
+	Author     string       `json:"author"`
+	OccurredAt string       `json:"occurredAt"`
+}
+
+// The secret signs every delivery and is only returned when the webhook is created. It is stored encrypted
+// with its own data key, so reading the webhooks does not expose it
+type Webhook struct {
+	OrgId     string         `json:"orgId"`
+	WebhookId string         `json:"webhookId"`
+	Url       string         `json:"url"`
+	Secret    string         `json:"-"`
+	DataKey   string         `json:"-"`
+	Events    []EnvEventType `json:"events"`
+	// A repoId/env glob such as "api/prod" or "*/prod"; empty matches every env
+	EnvPattern string `json:"envPattern,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+	CreatedBy  string `json:"createdBy"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	WebhookId      string         `json:"webhookId"`
+	DeliveryId     string         `json:"deliveryId"`
+	OrgId          string         `json:"orgId"`
+	Event          EnvEvent       `json:"event"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	ResponseStatus int            `json:"responseStatus,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	DeliveredAt    string         `json:"deliveredAt"`
+}
+
+var (
+	webhookTableName         = aws.String(os.Getenv("WebhookTableName"))
+	webhookDeliveryTableName = aws.String(os.Getenv("WebhookDeliveryTableName"))
+	webhookKeyId             = os.Getenv("WebhookKeyId")
+)
+
+func (webhook Webhook) Matches(event EnvEvent) bool {
+	if !slices.Contains(webhook.Events, event.Type) {
+		return false
+	}
+
+	if webhook.EnvPattern == "" {
+		return true
+	}
+
+	matched, err := path.Match(webhook.EnvPattern, GetEnvPath(event.RepoId, event.Env))
+
+	return err == nil && matched
+}
+
+func InsertWebhook(webhook Webhook) (*Webhook, error) {
+	item, err := dynamodbattribute.MarshalMap(webhook)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, encryptedKey, err := envelope.NewDataKey(webhookKeyId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sealedSecret, err := envelope.Seal(key, webhook.Secret, webhookSecretContext(webhook))
+
+	if err != nil {
+		return nil, err
+	}
+
+	item["secret"] = &dynamodbService.AttributeValue{S: aws.String(sealedSecret)}
+	item["dataKey"] = &dynamodbService.AttributeValue{S: aws.String(encryptedKey)}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: webhookTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func GetWebhook(orgId string, webhookId string) (*Webhook, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       webhookKey(orgId, webhookId),
+		TableName: webhookTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	return unmarshalWebhook(result.Item)
+}
+
+func QueryWebhooks(orgId string) ([]*Webhook, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []*Webhook
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: webhookTableName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		for _, item := range page.Items {
+			if webhook, err := unmarshalWebhook(item); err == nil {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func DeleteWebhook(orgId string, webhookId string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       webhookKey(orgId, webhookId),
+		TableName: webhookTableName,
+	})
+
+	return err
+}
+
+// The delivery id starts with the time it was made, so the log of a webhook reads in order
+func InsertWebhookDelivery(delivery WebhookDelivery) (*WebhookDelivery, error) {
+	delivery.DeliveryId = fmt.Sprintf("%d#%s", time.Now().UnixNano(), uuid.New().String())
+
+	item, err := dynamodbattribute.MarshalMap(delivery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: webhookDeliveryTableName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// Returns the latest deliveries of the webhook, newest first
+func QueryWebhookDeliveries(webhookId string, limit int64) ([]*WebhookDelivery, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Query(&dynamodbService.QueryInput{
+		TableName:        webhookDeliveryTableName,
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(limit),
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"webhookId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(webhookId)}},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []*WebhookDelivery
+
+	if err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func unmarshalWebhook(item map[string]*dynamodbService.AttributeValue) (*Webhook, error) {
+	webhook := new(Webhook)
+
+	if err := dynamodbattribute.UnmarshalMap(item, webhook); err != nil {
+		return nil, err
+	}
+
+	if secret, ok := item["secret"]; ok && secret.S != nil {
+		webhook.Secret = *secret.S
+	}
+
+	if dataKey, ok := item["dataKey"]; ok && dataKey.S != nil {
+		webhook.DataKey = *dataKey.S
+	}
+
+	return webhook, nil
+}
+
+// Decrypts the secret of a loaded webhook in place; only the delivery needs it, so listing the webhooks does
+// not need KMS. Webhooks created before encryption have no data key and keep their secret in plaintext
+func (webhook *Webhook) OpenSecret() error {
+	if webhook.DataKey == "" {
+		return nil
+	}
+
+	key, err := envelope.OpenDataKey(webhook.DataKey)
+
+	if err != nil {
+		return err
+	}
+
+	webhook.Secret, err = envelope.Open(key, webhook.Secret, webhookSecretContext(*webhook))
+
+	return err
+}
+
+// Ties the sealed secret to its webhook
+func webhookSecretContext(webhook Webhook) string {
+	return webhook.OrgId + "#" + webhook.WebhookId + "#secret"
+}
+
+func webhookKey(orgId string, webhookId string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"orgId":     {S: aws.String(orgId)},
+		"webhookId": {S: aws.String(webhookId)},
+	}
+}
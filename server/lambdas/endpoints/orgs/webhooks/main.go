@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /orgs/{orgId}/webhooks":
+		return ListWebhooks(req), nil
+	case "POST /orgs/{orgId}/webhooks":
+		return CreateWebhook(req), nil
+	case "DELETE /orgs/{orgId}/webhooks/{webhookId}":
+		return DeleteWebhook(req), nil
+	case "GET /orgs/{orgId}/webhooks/{webhookId}/deliveries":
+		return ListDeliveries(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
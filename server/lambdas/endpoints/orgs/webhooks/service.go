@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type CreateWebhookRequest struct {
+	Url        string              `json:"url"`
+	Secret     string              `json:"secret"`
+	Events     []orgs.EnvEventType `json:"events"`
+	EnvPattern string              `json:"envPattern"`
+}
+
+// The secret is only returned when the webhook is created
+type WebhookResponse struct {
+	*orgs.Webhook
+	Secret string `json:"secret"`
+}
+
+func ListWebhooks(req restApi.Request) restApi.Response {
+	orgId := req.PathParameters["orgId"]
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	webhooks, err := orgs.QueryWebhooks(orgId)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the webhooks")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.Webhook{"webhooks": webhooks})
+}
+
+func CreateWebhook(req restApi.Request) restApi.Response {
+	var (
+		orgId       = req.PathParameters["orgId"]
+		callerId    = orchestrator.GetCallerId(req)
+		requestData CreateWebhookRequest
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || len(requestData.Events) == 0 {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if webhookUrl, err := url.Parse(requestData.Url); err != nil || webhookUrl.Scheme != "https" || webhookUrl.Host == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The webhook url must be an https url")
+	}
+
+	for _, eventType := range requestData.Events {
+		if !eventType.IsValid() {
+			return restApi.BuildErrorResponse(http.StatusBadRequest, "The events can only be push or delete")
+		}
+	}
+
+	if _, err := path.Match(requestData.EnvPattern, ""); err != nil {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The env pattern must be a repoId/env glob")
+	}
+
+	if requestData.Secret == "" {
+		secret, err := generateSecret()
+
+		if err != nil {
+			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the webhook secret")
+		}
+
+		requestData.Secret = secret
+	}
+
+	webhook, err := orgs.InsertWebhook(orgs.Webhook{
+		OrgId:      orgId,
+		WebhookId:  uuid.New().String(),
+		Url:        requestData.Url,
+		Secret:     requestData.Secret,
+		Events:     requestData.Events,
+		EnvPattern: requestData.EnvPattern,
+		CreatedAt:  strconv.FormatInt(time.Now().Unix(), 10),
+		CreatedBy:  callerId,
+	})
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the webhook")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "webhook.created", Resource: webhook.WebhookId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusCreated, WebhookResponse{Webhook: webhook, Secret: webhook.Secret})
+}
+
+func DeleteWebhook(req restApi.Request) restApi.Response {
+	var (
+		orgId    = req.PathParameters["orgId"]
+		callerId = orchestrator.GetCallerId(req)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	webhook, errResponse := getWebhook(orgId, req.PathParameters["webhookId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	if err := orgs.DeleteWebhook(orgId, webhook.WebhookId); err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to delete the webhook")
+	}
+
+	audit.Record(audit.Event{OrgId: orgId, ActorId: callerId, Action: "webhook.deleted", Resource: webhook.WebhookId, Outcome: audit.OutcomeAllowed})
+
+	return restApi.ApiResponse(http.StatusNoContent, nil)
+}
+
+func ListDeliveries(req restApi.Request) restApi.Response {
+	var (
+		orgId = req.PathParameters["orgId"]
+		limit = int64(defaultLimit)
+	)
+
+	if _, errResponse := orchestrator.AuthorizeOrgRole(req, orgId, orgs.RoleAdmin); errResponse != nil {
+		return *errResponse
+	}
+
+	if limitStr, ok := req.QueryStringParameters["limit"]; ok {
+		parsedLimit, err := strconv.ParseInt(limitStr, 10, 64)
+
+		if err != nil || parsedLimit < 1 || parsedLimit > maxLimit {
+			return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid limit")
+		}
+
+		limit = parsedLimit
+	}
+
+	webhook, errResponse := getWebhook(orgId, req.PathParameters["webhookId"])
+
+	if errResponse != nil {
+		return *errResponse
+	}
+
+	deliveries, err := orgs.QueryWebhookDeliveries(webhook.WebhookId, limit)
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the deliveries")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*orgs.WebhookDelivery{"deliveries": deliveries})
+}
+
+func getWebhook(orgId string, webhookId string) (*orgs.Webhook, *restApi.Response) {
+	webhook, err := orgs.GetWebhook(orgId, webhookId)
+
+	if err != nil {
+		response := restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load the webhook")
+
+		return nil, &response
+	}
+
+	if webhook == nil {
+		response := restApi.BuildErrorResponse(http.StatusNotFound, "Webhook not found")
+
+		return nil, &response
+	}
+
+	return webhook, nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(_ctx context.Context, req restApi.Request) (restApi.Response, error) {
+	switch req.HTTPMethod + " " + req.Resource {
+	case "GET /tokens":
+		return ListPersonalAccessTokens(req), nil
+	case "POST /tokens":
+		return CreatePersonalAccessToken(req), nil
+	case "DELETE /tokens/{tokenId}":
+		return RevokePersonalAccessToken(req), nil
+	default:
+		return restApi.UnhandledMethod(), nil
+	}
+}
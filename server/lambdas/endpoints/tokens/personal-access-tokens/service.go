@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orchestrator"
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/tokens"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/google/uuid"
+)
+
+const maxExpiresInDays = 365
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string           `json:"name"`
+	Scope         string           `json:"scope"`
+	Access        principal.Access `json:"access"`
+	ExpiresInDays int64            `json:"expiresInDays"`
+}
+
+// The token is only returned when it is created
+type PersonalAccessTokenResponse struct {
+	*tokens.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+func ListPersonalAccessTokens(req restApi.Request) restApi.Response {
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	accessTokens, err := tokens.QueryPersonalAccessTokens(orchestrator.GetCallerId(req))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load your personal access tokens")
+	}
+
+	return restApi.ApiResponse(http.StatusOK, map[string][]*tokens.PersonalAccessToken{"personalAccessTokens": accessTokens})
+}
+
+func CreatePersonalAccessToken(req restApi.Request) restApi.Response {
+	var (
+		now         = time.Now()
+		requestData CreatePersonalAccessTokenRequest
+	)
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	if err := json.Unmarshal([]byte(req.Body), &requestData); err != nil || requestData.Name == "" {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "Invalid body request")
+	}
+
+	if !isValidScope(requestData.Scope) {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The scope must be an orgId/repoId/env pattern")
+	}
+
+	if requestData.Access != principal.AccessRead && requestData.Access != principal.AccessWrite {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The access must be read or write")
+	}
+
+	if requestData.ExpiresInDays < 1 || requestData.ExpiresInDays > maxExpiresInDays {
+		return restApi.BuildErrorResponse(http.StatusBadRequest, "The token must expire within a year")
+	}
+
+	token, err := tokens.GeneratePersonalAccessToken()
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to generate the token")
+	}
+
+	accessToken, err := tokens.InsertPersonalAccessToken(tokens.PersonalAccessToken{
+		TokenHash: tokens.HashPersonalAccessToken(token),
+		TokenId:   uuid.New().String(),
+		UserId:    orchestrator.GetCallerId(req),
+		Name:      requestData.Name,
+		Scope:     requestData.Scope,
+		Access:    requestData.Access,
+		ExpireAt:  strconv.FormatInt(now.Add(time.Duration(requestData.ExpiresInDays)*24*time.Hour).Unix(), 10),
+		CreatedAt: strconv.FormatInt(now.Unix(), 10),
+	})
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to save the personal access token")
+	}
+
+	return restApi.ApiResponse(http.StatusCreated, PersonalAccessTokenResponse{PersonalAccessToken: accessToken, Token: token})
+}
+
+func RevokePersonalAccessToken(req restApi.Request) restApi.Response {
+	tokenId := req.PathParameters["tokenId"]
+
+	if errResponse := orchestrator.RequireUser(req); errResponse != nil {
+		return *errResponse
+	}
+
+	accessTokens, err := tokens.QueryPersonalAccessTokens(orchestrator.GetCallerId(req))
+
+	if err != nil {
+		return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to load your personal access tokens")
+	}
+
+	for _, accessToken := range accessTokens {
+		if accessToken.TokenId != tokenId {
+			continue
+		}
+
+		if err := tokens.DeletePersonalAccessToken(accessToken.TokenHash); err != nil {
+			return restApi.BuildErrorResponse(http.StatusInternalServerError, "Failed to revoke the personal access token")
+		}
+
+		return restApi.ApiResponse(http.StatusNoContent, nil)
+	}
+
+	return restApi.BuildErrorResponse(http.StatusNotFound, "Personal access token not found")
+}
+
+// A scope has exactly three non empty segments, each of them a valid glob
+func isValidScope(scope string) bool {
+	segments := strings.Split(scope, "/")
+
+	if len(segments) != 3 {
+		return false
+	}
+
+	for _, segment := range segments {
+		if segment == "" {
+			return false
+		}
+
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
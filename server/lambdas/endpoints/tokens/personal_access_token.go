@@ -0,0 +1,204 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/PBH-Tech/moonenv/lambdas/util/principal"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Every personal access token starts with it, so the authorizer can tell them apart from JWTs
+const PersonalAccessTokenPrefix = "mnv_pat_"
+
+// Only the hash of the token is stored; the token itself is shown once, when it is created
+type PersonalAccessToken struct {
+	TokenHash string `json:"-"`
+	TokenId   string `json:"tokenId"`
+	UserId    string `json:"userId"`
+	Name      string `json:"name"`
+	// An orgId/repoId/env pattern, where each segment can be a glob such as "acme/*/dev"
+	Scope      string           `json:"scope"`
+	Access     principal.Access `json:"access"`
+	ExpireAt   string           `json:"expireAt"`
+	CreatedAt  string           `json:"createdAt"`
+	LastUsedAt string           `json:"lastUsedAt,omitempty"`
+}
+
+var (
+	personalAccessTokenTableName     = aws.String(os.Getenv("PersonalAccessTokenTableName"))
+	personalAccessTokenUserIndexName = aws.String(os.Getenv("PersonalAccessTokenUserIndexName"))
+)
+
+func GeneratePersonalAccessToken() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+func HashPersonalAccessToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// The hash is the key of the table but is left out of the JSON of the token, so it is marshalled on its own
+func marshalPersonalAccessToken(token PersonalAccessToken) (map[string]*dynamodbService.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item["tokenHash"] = &dynamodbService.AttributeValue{S: aws.String(token.TokenHash)}
+
+	return item, nil
+}
+
+func unmarshalPersonalAccessToken(item map[string]*dynamodbService.AttributeValue) (*PersonalAccessToken, error) {
+	token := new(PersonalAccessToken)
+
+	if err := dynamodbattribute.UnmarshalMap(item, token); err != nil {
+		return nil, err
+	}
+
+	if tokenHash, ok := item["tokenHash"]; ok && tokenHash.S != nil {
+		token.TokenHash = *tokenHash.S
+	}
+
+	return token, nil
+}
+
+func InsertPersonalAccessToken(token PersonalAccessToken) (*PersonalAccessToken, error) {
+	item, err := marshalPersonalAccessToken(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:                item,
+		TableName:           personalAccessTokenTableName,
+		ConditionExpression: aws.String("attribute_not_exists(tokenHash)"),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func GetPersonalAccessToken(tokenHash string) (*PersonalAccessToken, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetItem(&dynamodbService.GetItemInput{
+		Key:       personalAccessTokenKey(tokenHash),
+		TableName: personalAccessTokenTableName,
+	})
+
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	return unmarshalPersonalAccessToken(result.Item)
+}
+
+func QueryPersonalAccessTokens(userId string) ([]*PersonalAccessToken, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*PersonalAccessToken
+
+	err = client.QueryPages(&dynamodbService.QueryInput{
+		TableName: personalAccessTokenTableName,
+		IndexName: personalAccessTokenUserIndexName,
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"userId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(userId)}},
+			},
+		},
+	}, func(page *dynamodbService.QueryOutput, _ bool) bool {
+		for _, item := range page.Items {
+			if token, err := unmarshalPersonalAccessToken(item); err == nil {
+				tokens = append(tokens, token)
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func UpdatePersonalAccessTokenLastUsedAt(tokenHash string, lastUsedAt string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(&dynamodbService.UpdateItemInput{
+		Key:                       personalAccessTokenKey(tokenHash),
+		TableName:                 personalAccessTokenTableName,
+		ConditionExpression:       aws.String("attribute_exists(tokenHash)"),
+		UpdateExpression:          aws.String("SET lastUsedAt = :lastUsedAt"),
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{":lastUsedAt": {S: aws.String(lastUsedAt)}},
+	})
+
+	return err
+}
+
+func DeletePersonalAccessToken(tokenHash string) error {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(&dynamodbService.DeleteItemInput{
+		Key:       personalAccessTokenKey(tokenHash),
+		TableName: personalAccessTokenTableName,
+	})
+
+	return err
+}
+
+func personalAccessTokenKey(tokenHash string) map[string]*dynamodbService.AttributeValue {
+	return map[string]*dynamodbService.AttributeValue{
+		"tokenHash": {S: aws.String(tokenHash)},
+	}
+}
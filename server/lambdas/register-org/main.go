@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	"github.com/PBH-Tech/moonenv/lambdas/util/audit"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Orgs created implicitly on the first push, before the org table existed, are registered by an operator:
+//
+//	aws lambda invoke --function-name moonenv-register-org --cli-binary-format raw-in-base64-out \
+//	  --payload '{"orgId":"acme","ownerId":"<user sub>"}' /dev/stdout
+//
+// The lambda is not behind the API, so only principals allowed to invoke it can claim an existing org.
+// Every folder under the org in the bucket is registered as a repo, so the envs it holds keep taking pushes
+type RegisterOrgEvent struct {
+	OrgId       string `json:"orgId"`
+	OwnerId     string `json:"ownerId"`
+	DisplayName string `json:"displayName"`
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, event RegisterOrgEvent) (*orgs.Org, error) {
+	if !orgs.IsValidName(event.OrgId) || event.OwnerId == "" {
+		return nil, errors.New("orgId and ownerId are required")
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// The repos go first, so a failed run can simply be retried
+	if err := registerRepos(ctx, event.OrgId, now); err != nil {
+		return nil, err
+	}
+
+	org, err := orgs.InsertOrg(orgs.Org{
+		OrgId:       event.OrgId,
+		DisplayName: event.DisplayName,
+		OwnerId:     event.OwnerId,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, orgs.Membership{
+		OrgId:     event.OrgId,
+		UserId:    event.OwnerId,
+		Role:      orgs.RoleOwner,
+		CreatedAt: now,
+	})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		return nil, errors.New("this org is already registered")
+	} else if err != nil {
+		return nil, err
+	}
+
+	audit.Record(audit.Event{OrgId: org.OrgId, ActorId: "operator", Action: "org.registered", Resource: org.OrgId, Outcome: audit.OutcomeAllowed})
+
+	return org, nil
+}
+
+func registerRepos(ctx context.Context, orgId string, now string) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	repoIds, err := bucketService.ListFolders(ctx, s3.NewFromConfig(cfg), orgId+"/")
+
+	if err != nil {
+		return err
+	}
+
+	for _, repoId := range repoIds {
+		if !orgs.IsValidName(repoId) {
+			continue
+		}
+
+		_, err := orgs.InsertRepo(orgs.Repo{
+			OrgId:     orgId,
+			RepoId:    repoId,
+			Status:    orgs.RepoStatusActive,
+			CreatedAt: now,
+			CreatedBy: "operator",
+			UpdatedAt: now,
+		})
+
+		if err != nil && !dynamodb.IsConditionalCheckFailed(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/endpoints/orgs"
+	bucketService "github.com/PBH-Tech/moonenv/lambdas/util/bucket"
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+	"github.com/PBH-Tech/moonenv/lambdas/util/secretstore"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+func main() {
+	lambda.Start(handler)
+}
+
+// Writes the current content of the env to each of its targets and records how it went
+func handler(ctx context.Context, request orgs.SyncRequest) error {
+	targets, err := orgs.QuerySyncTargets(request.OrgId, request.RepoId)
+
+	if err != nil {
+		return err
+	}
+
+	targets = slices.DeleteFunc(targets, func(target *orgs.SyncTarget) bool {
+		return target.Env != request.Env || (request.TargetId != "" && target.TargetId != request.TargetId)
+	})
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	values, readErr := getEnvValues(ctx, request)
+	newSession, err := secretstore.NewSession()
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		target.Status = orgs.SyncStatusSucceeded
+		target.SkippedKeys = nil
+		target.LastError = ""
+		target.LastVersionId = request.VersionId
+
+		switch {
+		case readErr != nil:
+			err = fmt.Errorf("failed to read the env: %w", readErr)
+		case !orgs.IsInStoreNamespace(target.Type, target.OrgId, target.Destination):
+			err = fmt.Errorf("the destination must be under %s", orgs.GetStoreNamespace(target.Type, target.OrgId))
+		case target.Type == orgs.SyncTargetSsm:
+			target.SkippedKeys, err = secretstore.WriteParameters(ssm.New(newSession), target.Destination, target.TargetId, values)
+		case target.Type == orgs.SyncTargetSecretsManager:
+			err = secretstore.WriteSecret(secretsmanager.New(newSession), target.Destination, target.TargetId, values)
+		default:
+			err = fmt.Errorf("unknown target type %s", target.Type)
+		}
+
+		if err != nil {
+			target.Status = orgs.SyncStatusFailed
+			target.LastError = err.Error()
+		}
+
+		target.LastSyncedAt = strconv.FormatInt(time.Now().Unix(), 10)
+
+		if err := orgs.UpdateSyncTargetStatus(*target); err != nil {
+			log.Printf("Failed to record the sync of %s to the target %s: %v", target.EnvPath, target.TargetId, err)
+		}
+	}
+
+	return nil
+}
+
+func getEnvValues(ctx context.Context, request orgs.SyncRequest) (map[string]string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := bucketService.GetObjectFromS3Bucket(ctx, s3.NewFromConfig(cfg), fmt.Sprintf("%s/%s/%s", request.OrgId, request.RepoId, request.Env))
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := base64.StdEncoding.DecodeString(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+
+	for _, entry := range dotenv.Parse(string(content)) {
+		values[entry.Key] = entry.Value
+	}
+
+	return values, nil
+}
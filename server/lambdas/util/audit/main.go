@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+type Outcome string
+
+const (
+	OutcomeAllowed Outcome = "allowed"
+	OutcomeDenied  Outcome = "denied"
+)
+
+type Event struct {
+	OrgId      string  `json:"orgId"`
+	EventId    string  `json:"eventId"`
+	OccurredAt string  `json:"occurredAt"`
+	ActorId    string  `json:"actorId"`
+	Action     string  `json:"action"`
+	Resource   string  `json:"resource"`
+	Outcome    Outcome `json:"outcome"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+var (
+	auditLogTableName = aws.String(os.Getenv("AuditLogTableName"))
+)
+
+// Saves the event in the audit log. The event id is prefixed with the time, so the log is sorted by it
+func Record(event Event) error {
+	now := time.Now()
+
+	event.OccurredAt = fmt.Sprint(now.Unix())
+	event.EventId = fmt.Sprintf("%d#%s", now.UnixNano(), uuid.New().String())
+
+	item, err := dynamodbattribute.MarshalMap(event)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutItem(&dynamodbService.PutItemInput{
+		Item:      item,
+		TableName: auditLogTableName,
+	})
+
+	if err != nil {
+		log.Printf("Failed to record the audit event %s: %v", event.Action, err)
+	}
+
+	return err
+}
+
+// Returns the latest events of the org, newest first
+func QueryEvents(orgId string, limit int64) ([]*Event, error) {
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Query(&dynamodbService.QueryInput{
+		TableName:        auditLogTableName,
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(limit),
+		KeyConditions: map[string]*dynamodbService.Condition{
+			"orgId": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodbService.AttributeValue{{S: aws.String(orgId)}},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+
+	if err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -8,11 +8,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var (
@@ -22,32 +30,76 @@ var (
 type UploadFileData struct {
 	B64Str  string
 	ObjName string
+	// Saved as user metadata of the object version, such as who requested and approved a change
+	Metadata map[string]string
+}
+
+type UploadFileResult struct {
+	Message   string `json:"message"`
+	VersionId string `json:"versionId"`
 }
 
 type DownloadFileData struct {
 	Key string
+	// The ETag the caller already has; the file is only read when it changed
+	IfNoneMatch string
+}
+
+type DownloadFileResult struct {
+	File      string `json:"file,omitempty"`
+	ETag      string `json:"etag"`
+	VersionId string `json:"versionId,omitempty"`
+	// Unix seconds of when the version was written
+	LastModified string `json:"lastModified,omitempty"`
+	NotModified  bool   `json:"notModified,omitempty"`
 }
 
 func GetObjectFromS3Bucket(ctx context.Context, s3Client *s3.Client, key string) (string, error) {
+	result, err := GetObjectIfChanged(ctx, s3Client, key, "")
+
+	if err != nil {
+		return "", err
+	}
+
+	return result.File, nil
+}
+
+// Reads the object unless its ETag still matches ifNoneMatch, in which case S3 answers 304 and nothing is transferred
+func GetObjectIfChanged(ctx context.Context, s3Client *s3.Client, key string, ifNoneMatch string) (*DownloadFileResult, error) {
 	input := &s3.GetObjectInput{
 		Bucket: &bucketName,
 		Key:    &key,
 	}
 
+	if ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+
 	result, getErr := s3Client.GetObject(ctx, input)
 
+	var responseErr *awshttp.ResponseError
+
+	if errors.As(getErr, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotModified {
+		return &DownloadFileResult{ETag: ifNoneMatch, NotModified: true}, nil
+	}
+
 	if getErr != nil {
-		return "", errors.New("failed to get object from s3")
+		return nil, errors.New("failed to get object from s3")
 	}
 
 	defer result.Body.Close()
 	body, err := io.ReadAll(result.Body)
 
 	if err != nil {
-		return "", errors.New("failed to download object from s3")
+		return nil, errors.New("failed to download object from s3")
 	}
 
-	return base64.StdEncoding.EncodeToString(body), nil
+	return &DownloadFileResult{
+		File:         base64.StdEncoding.EncodeToString(body),
+		ETag:         aws.ToString(result.ETag),
+		VersionId:    aws.ToString(result.VersionId),
+		LastModified: strconv.FormatInt(aws.ToTime(result.LastModified).Unix(), 10),
+	}, nil
 }
 
 func UploadToS3Bucket(ctx context.Context, fileData UploadFileData, s3Client *s3.Client) restApi.Response {
@@ -57,15 +109,216 @@ func UploadToS3Bucket(ctx context.Context, fileData UploadFileData, s3Client *s3
 		return restApi.ApiResponse(http.StatusBadRequest, "Invalid base64 string")
 	}
 
-	input := &s3.PutObjectInput{Bucket: aws.String(bucketName), Key: aws.String(fileData.ObjName), Body: bytes.NewReader(content)}
+	input := &s3.PutObjectInput{Bucket: aws.String(bucketName), Key: aws.String(fileData.ObjName), Body: bytes.NewReader(content), Metadata: fileData.Metadata}
 
-	_, putErr := s3Client.PutObject(ctx, input)
+	output, putErr := s3Client.PutObject(ctx, input)
 
 	if putErr != nil {
 		return restApi.ApiResponse(http.StatusInternalServerError, "Failed to upload object to s3")
 	}
 
-	respBody := map[string]string{"message": fmt.Sprintf("Object [%v] was uploaded", fileData.ObjName)}
+	respBody := map[string]string{"message": fmt.Sprintf("Object [%v] was uploaded", fileData.ObjName), "versionId": aws.ToString(output.VersionId)}
 
 	return restApi.ApiResponse(http.StatusOK, respBody)
 }
+
+type objectVersion struct {
+	key          string
+	versionId    string
+	lastModified time.Time
+	deleteMarker bool
+}
+
+// Replays every version under the prefix on the new one, oldest first so the history keeps its order,
+// and then deletes the original versions. Delete markers are replayed too, so deleted envs stay deleted.
+// Moving the same prefixes again resumes a move that failed part way
+func MoveObjects(ctx context.Context, s3Client *s3.Client, fromPrefix string, toPrefix string) error {
+	versions, err := listObjectVersions(ctx, s3Client, fromPrefix)
+
+	if err != nil {
+		return err
+	}
+
+	movedVersions, err := listObjectVersions(ctx, s3Client, toPrefix)
+
+	if err != nil {
+		return err
+	}
+
+	// The versions already on the new prefix are the oldest ones of each key, and the originals are only deleted
+	// once every version was replayed
+	movedCounts := map[string]int{}
+
+	for _, version := range movedVersions {
+		movedCounts[strings.TrimPrefix(version.key, toPrefix)]++
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].lastModified.Before(versions[j].lastModified)
+	})
+
+	for _, version := range versions {
+		if name := strings.TrimPrefix(version.key, fromPrefix); movedCounts[name] > 0 {
+			movedCounts[name]--
+
+			continue
+		}
+
+		if version.deleteMarker {
+			_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    aws.String(toPrefix + strings.TrimPrefix(version.key, fromPrefix)),
+			})
+
+			if err != nil {
+				return errors.New("failed to copy delete marker")
+			}
+
+			continue
+		}
+
+		copySource := fmt.Sprintf("%s?versionId=%s", (&url.URL{Path: fmt.Sprintf("%s/%s", bucketName, version.key)}).EscapedPath(), version.versionId)
+		_, err := s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucketName),
+			Key:        aws.String(toPrefix + strings.TrimPrefix(version.key, fromPrefix)),
+			CopySource: aws.String(copySource),
+		})
+
+		if err != nil {
+			return errors.New("failed to copy object version")
+		}
+	}
+
+	return deleteObjectVersions(ctx, s3Client, versions)
+}
+
+// Permanently deletes every version, and delete marker, under the prefix, returning the keys that were deleted
+func DeleteObjects(ctx context.Context, s3Client *s3.Client, prefix string) ([]string, error) {
+	versions, err := listObjectVersions(ctx, s3Client, prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	for _, version := range versions {
+		if !slices.Contains(keys, version.key) {
+			keys = append(keys, version.key)
+		}
+	}
+
+	return keys, deleteObjectVersions(ctx, s3Client, versions)
+}
+
+func listObjectVersions(ctx context.Context, s3Client *s3.Client, prefix string) ([]objectVersion, error) {
+	var versions []objectVersion
+
+	paginator := s3.NewListObjectVersionsPaginator(s3Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, errors.New("failed to list object versions")
+		}
+
+		for _, version := range page.Versions {
+			versions = append(versions, objectVersion{key: *version.Key, versionId: *version.VersionId, lastModified: *version.LastModified})
+		}
+
+		for _, marker := range page.DeleteMarkers {
+			versions = append(versions, objectVersion{key: *marker.Key, versionId: *marker.VersionId, lastModified: *marker.LastModified, deleteMarker: true})
+		}
+	}
+
+	return versions, nil
+}
+
+func deleteObjectVersions(ctx context.Context, s3Client *s3.Client, versions []objectVersion) error {
+	// DeleteObjects accepts up to 1000 keys per call
+	for start := 0; start < len(versions); start += 1000 {
+		var objects []types.ObjectIdentifier
+
+		for _, version := range versions[start:min(start+1000, len(versions))] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(version.key), VersionId: aws.String(version.versionId)})
+		}
+
+		_, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+
+		if err != nil {
+			return errors.New("failed to delete object versions")
+		}
+	}
+
+	return nil
+}
+
+// Tells whether any object currently lives under the prefix
+func HasObjects(ctx context.Context, s3Client *s3.Client, prefix string) (bool, error) {
+	result, err := s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(1),
+	})
+
+	if err != nil {
+		return false, errors.New("failed to list objects")
+	}
+
+	return len(result.Contents) > 0, nil
+}
+
+// Returns the names of the folders right under the prefix, without the prefix and the trailing slash
+func ListFolders(ctx context.Context, s3Client *s3.Client, prefix string) ([]string, error) {
+	var folders []string
+
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, errors.New("failed to list folders")
+		}
+
+		for _, commonPrefix := range page.CommonPrefixes {
+			folders = append(folders, strings.TrimSuffix(strings.TrimPrefix(aws.ToString(commonPrefix.Prefix), prefix), "/"))
+		}
+	}
+
+	return folders, nil
+}
+
+// Returns the size of the current version of every object under the prefix
+func ListObjectSizes(ctx context.Context, s3Client *s3.Client, prefix string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, errors.New("failed to list objects")
+		}
+
+		for _, object := range page.Contents {
+			sizes[aws.ToString(object.Key)] = aws.ToInt64(object.Size)
+		}
+	}
+
+	return sizes, nil
+}
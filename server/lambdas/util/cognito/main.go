@@ -0,0 +1,71 @@
+package cognito
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+)
+
+const (
+	ResourceServerIdentifier = "moonenv"
+	EnvReadScope             = ResourceServerIdentifier + "/env:read"
+	EnvWriteScope            = ResourceServerIdentifier + "/env:write"
+)
+
+var (
+	userPoolId = os.Getenv("UserPoolId")
+)
+
+func NewCognito() (*cognitoidentityprovider.CognitoIdentityProvider, error) {
+	Session, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cognitoidentityprovider.New(Session), nil
+}
+
+// Creates an app client that can only use the client credentials grant with the given scopes
+func CreateMachineClient(name string, scopes []string) (*cognitoidentityprovider.UserPoolClientType, error) {
+	client, err := NewCognito()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.CreateUserPoolClient(&cognitoidentityprovider.CreateUserPoolClientInput{
+		UserPoolId:                      aws.String(userPoolId),
+		ClientName:                      aws.String(name),
+		GenerateSecret:                  aws.Bool(true),
+		AllowedOAuthFlows:               aws.StringSlice([]string{"client_credentials"}),
+		AllowedOAuthFlowsUserPoolClient: aws.Bool(true),
+		AllowedOAuthScopes:              aws.StringSlice(scopes),
+		EnableTokenRevocation:           aws.Bool(true),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.UserPoolClient, nil
+}
+
+func DeleteClient(clientId string) error {
+	client, err := NewCognito()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteUserPoolClient(&cognitoidentityprovider.DeleteUserPoolClientInput{
+		UserPoolId: aws.String(userPoolId),
+		ClientId:   aws.String(clientId),
+	})
+
+	return err
+}
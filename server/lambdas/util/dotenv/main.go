@@ -0,0 +1,193 @@
+package dotenv
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Entry struct {
+	Key   string
+	Value string
+	// The lines the entry was read from, so it can be written back untouched
+	Raw string
+}
+
+// Reads the KEY=value entries of a .env file, skipping blank lines and comments.
+// Quoted values can span several lines
+func Parse(content string) []Entry {
+	var (
+		entries []Entry
+		lines   = strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	)
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+
+		if !found {
+			continue
+		}
+
+		var (
+			raw   = []string{lines[i]}
+			quote = getOpeningQuote(strings.TrimSpace(value))
+		)
+
+		value = strings.TrimSpace(value)
+
+		for quote != 0 && !isClosed(value, quote) && i+1 < len(lines) {
+			i++
+			raw = append(raw, lines[i])
+			value += "\n" + lines[i]
+		}
+
+		entries = append(entries, Entry{
+			Key:   strings.TrimSpace(key),
+			Value: unquote(value),
+			Raw:   strings.Join(raw, "\n"),
+		})
+	}
+
+	return entries
+}
+
+// Lists the keys that changed between two versions of a .env file, leaving the values out
+type Changes struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func Diff(before string, after string) Changes {
+	var (
+		changes      = Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}
+		beforeValues = toMap(Parse(before))
+		afterValues  = toMap(Parse(after))
+	)
+
+	for key, value := range afterValues {
+		if beforeValue, ok := beforeValues[key]; !ok {
+			changes.Added = append(changes.Added, key)
+		} else if beforeValue != value {
+			changes.Changed = append(changes.Changed, key)
+		}
+	}
+
+	for key := range beforeValues {
+		if _, ok := afterValues[key]; !ok {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+
+	slices.Sort(changes.Added)
+	slices.Sort(changes.Removed)
+	slices.Sort(changes.Changed)
+
+	return changes
+}
+
+func (changes Changes) IsEmpty() bool {
+	return len(changes.Added) == 0 && len(changes.Removed) == 0 && len(changes.Changed) == 0
+}
+
+func toMap(entries []Entry) map[string]string {
+	values := make(map[string]string, len(entries))
+
+	for _, entry := range entries {
+		values[entry.Key] = entry.Value
+	}
+
+	return values
+}
+
+// Keeps only the entries whose key is in keys
+func FilterKeys(content string, keys []string) string {
+	var lines []string
+
+	for _, entry := range Parse(content) {
+		if slices.Contains(keys, entry.Key) {
+			lines = append(lines, entry.Raw)
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Writes the values as a .env file, sorted by key. Values are quoted when Parse would not read them back as they are,
+// which fails for values holding both kinds of quotes
+func Format(values map[string]string) (string, error) {
+	var (
+		keys    = make([]string, 0, len(values))
+		builder strings.Builder
+	)
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value, err := quote(values[key])
+
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+
+		builder.WriteString(key + "=" + value + "\n")
+	}
+
+	return builder.String(), nil
+}
+
+func quote(value string) (string, error) {
+	needsQuotes := value != strings.TrimSpace(value) || strings.Contains(value, "\n") || getOpeningQuote(value) != 0
+
+	if !needsQuotes {
+		return value, nil
+	}
+
+	if !strings.Contains(value, `"`) {
+		return `"` + value + `"`, nil
+	}
+
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'", nil
+	}
+
+	return "", errors.New("the value holds both single and double quotes")
+}
+
+func getOpeningQuote(value string) byte {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		return value[0]
+	}
+
+	return 0
+}
+
+func isClosed(value string, quote byte) bool {
+	return strings.IndexByte(value[1:], quote) >= 0
+}
+
+// Drops the quotes and anything after the closing one, such as a comment
+func unquote(value string) string {
+	quote := getOpeningQuote(value)
+
+	if quote == 0 || !isClosed(value, quote) {
+		return value
+	}
+
+	return value[1 : strings.IndexByte(value[1:], quote)+1]
+}
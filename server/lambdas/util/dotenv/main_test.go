@@ -0,0 +1,140 @@
+package dotenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Entry
+	}{
+		{"empty", "", nil},
+		{"plain", "A=1\nB=two", []Entry{{"A", "1", "A=1"}, {"B", "two", "B=two"}}},
+		{"comments and blank lines", "# comment\n\nA=1\n  # indented\n", []Entry{{"A", "1", "A=1"}}},
+		{"export prefix", "export A=1", []Entry{{"A", "1", "export A=1"}}},
+		{"spaces around the key and value", "  A = 1  ", []Entry{{"A", "1", "  A = 1  "}}},
+		{"empty value", "A=", []Entry{{"A", "", "A="}}},
+		{"value with an equals sign", "A=b=c", []Entry{{"A", "b=c", "A=b=c"}}},
+		{"line without equals sign", "JUNK\nA=1", []Entry{{"A", "1", "A=1"}}},
+		{"double quotes", `A="x y"`, []Entry{{"A", "x y", `A="x y"`}}},
+		{"single quotes", `A='x "y"'`, []Entry{{"A", `x "y"`, `A='x "y"'`}}},
+		{"comment after the closing quote", `A="x" # note`, []Entry{{"A", "x", `A="x" # note`}}},
+		{"unquoted hash is kept", "A=x#y", []Entry{{"A", "x#y", "A=x#y"}}},
+		{"windows line endings", "A=1\r\nB=2\r\n", []Entry{{"A", "1", "A=1"}, {"B", "2", "B=2"}}},
+		{
+			"multiline quoted value",
+			"KEY=\"-----BEGIN\nabc\n-----END\"\nB=2",
+			[]Entry{{"KEY", "-----BEGIN\nabc\n-----END", "KEY=\"-----BEGIN\nabc\n-----END\""}, {"B", "2", "B=2"}},
+		},
+		{"unclosed quote keeps the rest of the file", "A=\"x\nB=2", []Entry{{"A", "\"x\nB=2", "A=\"x\nB=2"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Parse(test.content); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", test.content, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterKeys(t *testing.T) {
+	content := "# comment\nA=1\nB=\"x\ny\"\nC=3\n"
+
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"no keys", nil, ""},
+		{"unknown key", []string{"D"}, ""},
+		{"keeps the raw lines in file order", []string{"C", "B"}, "B=\"x\ny\"\nC=3\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FilterKeys(content, test.keys); got != test.want {
+				t.Errorf("FilterKeys(%v) = %q, want %q", test.keys, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   Changes
+	}{
+		{"both empty", "", "", Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+		{"new file", "", "B=2\nA=1", Changes{Added: []string{"A", "B"}, Removed: []string{}, Changed: []string{}}},
+		{"deleted file", "A=1", "", Changes{Added: []string{}, Removed: []string{"A"}, Changed: []string{}}},
+		{
+			"added, removed and changed",
+			"A=1\nB=2\nC=3",
+			"A=1\nB=20\nD=4",
+			Changes{Added: []string{"D"}, Removed: []string{"C"}, Changed: []string{"B"}},
+		},
+		{"quoting and comments do not count as changes", "A=x\n# old", "# new\nA=\"x\"", Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+		{"last duplicate wins", "A=1\nA=2", "A=2", Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(test.before, test.after)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff(%q, %q) = %+v, want %+v", test.before, test.after, got, test.want)
+			}
+
+			if got.IsEmpty() != (len(test.want.Added)+len(test.want.Removed)+len(test.want.Changed) == 0) {
+				t.Errorf("Diff(%q, %q).IsEmpty() = %v", test.before, test.after, got.IsEmpty())
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"empty", map[string]string{}, "", false},
+		{"sorted by key", map[string]string{"B": "2", "A": "1"}, "A=1\nB=2\n", false},
+		{"empty value", map[string]string{"A": ""}, "A=\n", false},
+		{"surrounding spaces", map[string]string{"A": " x "}, "A=\" x \"\n", false},
+		{"newline", map[string]string{"A": "x\ny"}, "A=\"x\ny\"\n", false},
+		{"leading double quote", map[string]string{"A": `"x`}, "A='\"x'\n", false},
+		{"leading single quote", map[string]string{"A": "'x"}, "A=\"'x\"\n", false},
+		{"quotes inside are kept as they are", map[string]string{"A": `x"y`}, "A=x\"y\n", false},
+		{"both quotes", map[string]string{"A": `"x'`}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Format(test.values)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Format(%q) error = %v, want error %v", test.values, err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Fatalf("Format(%q) = %q, want %q", test.values, got, test.want)
+			}
+
+			if test.wantErr {
+				return
+			}
+
+			if parsed := toMap(Parse(got)); len(test.values) > 0 && !reflect.DeepEqual(parsed, test.values) {
+				t.Errorf("Parse(Format(%q)) = %q, want the same values back", test.values, parsed)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
@@ -20,3 +21,18 @@ func NewDynamodb() (*dynamodb.DynamoDB, error) {
 
 	return dynamodbService.New(Session), nil
 }
+
+// Tells whether the write was rejected by its condition expression, including inside a transaction
+func IsConditionalCheckFailed(err error) bool {
+	if canceledErr, ok := err.(*dynamodbService.TransactionCanceledException); ok {
+		for _, reason := range canceledErr.CancellationReasons {
+			if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+
+	awsErr, ok := err.(awserr.Error)
+
+	return ok && awsErr.Code() == dynamodbService.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,143 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+var ErrMalformed = errors.New("malformed sealed value")
+
+func newKms() (*kms.KMS, error) {
+	newSession, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return kms.New(newSession), nil
+}
+
+// Asks KMS for a new AES-256 key. The plaintext key is only kept in memory; the encrypted one is stored next to the data
+func NewDataKey(keyId string) ([]byte, string, error) {
+	client, err := newKms()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := client.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyId),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result.Plaintext, base64.StdEncoding.EncodeToString(result.CiphertextBlob), nil
+}
+
+// Decrypts a data key made by NewDataKey
+func OpenDataKey(encryptedKey string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(encryptedKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newKms()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Decrypt(&kms.DecryptInput{CiphertextBlob: blob})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Plaintext, nil
+}
+
+// Asks KMS for the HMAC of the message with an HMAC key, which never leaves KMS. The same message always gives the
+// same key, so it can be used to derive a local key without storing it anywhere
+func DeriveKey(keyId string, message string) ([]byte, error) {
+	client, err := newKms()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GenerateMac(&kms.GenerateMacInput{
+		KeyId:        aws.String(keyId),
+		MacAlgorithm: aws.String(kms.MacAlgorithmSpecHmacSha256),
+		Message:      []byte(message),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Mac, nil
+}
+
+// Encrypts the value with AES-GCM. The context is authenticated but not stored, so a sealed value copied to
+// another record or field fails to open
+func Seal(key []byte, value string, context string) (string, error) {
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), []byte(context))), nil
+}
+
+func Open(key []byte, sealed string, context string) (string, error) {
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(context))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+type Type string
+
+const (
+	TypeEnvPushed   Type = "env.pushed"
+	TypeEnvPulled   Type = "env.pulled"
+	TypeEnvDeleted  Type = "env.deleted"
+	TypeAuthLogin   Type = "auth.login"
+	TypeAuthRevoked Type = "auth.revoked"
+	// A refresh token was used after it had been rotated, so it was most likely copied from the device
+	TypeAuthRefreshTokenReused Type = "auth.refresh-token-reused"
+)
+
+// Every event on the bus comes from this source, so rules can match on it
+const Source = "moonenv"
+
+type Event struct {
+	Type       Type   `json:"type"`
+	OrgId      string `json:"orgId,omitempty"`
+	RepoId     string `json:"repoId,omitempty"`
+	Env        string `json:"env,omitempty"`
+	VersionId  string `json:"versionId,omitempty"`
+	ActorId    string `json:"actorId,omitempty"`
+	ClientId   string `json:"clientId,omitempty"`
+	OccurredAt string `json:"occurredAt"`
+}
+
+type Publisher interface {
+	Publish(events ...Event) error
+}
+
+type EventBridgePublisher struct {
+	client  *eventbridge.EventBridge
+	busName string
+}
+
+// Keeps the events in memory, so tests and local runs can look at what was published
+type MemorySink struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+var (
+	publisher      Publisher
+	publisherMutex sync.Mutex
+)
+
+func NewEventBridgePublisher() (*EventBridgePublisher, error) {
+	Session, err := session.NewSession(&aws.Config{
+		Region: aws.String(os.Getenv("AWS_REGION")),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventBridgePublisher{client: eventbridge.New(Session), busName: os.Getenv("EventBusName")}, nil
+}
+
+func (publisher *EventBridgePublisher) Publish(events ...Event) error {
+	// PutEvents accepts up to 10 entries per call
+	for start := 0; start < len(events); start += 10 {
+		var entries []*eventbridge.PutEventsRequestEntry
+
+		for _, event := range events[start:min(start+10, len(events))] {
+			detail, err := json.Marshal(event)
+
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, &eventbridge.PutEventsRequestEntry{
+				EventBusName: aws.String(publisher.busName),
+				Source:       aws.String(Source),
+				DetailType:   aws.String(string(event.Type)),
+				Detail:       aws.String(string(detail)),
+			})
+		}
+
+		result, err := publisher.client.PutEvents(&eventbridge.PutEventsInput{Entries: entries})
+
+		if err != nil {
+			return err
+		}
+
+		if aws.Int64Value(result.FailedEntryCount) > 0 {
+			return fmt.Errorf("%d events were not published", aws.Int64Value(result.FailedEntryCount))
+		}
+	}
+
+	return nil
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (sink *MemorySink) Publish(events ...Event) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.events = append(sink.events, events...)
+
+	return nil
+}
+
+func (sink *MemorySink) Events() []Event {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return append([]Event(nil), sink.events...)
+}
+
+// Replaces the publisher that Publish uses, such as with a MemorySink in tests
+func SetPublisher(newPublisher Publisher) {
+	publisherMutex.Lock()
+	defer publisherMutex.Unlock()
+
+	publisher = newPublisher
+}
+
+func getPublisher() (Publisher, error) {
+	publisherMutex.Lock()
+	defer publisherMutex.Unlock()
+
+	if publisher != nil {
+		return publisher, nil
+	}
+
+	if os.Getenv("EventBusName") == "" {
+		return nil, errors.New("EventBusName is not set")
+	}
+
+	eventBridgePublisher, err := NewEventBridgePublisher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	publisher = eventBridgePublisher
+
+	return publisher, nil
+}
+
+// Publishes the events, stamping their time. Failures are only logged, so they never fail the request
+func Publish(events ...Event) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	for i := range events {
+		if events[i].OccurredAt == "" {
+			events[i].OccurredAt = now
+		}
+	}
+
+	currentPublisher, err := getPublisher()
+
+	if err == nil {
+		err = currentPublisher.Publish(events...)
+	}
+
+	if err != nil {
+		log.Printf("Failed to publish %d events: %v", len(events), err)
+	}
+}
@@ -1,6 +1,7 @@
 package oauth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -23,3 +24,33 @@ func GetOAuthUrl() (*url.URL, *restApi.Response) {
 	}
 	return oauthUrl, nil
 }
+
+var ErrInvalidToken = errors.New("the token is invalid or was issued to another client")
+
+// Revokes the refresh token in Cognito, along with the access tokens issued from it
+func RevokeRefreshToken(clientId string, refreshToken string) error {
+	oauthUrl, errResponse := GetOAuthUrl()
+
+	if errResponse != nil {
+		return errors.New("invalid Cognito URL")
+	}
+
+	data := url.Values{}
+	data.Set("client_id", clientId)
+	data.Set("token", refreshToken)
+	oauthUrl.Path = "/oauth2/revoke"
+
+	resp, err := http.PostForm(oauthUrl.String(), data)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
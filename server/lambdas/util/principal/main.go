@@ -0,0 +1,84 @@
+package principal
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+type Type string
+
+const (
+	TypeUser                Type = "user"
+	TypeService             Type = "service"
+	TypePersonalAccessToken Type = "personal_access_token"
+)
+
+type Access string
+
+const (
+	AccessRead  Access = "read"
+	AccessWrite Access = "write"
+)
+
+// The caller, as normalized by the Lambda authorizer out of a Cognito JWT or a personal access token
+type Principal struct {
+	Id     string
+	Type   Type
+	Groups []string
+	Scopes []string
+	// Only set for personal access tokens: the org/repo/env pattern and the access they grant
+	TokenScope  string
+	TokenAccess Access
+}
+
+// API Gateway only passes flat string values from the authorizer to the integrations
+func (principal Principal) ToContext() map[string]interface{} {
+	return map[string]interface{}{
+		"principalId":   principal.Id,
+		"principalType": string(principal.Type),
+		"groups":        strings.Join(principal.Groups, ","),
+		"scopes":        strings.Join(principal.Scopes, " "),
+		"tokenScope":    principal.TokenScope,
+		"tokenAccess":   string(principal.TokenAccess),
+	}
+}
+
+func FromContext(context map[string]interface{}) Principal {
+	get := func(key string) string {
+		value, _ := context[key].(string)
+
+		return value
+	}
+
+	return Principal{
+		Id:          get("principalId"),
+		Type:        Type(get("principalType")),
+		Groups:      strings.FieldsFunc(get("groups"), func(r rune) bool { return r == ',' }),
+		Scopes:      strings.Fields(get("scopes")),
+		TokenScope:  get("tokenScope"),
+		TokenAccess: Access(get("tokenAccess")),
+	}
+}
+
+func (principal Principal) HasScope(scope string) bool {
+	return slices.Contains(principal.Scopes, scope)
+}
+
+// Tells whether a personal access token was scoped to the env with, at least, the given access.
+// The parts are joined as they are, so a name such as ".." cannot step out of the scope
+func (principal Principal) TokenAllows(orgId string, repoId string, env string, access Access) bool {
+	for _, part := range []string{orgId, repoId, env} {
+		if part == "" || strings.Contains(part, "/") || strings.Contains(part, "..") {
+			return false
+		}
+	}
+
+	matched, err := path.Match(principal.TokenScope, orgId+"/"+repoId+"/"+env)
+
+	if err != nil || !matched {
+		return false
+	}
+
+	return access == AccessRead || principal.TokenAccess == AccessWrite
+}
@@ -0,0 +1,63 @@
+package principal
+
+import "testing"
+
+func TestTokenAllows(t *testing.T) {
+	tests := []struct {
+		name        string
+		scope       string
+		tokenAccess Access
+		orgId       string
+		repoId      string
+		env         string
+		access      Access
+		want        bool
+	}{
+		{"exact env", "acme/api/prod", AccessRead, "acme", "api", "prod", AccessRead, true},
+		{"wildcard env", "acme/api/*", AccessRead, "acme", "api", "dev", AccessRead, true},
+		{"wildcard repo", "acme/*/dev", AccessRead, "acme", "web", "dev", AccessRead, true},
+		{"other env", "acme/api/dev", AccessRead, "acme", "api", "prod", AccessRead, false},
+		{"other org", "acme/*/*", AccessRead, "globex", "api", "dev", AccessRead, false},
+		{"wildcard does not cross a slash", "acme/*", AccessRead, "acme", "api", "dev", AccessRead, false},
+		{"read token cannot write", "acme/api/dev", AccessRead, "acme", "api", "dev", AccessWrite, false},
+		{"write token can read", "acme/api/dev", AccessWrite, "acme", "api", "dev", AccessRead, true},
+		{"write token can write", "acme/api/dev", AccessWrite, "acme", "api", "dev", AccessWrite, true},
+		{"dot dot repo", "acme/api/*", AccessRead, "acme", "api/prod/..", "dev", AccessRead, false},
+		{"dot dot env", "acme/api/*", AccessRead, "acme", "api", "..", AccessRead, false},
+		{"dot dot steps into another repo", "acme/api/*", AccessRead, "acme", "api", "../web/prod", AccessRead, false},
+		{"slash in env", "acme/api/*", AccessRead, "acme", "api", "dev/x", AccessRead, false},
+		{"empty env", "acme/api/*", AccessRead, "acme", "api", "", AccessRead, false},
+		{"malformed scope", "acme/[", AccessRead, "acme", "api", "dev", AccessRead, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal := Principal{Type: TypePersonalAccessToken, TokenScope: test.scope, TokenAccess: test.tokenAccess}
+
+			if got := principal.TokenAllows(test.orgId, test.repoId, test.env, test.access); got != test.want {
+				t.Errorf("TokenAllows(%q, %q, %q, %q) with scope %q = %v, want %v", test.orgId, test.repoId, test.env, test.access, test.scope, got, test.want)
+			}
+		})
+	}
+}
+
+func TestContextRoundTrip(t *testing.T) {
+	principal := Principal{
+		Id:          "user-1",
+		Type:        TypePersonalAccessToken,
+		Groups:      []string{"admins", "devs"},
+		Scopes:      []string{"moonenv/env.read", "moonenv/env.write"},
+		TokenScope:  "acme/*/dev",
+		TokenAccess: AccessWrite,
+	}
+
+	got := FromContext(principal.ToContext())
+
+	if got.Id != principal.Id || got.Type != principal.Type || got.TokenScope != principal.TokenScope || got.TokenAccess != principal.TokenAccess {
+		t.Fatalf("FromContext(ToContext()) = %+v, want %+v", got, principal)
+	}
+
+	if len(got.Groups) != 2 || len(got.Scopes) != 2 || !got.HasScope("moonenv/env.write") {
+		t.Fatalf("FromContext(ToContext()) lost groups or scopes: %+v", got)
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dynamodb"
+	restApi "github.com/PBH-Tech/moonenv/lambdas/util/rest-api"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbService "github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// How many calls a key can make in each fixed window
+type Limit struct {
+	Scope  string
+	Max    int64
+	Window time.Duration
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	ResetAt   time.Time
+}
+
+var (
+	rateLimitTableName = aws.String(os.Getenv("RateLimitTableName"))
+)
+
+// Counts one call for the key in the current window. Counters expire with their window through the table TTL.
+// When the counter cannot be updated the call is let through, so an outage of the table never takes the API down
+func Take(limit Limit, key string) Result {
+	var (
+		now         = time.Now()
+		windowStart = now.Truncate(limit.Window)
+		resetAt     = windowStart.Add(limit.Window)
+		result      = Result{Allowed: true, Limit: limit.Max, Remaining: limit.Max, ResetAt: resetAt}
+	)
+
+	client, err := dynamodb.NewDynamodb()
+
+	if err != nil {
+		log.Printf("Failed to check the %s rate limit of %s: %v", limit.Scope, key, err)
+
+		return result
+	}
+
+	output, err := client.UpdateItem(&dynamodbService.UpdateItemInput{
+		TableName: rateLimitTableName,
+		Key: map[string]*dynamodbService.AttributeValue{
+			"bucketKey": {S: aws.String(fmt.Sprintf("%s#%s#%d", limit.Scope, key, windowStart.Unix()))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#count) OR #count < :max"),
+		UpdateExpression:    aws.String("ADD #count :one SET expireAt = :expireAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#count": aws.String("count"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodbService.AttributeValue{
+			":one":      {N: aws.String("1")},
+			":max":      {N: aws.String(strconv.FormatInt(limit.Max, 10))},
+			":expireAt": {N: aws.String(strconv.FormatInt(resetAt.Unix(), 10))},
+		},
+		ReturnValues: aws.String(dynamodbService.ReturnValueUpdatedNew),
+	})
+
+	if dynamodb.IsConditionalCheckFailed(err) {
+		result.Allowed = false
+		result.Remaining = 0
+
+		return result
+	} else if err != nil {
+		log.Printf("Failed to check the %s rate limit of %s: %v", limit.Scope, key, err)
+
+		return result
+	}
+
+	if count, ok := output.Attributes["count"]; ok && count.N != nil {
+		used, _ := strconv.ParseInt(*count.N, 10, 64)
+		result.Remaining = max(limit.Max-used, 0)
+	}
+
+	return result
+}
+
+// Tells the caller how much of the limit is left, and when to retry once it is used up
+func SetHeaders(response *restApi.Response, result Result) {
+	if response.Headers == nil {
+		response.Headers = make(map[string]string)
+	}
+
+	response.Headers["X-RateLimit-Limit"] = strconv.FormatInt(result.Limit, 10)
+	response.Headers["X-RateLimit-Remaining"] = strconv.FormatInt(result.Remaining, 10)
+	response.Headers["X-RateLimit-Reset"] = strconv.FormatInt(result.ResetAt.Unix(), 10)
+
+	if !result.Allowed {
+		response.Headers["Retry-After"] = strconv.FormatInt(max(int64(time.Until(result.ResetAt).Seconds()), 1), 10)
+	}
+}
+
+func BuildLimitedResponse(result Result, message string) restApi.Response {
+	response := restApi.BuildErrorResponse(http.StatusTooManyRequests, message)
+
+	SetHeaders(&response, result)
+
+	return response
+}
@@ -2,8 +2,10 @@ package restApi
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"net/url"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -26,6 +28,62 @@ func ApiResponse(statusCode int, body interface{}) Response {
 	return resp
 }
 
+// For pages opened in a browser, such as the login pages. They must not be framed, so no other site can trick users into clicking their buttons
+func HtmlResponse(statusCode int, body string) Response {
+	return Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":            "text/html; charset=utf-8",
+			"Cache-Control":           "no-store",
+			"X-Frame-Options":         "DENY",
+			"Content-Security-Policy": "frame-ancestors 'none'",
+		},
+		Body: body,
+	}
+}
+
+// OAuth clients and HTML forms send their parameters as application/x-www-form-urlencoded bodies
+func ParseForm(req Request) (url.Values, error) {
+	body := req.Body
+
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = string(decoded)
+	}
+
+	return url.ParseQuery(body)
+}
+
+// Returns the value of the cookie, or an empty string when the browser did not send it
+func GetCookie(req Request, name string) string {
+	header := http.Header{}
+
+	for key, values := range req.MultiValueHeaders {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	if len(header.Values("Cookie")) == 0 {
+		for key, value := range req.Headers {
+			header.Add(key, value)
+		}
+	}
+
+	cookie, err := (&http.Request{Header: header}).Cookie(name)
+
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
 func UnhandledMethod() Response {
 	return ApiResponse(http.StatusMethodNotAllowed, "Method not allowed")
 }
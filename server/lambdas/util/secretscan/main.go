@@ -0,0 +1,115 @@
+package secretscan
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"path"
+	"regexp"
+
+	"github.com/PBH-Tech/moonenv/lambdas/util/dotenv"
+)
+
+type Rule string
+
+const (
+	RuleAwsAccessKey   Rule = "aws-access-key"
+	RuleGithubToken    Rule = "github-token"
+	RuleStripeKey      Rule = "stripe-key"
+	RulePrivateKey     Rule = "private-key"
+	RuleHighEntropy    Rule = "high-entropy"
+	RuleDuplicateValue Rule = "duplicate-value"
+)
+
+// Findings name the key and the rule, never the value
+type Finding struct {
+	Key     string `json:"key"`
+	Rule    Rule   `json:"rule"`
+	Message string `json:"message"`
+}
+
+type pattern struct {
+	rule    Rule
+	regexp  *regexp.Regexp
+	message string
+}
+
+const (
+	// Shorter values are too common, such as ports or flags, to be checked for entropy or fingerprinted
+	minSecretLength = 16
+	// Bits per character above which a value looks random rather than written by someone
+	highEntropyThreshold = 4.0
+)
+
+var patterns = []pattern{
+	{RuleAwsAccessKey, regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), "Looks like an AWS access key id"},
+	{RuleGithubToken, regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`), "Looks like a GitHub token"},
+	{RuleStripeKey, regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`), "Looks like a live Stripe key"},
+	{RulePrivateKey, regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`), "Contains a private key"},
+}
+
+// Checks every value for well-known credential formats, and values of the non-sensitive keys for random-looking strings.
+// nonSensitiveKeys are globs on the key name, such as "PUBLIC_*"
+func Scan(entries []dotenv.Entry, nonSensitiveKeys []string) []Finding {
+	var findings []Finding
+
+	for _, entry := range entries {
+		for _, pattern := range patterns {
+			if pattern.regexp.MatchString(entry.Value) {
+				findings = append(findings, Finding{Key: entry.Key, Rule: pattern.rule, Message: pattern.message})
+			}
+		}
+
+		if matchesAny(nonSensitiveKeys, entry.Key) && len(entry.Value) >= minSecretLength && getEntropy(entry.Value) >= highEntropyThreshold {
+			findings = append(findings, Finding{Key: entry.Key, Rule: RuleHighEntropy, Message: "The key is marked as non-sensitive but its value looks like a secret"})
+		}
+	}
+
+	return findings
+}
+
+// Identifies a value without storing it, so the same secret can be found in other repos of the org.
+// The key is kept server side, so a fingerprint cannot be checked against guessed values by whoever reads it.
+// Short values are not fingerprinted, since they are too common to tell anything
+func Fingerprint(key []byte, orgId string, value string) string {
+	if len(value) < minSecretLength {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return orgId + "#" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Shannon entropy in bits per character
+func getEntropy(value string) float64 {
+	var (
+		counts  = make(map[rune]int)
+		length  = 0
+		entropy = 0.0
+	)
+
+	for _, char := range value {
+		counts[char]++
+		length++
+	}
+
+	for _, count := range counts {
+		probability := float64(count) / float64(length)
+		entropy -= probability * math.Log2(probability)
+	}
+
+	return entropy
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, key); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
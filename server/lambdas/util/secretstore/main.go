@@ -0,0 +1,224 @@
+package secretstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// SSM allows a few writes per second, so throttled calls are retried for a while before giving up
+const maxRetries = 10
+
+func NewSession() (*session.Session, error) {
+	return session.NewSession(&aws.Config{
+		Region:     aws.String(os.Getenv("AWS_REGION")),
+		MaxRetries: aws.Int(maxRetries),
+	})
+}
+
+// Tags the parameters and secrets a sync creates, so it only ever deletes what it wrote itself
+const OwnerTagKey = "moonenv:sync-target"
+
+// Writes every key as a SecureString under the path and deletes the parameters it created earlier for keys that
+// are not in values anymore. Parameters that already existed are overwritten but never deleted.
+// SSM rejects empty values, so those keys are skipped and returned
+func WriteParameters(client *ssm.SSM, parameterPath string, owner string, values map[string]string) ([]string, error) {
+	var (
+		prefix      = getParameterPrefix(parameterPath)
+		skippedKeys []string
+	)
+
+	for key, value := range values {
+		if value == "" {
+			skippedKeys = append(skippedKeys, key)
+
+			continue
+		}
+
+		if err := putParameter(client, prefix+key, value, owner); err != nil {
+			return skippedKeys, fmt.Errorf("failed to write %s: %w", key, err)
+		}
+	}
+
+	owned, err := listOwnedParameters(client, parameterPath, owner)
+
+	if err != nil {
+		return skippedKeys, err
+	}
+
+	var staleNames []*string
+
+	for _, name := range owned {
+		if value, ok := values[strings.TrimPrefix(name, prefix)]; !ok || value == "" {
+			staleNames = append(staleNames, aws.String(name))
+		}
+	}
+
+	// DeleteParameters accepts up to 10 names per call
+	for start := 0; start < len(staleNames); start += 10 {
+		names := staleNames[start:min(start+10, len(staleNames))]
+
+		if _, err := client.DeleteParameters(&ssm.DeleteParametersInput{Names: names}); err != nil {
+			return skippedKeys, fmt.Errorf("failed to delete the removed keys: %w", err)
+		}
+	}
+
+	slices.Sort(skippedKeys)
+
+	return skippedKeys, nil
+}
+
+// Creates the parameter tagged with its owner, or overwrites it, keeping its tags, when it already exists.
+// SSM does not accept tags on an overwrite
+func putParameter(client *ssm.SSM, name string, value string, owner string) error {
+	_, err := client.PutParameter(&ssm.PutParameterInput{
+		Name:  aws.String(name),
+		Value: aws.String(value),
+		Type:  aws.String(ssm.ParameterTypeSecureString),
+		Tags:  []*ssm.Tag{{Key: aws.String(OwnerTagKey), Value: aws.String(owner)}},
+	})
+
+	var awsErr awserr.Error
+
+	if errors.As(err, &awsErr) && awsErr.Code() == ssm.ErrCodeParameterAlreadyExists {
+		_, err = client.PutParameter(&ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(value),
+			Type:      aws.String(ssm.ParameterTypeSecureString),
+			Overwrite: aws.Bool(true),
+		})
+	}
+
+	return err
+}
+
+// Returns the names of the parameters right under the path that carry the owner tag
+func listOwnedParameters(client *ssm.SSM, parameterPath string, owner string) ([]string, error) {
+	var names []string
+
+	err := client.DescribeParametersPages(&ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{Key: aws.String("Path"), Option: aws.String("OneLevel"), Values: []*string{aws.String(strings.TrimSuffix(getParameterPrefix(parameterPath), "/"))}},
+			{Key: aws.String("tag:" + OwnerTagKey), Values: []*string{aws.String(owner)}},
+		},
+	}, func(page *ssm.DescribeParametersOutput, _ bool) bool {
+		for _, parameter := range page.Parameters {
+			names = append(names, aws.StringValue(parameter.Name))
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the synced parameters: %w", err)
+	}
+
+	return names, nil
+}
+
+// Returns the decrypted parameters right under the path, keyed by their name without the path
+func ReadParameters(client *ssm.SSM, parameterPath string) (map[string]string, error) {
+	var (
+		prefix = getParameterPrefix(parameterPath)
+		values = make(map[string]string)
+	)
+
+	err := client.GetParametersByPathPages(&ssm.GetParametersByPathInput{
+		Path:           aws.String(strings.TrimSuffix(prefix, "/")),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, _ bool) bool {
+		for _, parameter := range page.Parameters {
+			values[strings.TrimPrefix(aws.StringValue(parameter.Name), prefix)] = aws.StringValue(parameter.Value)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the parameters: %w", err)
+	}
+
+	return values, nil
+}
+
+// Replaces the secret value with the values as a JSON object, creating the secret, tagged with its owner, when it
+// does not exist
+func WriteSecret(client *secretsmanager.SecretsManager, secretName string, owner string, values map[string]string) error {
+	secretString, err := json.Marshal(values)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(string(secretString)),
+	})
+
+	if IsNotFound(err) {
+		_, err = client.CreateSecret(&secretsmanager.CreateSecretInput{
+			Name:         aws.String(secretName),
+			SecretString: aws.String(string(secretString)),
+			Tags:         []*secretsmanager.Tag{{Key: aws.String(OwnerTagKey), Value: aws.String(owner)}},
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write the secret: %w", err)
+	}
+
+	return nil
+}
+
+// Reads the keys of a JSON secret. Values that are not strings, such as numbers or nested objects, are kept as JSON
+func ReadSecret(client *secretsmanager.SecretsManager, secretName string) (map[string]string, error) {
+	result, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(secretName)})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the secret: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal([]byte(aws.StringValue(result.SecretString)), &fields); err != nil {
+		return nil, fmt.Errorf("the secret is not a JSON object")
+	}
+
+	values := make(map[string]string, len(fields))
+
+	for key, field := range fields {
+		var value string
+
+		if err := json.Unmarshal(field, &value); err != nil {
+			value = string(field)
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// Tells whether the secret or parameter does not exist
+func IsNotFound(err error) bool {
+	var awsErr awserr.Error
+
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+
+	return awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException || awsErr.Code() == ssm.ErrCodeParameterNotFound
+}
+
+func getParameterPrefix(parameterPath string) string {
+	return strings.TrimSuffix(parameterPath, "/") + "/"
+}
@@ -15,4 +15,295 @@ var (
 			},
 		},
 	}
+	SaveOrgMemberRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("role")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"role": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"reader", "writer", "admin"},
+			},
+		},
+	}
+	AccessRuleSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("users"), jsii.String("groups")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"users": {
+				Type:  awsapigateway.JsonSchemaType_ARRAY,
+				Items: &awsapigateway.JsonSchema{Type: awsapigateway.JsonSchemaType_STRING},
+			},
+			"groups": {
+				Type:  awsapigateway.JsonSchemaType_ARRAY,
+				Items: &awsapigateway.JsonSchema{Type: awsapigateway.JsonSchemaType_STRING},
+			},
+		},
+	}
+	SaveEnvPolicyRequestSchema = awsapigateway.JsonSchema{
+		Type: awsapigateway.JsonSchemaType_OBJECT,
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"read":  &AccessRuleSchema,
+			"write": &AccessRuleSchema,
+			"protected": {
+				Type: awsapigateway.JsonSchemaType_BOOLEAN,
+			},
+		},
+	}
+	OrgSettingsSchema = awsapigateway.JsonSchema{
+		Type: awsapigateway.JsonSchemaType_OBJECT,
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"allowedEnvs": {
+				Type:  awsapigateway.JsonSchemaType_ARRAY,
+				Items: &awsapigateway.JsonSchema{Type: awsapigateway.JsonSchemaType_STRING},
+			},
+			"autoCreateRepos": {
+				Type: awsapigateway.JsonSchemaType_BOOLEAN,
+			},
+			"secretScan": {
+				Type: awsapigateway.JsonSchemaType_OBJECT,
+				Properties: &map[string]*awsapigateway.JsonSchema{
+					"action": {
+						Type: awsapigateway.JsonSchemaType_STRING,
+						Enum: &[]interface{}{"warn", "block", "off"},
+					},
+					"nonSensitiveKeys": {
+						Type:  awsapigateway.JsonSchemaType_ARRAY,
+						Items: &awsapigateway.JsonSchema{Type: awsapigateway.JsonSchemaType_STRING},
+					},
+				},
+			},
+			"lockOverrideRole": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"reader", "writer", "admin", "owner"},
+			},
+			"rotationPolicies": {
+				Type: awsapigateway.JsonSchemaType_ARRAY,
+				Items: &awsapigateway.JsonSchema{
+					Type:     awsapigateway.JsonSchemaType_OBJECT,
+					Required: &[]*string{jsii.String("keyPattern"), jsii.String("maxAgeDays")},
+					Properties: &map[string]*awsapigateway.JsonSchema{
+						"keyPattern": {
+							Type:      awsapigateway.JsonSchemaType_STRING,
+							MinLength: jsii.Number(1),
+						},
+						"maxAgeDays": {
+							Type:    awsapigateway.JsonSchemaType_INTEGER,
+							Minimum: jsii.Number(1),
+						},
+					},
+				},
+			},
+		},
+	}
+	CreateOrgRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("orgId"), jsii.String("displayName")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"orgId": {
+				Type:    awsapigateway.JsonSchemaType_STRING,
+				Pattern: jsii.String("^[a-z0-9][a-z0-9-]{1,62}$"),
+			},
+			"displayName": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"settings": &OrgSettingsSchema,
+		},
+	}
+	UpdateOrgRequestSchema = awsapigateway.JsonSchema{
+		Type: awsapigateway.JsonSchemaType_OBJECT,
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"displayName": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"settings": &OrgSettingsSchema,
+		},
+	}
+	TransferOrgOwnershipRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("userId")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"userId": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+			},
+		},
+	}
+	RepoIdSchema = awsapigateway.JsonSchema{
+		Type:    awsapigateway.JsonSchemaType_STRING,
+		Pattern: jsii.String("^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$"),
+	}
+	CreateRepoRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("repoId")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"repoId": &RepoIdSchema,
+		},
+	}
+	RenameRepoRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("newRepoId")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"newRepoId": &RepoIdSchema,
+		},
+	}
+	CreateServiceCredentialRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("name"), jsii.String("role")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"name": {
+				Type:    awsapigateway.JsonSchemaType_STRING,
+				Pattern: jsii.String("^[A-Za-z0-9._-]{1,64}$"),
+			},
+			"role": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"reader", "writer"},
+			},
+		},
+	}
+	CreatePersonalAccessTokenRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("name"), jsii.String("scope"), jsii.String("access"), jsii.String("expiresInDays")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"name": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+				MaxLength: jsii.Number(100),
+			},
+			"scope": {
+				Type:    awsapigateway.JsonSchemaType_STRING,
+				Pattern: jsii.String("^[^/]+/[^/]+/[^/]+$"),
+			},
+			"access": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"read", "write"},
+			},
+			"expiresInDays": {
+				Type:    awsapigateway.JsonSchemaType_INTEGER,
+				Minimum: jsii.Number(1),
+				Maximum: jsii.Number(365),
+			},
+		},
+	}
+	RenameDeviceRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("name")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"name": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+				MaxLength: jsii.Number(100),
+			},
+		},
+	}
+	CreateShareLinkRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("env"), jsii.String("expiresInMinutes")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"env": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"keys": {
+				Type:  awsapigateway.JsonSchemaType_ARRAY,
+				Items: &awsapigateway.JsonSchema{Type: awsapigateway.JsonSchemaType_STRING},
+			},
+			"maxUses": {
+				Type:    awsapigateway.JsonSchemaType_INTEGER,
+				Minimum: jsii.Number(0),
+			},
+			"expiresInMinutes": {
+				Type:    awsapigateway.JsonSchemaType_INTEGER,
+				Minimum: jsii.Number(1),
+				Maximum: jsii.Number(10080),
+			},
+		},
+	}
+	ReviewChangeRequestRequestSchema = awsapigateway.JsonSchema{
+		Type: awsapigateway.JsonSchemaType_OBJECT,
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"comment": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MaxLength: jsii.Number(1000),
+			},
+		},
+	}
+	CreateWebhookRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("url"), jsii.String("events")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"url": {
+				Type:    awsapigateway.JsonSchemaType_STRING,
+				Pattern: jsii.String("^https://"),
+			},
+			"secret": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(16),
+			},
+			"events": {
+				Type:     awsapigateway.JsonSchemaType_ARRAY,
+				MinItems: jsii.Number(1),
+				Items: &awsapigateway.JsonSchema{
+					Type: awsapigateway.JsonSchemaType_STRING,
+					Enum: &[]interface{}{"push", "delete"},
+				},
+			},
+			"envPattern": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+			},
+		},
+	}
+	CreateSyncTargetRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("env"), jsii.String("type"), jsii.String("destination")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"env": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"type": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"ssm", "secrets-manager"},
+			},
+			"destination": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+		},
+	}
+	ImportEnvRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("type"), jsii.String("source")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"type": {
+				Type: awsapigateway.JsonSchemaType_STRING,
+				Enum: &[]interface{}{"ssm", "secrets-manager"},
+			},
+			"source": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"dryRun": {
+				Type: awsapigateway.JsonSchemaType_BOOLEAN,
+			},
+		},
+	}
+	LockEnvRequestSchema = awsapigateway.JsonSchema{
+		Type:     awsapigateway.JsonSchemaType_OBJECT,
+		Required: &[]*string{jsii.String("env"), jsii.String("reason")},
+		Properties: &map[string]*awsapigateway.JsonSchema{
+			"env": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"reason": {
+				Type:      awsapigateway.JsonSchemaType_STRING,
+				MinLength: jsii.Number(1),
+			},
+			"expiresInMinutes": {
+				Type:    awsapigateway.JsonSchemaType_INTEGER,
+				Minimum: jsii.Number(1),
+			},
+		},
+	}
 )
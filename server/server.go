@@ -51,8 +51,10 @@ func main() {
 			Env:       env(),
 			StackName: jsii.String("moonenv-token-code-table"),
 		},
-		TableName:    *jsii.String("moonenv-token-code"),
-		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("deviceCode"), Type: awsdynamodb.AttributeType_STRING},
+		TableId:             "MoonenvTokenCode",
+		TableName:           *jsii.String("moonenv-token-code"),
+		PartitionKey:        awsdynamodb.Attribute{Name: jsii.String("deviceCode"), Type: awsdynamodb.AttributeType_STRING},
+		TimeToLiveAttribute: jsii.String("expireAt"),
 	})
 
 	tokenCodeStateIndexName := jsii.Sprintf("state-index")
@@ -64,6 +66,239 @@ func main() {
 		},
 	})
 
+	tokenCodeUserCodeIndexName := jsii.Sprintf("user-code-index")
+	tokenCodeTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: tokenCodeUserCodeIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("userCode"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	// Only completed logins have a user, so the index holds the devices of each user
+	tokenCodeUserIndexName := jsii.Sprintf("user-index")
+	tokenCodeTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: tokenCodeUserIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("userId"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		SortKey: &awsdynamodb.Attribute{
+			Name: jsii.String("createdAt"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	orgMemberTable := stacks.NewTableStack(app, "MoonenvOrgMemberDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-org-member-table"),
+		},
+		TableId:      "MoonenvOrgMember",
+		TableName:    *jsii.String("moonenv-org-member"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("userId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	orgMemberUserIndexName := jsii.Sprintf("user-index")
+	orgMemberTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: orgMemberUserIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("userId"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	orgTable := stacks.NewTableStack(app, "MoonenvOrgDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-org-table"),
+		},
+		TableId:      "MoonenvOrg",
+		TableName:    *jsii.String("moonenv-org"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	repoTable := stacks.NewTableStack(app, "MoonenvRepoDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-repo-table"),
+		},
+		TableId:      "MoonenvRepo",
+		TableName:    *jsii.String("moonenv-repo"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("repoId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	envPolicyTable := stacks.NewTableStack(app, "MoonenvEnvPolicyDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-env-policy-table"),
+		},
+		TableId:      "MoonenvEnvPolicy",
+		TableName:    *jsii.String("moonenv-env-policy"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("envPath"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	auditLogTable := stacks.NewTableStack(app, "MoonenvAuditLogDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-audit-log-table"),
+		},
+		TableId:      "MoonenvAuditLog",
+		TableName:    *jsii.String("moonenv-audit-log"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("eventId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	serviceCredentialTable := stacks.NewTableStack(app, "MoonenvServiceCredentialDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-service-credential-table"),
+		},
+		TableId:      "MoonenvServiceCredential",
+		TableName:    *jsii.String("moonenv-service-credential"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("credentialId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	personalAccessTokenTable := stacks.NewTableStack(app, "MoonenvPersonalAccessTokenDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-personal-access-token-table"),
+		},
+		TableId:      "MoonenvPersonalAccessToken",
+		TableName:    *jsii.String("moonenv-personal-access-token"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("tokenHash"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	personalAccessTokenUserIndexName := jsii.Sprintf("user-index")
+	personalAccessTokenTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: personalAccessTokenUserIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("userId"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	shareLinkTable := stacks.NewTableStack(app, "MoonenvShareLinkDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-share-link-table"),
+		},
+		TableId:      "MoonenvShareLink",
+		TableName:    *jsii.String("moonenv-share-link"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("linkId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	shareLinkOrgIndexName := jsii.Sprintf("org-index")
+	shareLinkTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: shareLinkOrgIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("orgId"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		SortKey: &awsdynamodb.Attribute{
+			Name: jsii.String("envPath"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	changeRequestTable := stacks.NewTableStack(app, "MoonenvChangeRequestDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-change-request-table"),
+		},
+		TableId:      "MoonenvChangeRequest",
+		TableName:    *jsii.String("moonenv-change-request"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("changeRequestId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	webhookTable := stacks.NewTableStack(app, "MoonenvWebhookDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-webhook-table"),
+		},
+		TableId:      "MoonenvWebhook",
+		TableName:    *jsii.String("moonenv-webhook"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("webhookId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	webhookDeliveryTable := stacks.NewTableStack(app, "MoonenvWebhookDeliveryDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-webhook-delivery-table"),
+		},
+		TableId:      "MoonenvWebhookDelivery",
+		TableName:    *jsii.String("moonenv-webhook-delivery"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("webhookId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("deliveryId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	syncTargetTable := stacks.NewTableStack(app, "MoonenvSyncTargetDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-sync-target-table"),
+		},
+		TableId:      "MoonenvSyncTarget",
+		TableName:    *jsii.String("moonenv-sync-target"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("targetId"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	keyRotationTable := stacks.NewTableStack(app, "MoonenvKeyRotationDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-key-rotation-table"),
+		},
+		TableId:      "MoonenvKeyRotation",
+		TableName:    *jsii.String("moonenv-key-rotation"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("keyPath"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	envLockTable := stacks.NewTableStack(app, "MoonenvEnvLockDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-env-lock-table"),
+		},
+		TableId:      "MoonenvEnvLock",
+		TableName:    *jsii.String("moonenv-env-lock"),
+		PartitionKey: awsdynamodb.Attribute{Name: jsii.String("orgId"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("envPath"), Type: awsdynamodb.AttributeType_STRING},
+	})
+
+	rateLimitTable := stacks.NewTableStack(app, "MoonenvRateLimitDynamoDb", &stacks.CdkTableStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-rate-limit-table"),
+		},
+		TableId:             "MoonenvRateLimit",
+		TableName:           *jsii.String("moonenv-rate-limit"),
+		PartitionKey:        awsdynamodb.Attribute{Name: jsii.String("bucketKey"), Type: awsdynamodb.AttributeType_STRING},
+		TimeToLiveAttribute: jsii.String("expireAt"),
+	})
+
+	keyRotationFingerprintIndexName := jsii.Sprintf("fingerprint-index")
+	keyRotationTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: keyRotationFingerprintIndexName,
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("fingerprint"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	eventBus := stacks.NewEventBusStack(app, "MoonenvEventBusStack", &stacks.CdkEventBusStackProps{
+		StackProps: awscdk.StackProps{
+			Env:       env(),
+			StackName: jsii.String("moonenv-event-bus"),
+		},
+		EventBusName: jsii.String("moonenv-events"),
+	})
+
 	cognitoStack := stacks.NewCognitoStack(app, "MoonenvCognitoStack", &stacks.CdkCognitoStackProps{
 		StackProps: awscdk.StackProps{
 			Env:       env(),
@@ -78,11 +313,35 @@ func main() {
 			Env:       env(),
 			StackName: jsii.String("moonenv-lambda"),
 		},
-		Bucket:                  bucket,
-		TokenCodeTable:          tokenCodeTable,
-		TokenCodeStateIndexName: tokenCodeStateIndexName,
-		AuthSubdomain:           config.AuthSubdomain,
-		RestApiSubdomain:        config.RestApiSubdomain,
+		Bucket:                           bucket,
+		TokenCodeTable:                   tokenCodeTable,
+		TokenCodeStateIndexName:          tokenCodeStateIndexName,
+		TokenCodeUserCodeIndexName:       tokenCodeUserCodeIndexName,
+		TokenCodeUserIndexName:           tokenCodeUserIndexName,
+		OrgTable:                         orgTable,
+		OrgMemberTable:                   orgMemberTable,
+		OrgMemberUserIndexName:           orgMemberUserIndexName,
+		RepoTable:                        repoTable,
+		EnvPolicyTable:                   envPolicyTable,
+		AuditLogTable:                    auditLogTable,
+		ServiceCredentialTable:           serviceCredentialTable,
+		PersonalAccessTokenTable:         personalAccessTokenTable,
+		PersonalAccessTokenUserIndexName: personalAccessTokenUserIndexName,
+		ShareLinkTable:                   shareLinkTable,
+		ShareLinkOrgIndexName:            shareLinkOrgIndexName,
+		ChangeRequestTable:               changeRequestTable,
+		WebhookTable:                     webhookTable,
+		WebhookDeliveryTable:             webhookDeliveryTable,
+		SyncTargetTable:                  syncTargetTable,
+		KeyRotationTable:                 keyRotationTable,
+		KeyRotationFingerprintIndexName:  keyRotationFingerprintIndexName,
+		EnvLockTable:                     envLockTable,
+		RateLimitTable:                   rateLimitTable,
+		EventBus:                         eventBus,
+		UserPool:                         cognitoStack.UserPool,
+		UserPoolClientId:                 cognitoStack.CfnUserPoolClient.Ref(),
+		AuthSubdomain:                    config.AuthSubdomain,
+		RestApiSubdomain:                 config.RestApiSubdomain,
 	})
 
 	stacks.NewApiGatewayStack(app, "MoonenvApiGatewayStack", &stacks.CdkApiGatewayProps{
@@ -4,8 +4,8 @@ import (
 	"github.com/PBH-Tech/moonenv/schema"
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
-	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsroute53"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsroute53targets"
 	"github.com/aws/constructs-go/constructs/v10"
@@ -30,8 +30,21 @@ func NewApiGatewayStack(scope constructs.Construct, id string, props *CdkApiGate
 	}
 	stack := awscdk.NewStack(scope, &id, &sProps)
 
+	// Throttles the whole API, with a tighter limit on starting logins since it does not require authentication.
+	// Per-user and per-org limits are applied by the lambdas
 	api := awsapigateway.NewRestApi(stack, jsii.String("MoonenvRestApi"), &awsapigateway.RestApiProps{
-		RestApiName: jsii.Sprintf("moonenv-rest-api"),
+		RestApiName:      jsii.Sprintf("moonenv-rest-api"),
+		ApiKeySourceType: awsapigateway.ApiKeySourceType_AUTHORIZER,
+		DeployOptions: &awsapigateway.StageOptions{
+			ThrottlingRateLimit:  jsii.Number(100),
+			ThrottlingBurstLimit: jsii.Number(200),
+			MethodOptions: &map[string]*awsapigateway.MethodDeploymentOptions{
+				"/auth/device_authorization/POST": {
+					ThrottlingRateLimit:  jsii.Number(5),
+					ThrottlingBurstLimit: jsii.Number(10),
+				},
+			},
+		},
 	})
 
 	customDomain := api.AddDomainName(jsii.String("MoonenvRestApiDomainName"), &awsapigateway.DomainNameOptions{
@@ -46,24 +59,94 @@ func NewApiGatewayStack(scope constructs.Construct, id string, props *CdkApiGate
 	})
 
 	createAuthResource(api, props)
-	createOrgResource(stack, api, props)
+	authorizer := getAuthorizer(stack, props.CdkLambdaStackFunctions.authorizer)
+
+	createOrgResource(stack, api, props, authorizer)
+	createTokenResource(stack, api, props, authorizer)
+	createDeviceResource(stack, api, props, authorizer)
+	createShareResource(api, props)
+	addUsagePlans(api)
 
 	awscdk.NewCfnOutput(stack, jsii.String("MoonenvApiGatewayUrl"), &awscdk.CfnOutputProps{Value: api.Url()})
 }
 
-func getAuthorizer(stack awscdk.Stack, userPool awscognito.UserPool) awsapigateway.CognitoUserPoolsAuthorizer {
-	authorizer := awsapigateway.NewCognitoUserPoolsAuthorizer(stack, jsii.String("MoonenvCognitoAuthorizer"), &awsapigateway.CognitoUserPoolsAuthorizerProps{
-		CognitoUserPools: &[]awscognito.IUserPool{userPool},
-		AuthorizerName:   jsii.String("moonenv-cognito-authorizer"),
+// The API keys of the usage plans. Callers never send them: the authorizer returns the one of the caller's plan
+const (
+	defaultUsageKey     = "moonenv-default-usage-key"
+	integrationUsageKey = "moonenv-integration-usage-key"
+)
+
+// Signed in users and personal access tokens share the default plan, and service credentials the integration one.
+// Usage plans only apply to methods that require an API key, so every method behind the authorizer requires one
+func addUsagePlans(api awsapigateway.RestApi) {
+	plans := []struct {
+		id        string
+		name      string
+		key       string
+		rateLimit float64
+		burst     float64
+		quota     float64
+	}{
+		{"MoonenvUsagePlan", "moonenv-default", defaultUsageKey, 50, 100, 500000},
+		{"MoonenvIntegrationUsagePlan", "moonenv-integrations", integrationUsageKey, 20, 40, 100000},
+	}
+
+	for _, plan := range plans {
+		usagePlan := api.AddUsagePlan(jsii.String(plan.id), &awsapigateway.UsagePlanProps{
+			Name: jsii.String(plan.name),
+			Throttle: &awsapigateway.ThrottleSettings{
+				RateLimit:  jsii.Number(plan.rateLimit),
+				BurstLimit: jsii.Number(plan.burst),
+			},
+			Quota: &awsapigateway.QuotaSettings{
+				Limit:  jsii.Number(plan.quota),
+				Period: awsapigateway.Period_DAY,
+			},
+			ApiStages: &[]*awsapigateway.UsagePlanPerApiStage{{Api: api, Stage: api.DeploymentStage()}},
+		})
+
+		usagePlan.AddApiKey(api.AddApiKey(jsii.String(plan.id+"Key"), &awsapigateway.ApiKeyOptions{
+			ApiKeyName: jsii.String(plan.name),
+			Value:      jsii.String(plan.key),
+		}), nil)
+	}
+
+	for _, method := range *api.Methods() {
+		cfnMethod := method.Node().DefaultChild().(awsapigateway.CfnMethod)
+
+		if authorizationType := cfnMethod.AuthorizationType(); authorizationType != nil && *authorizationType == string(awsapigateway.AuthorizationType_CUSTOM) {
+			cfnMethod.SetApiKeyRequired(jsii.Bool(true))
+		}
+	}
+}
+
+// Accepts Cognito JWTs and personal access tokens. Results are not cached, so revoked tokens stop working right away
+func getAuthorizer(stack awscdk.Stack, function awslambda.IFunction) awsapigateway.RequestAuthorizer {
+	// The authorizer grants API Gateway the right to invoke its handler in the scope of the handler, so it is imported
+	// into this stack to keep the permission here and avoid a cycle with the lambda stack
+	handler := awslambda.Function_FromFunctionAttributes(stack, jsii.String("MoonenvAuthorizerFunction"), &awslambda.FunctionAttributes{
+		FunctionArn:     function.FunctionArn(),
+		SameEnvironment: jsii.Bool(true),
+	})
+	authorizer := awsapigateway.NewRequestAuthorizer(stack, jsii.String("MoonenvAuthorizer"), &awsapigateway.RequestAuthorizerProps{
+		Handler:         handler,
+		AuthorizerName:  jsii.String("moonenv-authorizer"),
+		IdentitySources: jsii.Strings(*awsapigateway.IdentitySource_Header(jsii.String("Authorization"))),
+		ResultsCacheTtl: awscdk.Duration_Seconds(jsii.Number(0)),
 	})
 
 	return authorizer
 }
 
-func createOrgResource(stack awscdk.Stack, api awsapigateway.RestApi, props *CdkApiGatewayProps) {
+func createOrgResource(stack awscdk.Stack, api awsapigateway.RestApi, props *CdkApiGatewayProps, authorizer awsapigateway.IAuthorizer) {
 	lambdas := props.CdkLambdaStackFunctions
-	authorizer := getAuthorizer(stack, props.CognitoStack.UserPool)
-	orgResource := api.Root().AddResource(jsii.String("orgs"), &awsapigateway.ResourceOptions{})
+	// Service credentials and personal access tokens can pull and push but cannot manage the org;
+	// the lambdas check it from the principal that the authorizer passes on
+	orgResource := api.Root().AddResource(jsii.String("orgs"), &awsapigateway.ResourceOptions{
+		DefaultMethodOptions: &awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+		},
+	})
 	orgIdResource := orgResource.AddResource(jsii.String("{orgId}"), &awsapigateway.ResourceOptions{})
 	repoResource := orgIdResource.AddResource(jsii.String("repos"), &awsapigateway.ResourceOptions{})
 	repoIdResource := repoResource.AddResource(jsii.String("{repoId}"), &awsapigateway.ResourceOptions{})
@@ -73,13 +156,63 @@ func createOrgResource(stack awscdk.Stack, api awsapigateway.RestApi, props *Cdk
 		ModelName:   jsii.String("PushCommand"),
 		Schema:      &schema.PushCommandRequestSchema,
 	})
+	saveOrgMemberModel := awsapigateway.NewModel(stack, jsii.String("SaveOrgMemberModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("SaveOrgMember"),
+		Schema:      &schema.SaveOrgMemberRequestSchema,
+	})
+	saveEnvPolicyModel := awsapigateway.NewModel(stack, jsii.String("SaveEnvPolicyModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("SaveEnvPolicy"),
+		Schema:      &schema.SaveEnvPolicyRequestSchema,
+	})
+	createOrgModel := awsapigateway.NewModel(stack, jsii.String("CreateOrgModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateOrg"),
+		Schema:      &schema.CreateOrgRequestSchema,
+	})
+	updateOrgModel := awsapigateway.NewModel(stack, jsii.String("UpdateOrgModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("UpdateOrg"),
+		Schema:      &schema.UpdateOrgRequestSchema,
+	})
+	transferOrgModel := awsapigateway.NewModel(stack, jsii.String("TransferOrgModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("TransferOrgOwnership"),
+		Schema:      &schema.TransferOrgOwnershipRequestSchema,
+	})
+	createRepoModel := awsapigateway.NewModel(stack, jsii.String("CreateRepoModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateRepo"),
+		Schema:      &schema.CreateRepoRequestSchema,
+	})
+	renameRepoModel := awsapigateway.NewModel(stack, jsii.String("RenameRepoModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("RenameRepo"),
+		Schema:      &schema.RenameRepoRequestSchema,
+	})
+	createServiceCredentialModel := awsapigateway.NewModel(stack, jsii.String("CreateServiceCredentialModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateServiceCredential"),
+		Schema:      &schema.CreateServiceCredentialRequestSchema,
+	})
 
 	repoIdResource.AddMethod(jsii.String(*jsii.String("GET")),
 		awsapigateway.NewLambdaIntegration(lambdas.pullCommand, &awsapigateway.LambdaIntegrationOptions{}),
-		&awsapigateway.MethodOptions{Authorizer: authorizer, RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
-			ValidateRequestParameters: jsii.Bool(true),
-			RequestValidatorName:      jsii.String("pull-command-validator"),
-		}})
+		&awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+			RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+				ValidateRequestParameters: jsii.Bool(true),
+				RequestValidatorName:      jsii.String("pull-command-validator"),
+			}})
 	repoIdResource.AddMethod(jsii.String(*jsii.String("POST")),
 		awsapigateway.NewLambdaIntegration(lambdas.pushCommand, &awsapigateway.LambdaIntegrationOptions{}),
 		&awsapigateway.MethodOptions{
@@ -94,6 +227,364 @@ func createOrgResource(stack awscdk.Stack, api awsapigateway.RestApi, props *Cdk
 			},
 		})
 
+	importEnvModel := awsapigateway.NewModel(stack, jsii.String("ImportEnvModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("ImportEnv"),
+		Schema:      &schema.ImportEnvRequestSchema,
+	})
+	repoIdResource.AddResource(jsii.String("import"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"),
+			awsapigateway.NewLambdaIntegration(lambdas.pushCommand, &awsapigateway.LambdaIntegrationOptions{}),
+			&awsapigateway.MethodOptions{
+				Authorizer: authorizer,
+				RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+					ValidateRequestParameters: jsii.Bool(true),
+					RequestValidatorName:      jsii.String("import-env-validator"),
+					ValidateRequestBody:       jsii.Bool(true),
+				},
+				RequestParameters: &map[string]*bool{
+					"method.request.querystring.env": jsii.Bool(true),
+				},
+				RequestModels: &map[string]awsapigateway.IModel{
+					"application/json": importEnvModel,
+				},
+			})
+
+	orgIntegration := awsapigateway.NewLambdaIntegration(lambdas.org, &awsapigateway.LambdaIntegrationOptions{})
+
+	orgResource.AddMethod(jsii.String("GET"), orgIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	orgResource.AddMethod(jsii.String("POST"), orgIntegration, &awsapigateway.MethodOptions{
+		Authorizer: authorizer,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-org-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createOrgModel,
+		},
+	})
+	orgIdResource.AddMethod(jsii.String("GET"), orgIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	orgIdResource.AddMethod(jsii.String("PATCH"), orgIntegration, &awsapigateway.MethodOptions{
+		Authorizer: authorizer,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("update-org-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": updateOrgModel,
+		},
+	})
+	orgIdResource.AddResource(jsii.String("transfer"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"),
+			awsapigateway.NewLambdaIntegration(lambdas.transferOrg, &awsapigateway.LambdaIntegrationOptions{}),
+			&awsapigateway.MethodOptions{
+				Authorizer: authorizer,
+				RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+					RequestValidatorName: jsii.String("transfer-org-validator"),
+					ValidateRequestBody:  jsii.Bool(true),
+				},
+				RequestModels: &map[string]awsapigateway.IModel{
+					"application/json": transferOrgModel,
+				},
+			})
+
+	repoIntegration := awsapigateway.NewLambdaIntegration(lambdas.repo, &awsapigateway.LambdaIntegrationOptions{})
+	archiveResource := repoIdResource.AddResource(jsii.String("archive"), &awsapigateway.ResourceOptions{})
+
+	repoResource.AddMethod(jsii.String("GET"), repoIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	repoResource.AddMethod(jsii.String("POST"), repoIntegration, &awsapigateway.MethodOptions{
+		Authorizer: authorizer,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-repo-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createRepoModel,
+		},
+	})
+	repoIdResource.AddMethod(jsii.String("DELETE"), repoIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	repoIdResource.AddResource(jsii.String("rename"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), repoIntegration, &awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+			RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+				RequestValidatorName: jsii.String("rename-repo-validator"),
+				ValidateRequestBody:  jsii.Bool(true),
+			},
+			RequestModels: &map[string]awsapigateway.IModel{
+				"application/json": renameRepoModel,
+			},
+		})
+	archiveResource.AddMethod(jsii.String("POST"), repoIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	archiveResource.AddMethod(jsii.String("DELETE"), repoIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+
+	orgMembersIntegration := awsapigateway.NewLambdaIntegration(lambdas.orgMembers, &awsapigateway.LambdaIntegrationOptions{})
+	membersResource := orgIdResource.AddResource(jsii.String("members"), &awsapigateway.ResourceOptions{})
+	memberIdResource := membersResource.AddResource(jsii.String("{userId}"), &awsapigateway.ResourceOptions{})
+
+	membersResource.AddMethod(jsii.String("GET"), orgMembersIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+	memberIdResource.AddMethod(jsii.String("PUT"), orgMembersIntegration,
+		&awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+			RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+				RequestValidatorName: jsii.String("save-org-member-validator"),
+				ValidateRequestBody:  jsii.Bool(true),
+			},
+			RequestModels: &map[string]awsapigateway.IModel{
+				"application/json": saveOrgMemberModel,
+			},
+		})
+	memberIdResource.AddMethod(jsii.String("DELETE"), orgMembersIntegration, &awsapigateway.MethodOptions{Authorizer: authorizer})
+
+	envQueryParameters := &map[string]*bool{"method.request.querystring.env": jsii.Bool(true)}
+	envPolicyIntegration := awsapigateway.NewLambdaIntegration(lambdas.envPolicy, &awsapigateway.LambdaIntegrationOptions{})
+	policyResource := repoIdResource.AddResource(jsii.String("policy"), &awsapigateway.ResourceOptions{})
+
+	policyResource.AddMethod(jsii.String("GET"), envPolicyIntegration, &awsapigateway.MethodOptions{
+		Authorizer:        authorizer,
+		RequestParameters: envQueryParameters,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName:      jsii.String("get-env-policy-validator"),
+			ValidateRequestParameters: jsii.Bool(true),
+		},
+	})
+	policyResource.AddMethod(jsii.String("PUT"), envPolicyIntegration, &awsapigateway.MethodOptions{
+		Authorizer:        authorizer,
+		RequestParameters: envQueryParameters,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName:      jsii.String("save-env-policy-validator"),
+			ValidateRequestParameters: jsii.Bool(true),
+			ValidateRequestBody:       jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": saveEnvPolicyModel,
+		},
+	})
+	policyResource.AddMethod(jsii.String("DELETE"), envPolicyIntegration, &awsapigateway.MethodOptions{
+		Authorizer:        authorizer,
+		RequestParameters: envQueryParameters,
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName:      jsii.String("remove-env-policy-validator"),
+			ValidateRequestParameters: jsii.Bool(true),
+		},
+	})
+
+	serviceCredentialsIntegration := awsapigateway.NewLambdaIntegration(lambdas.serviceCredentials, &awsapigateway.LambdaIntegrationOptions{})
+	serviceCredentialsResource := orgIdResource.AddResource(jsii.String("service-credentials"), &awsapigateway.ResourceOptions{})
+	serviceCredentialIdResource := serviceCredentialsResource.AddResource(jsii.String("{credentialId}"), &awsapigateway.ResourceOptions{})
+
+	serviceCredentialsResource.AddMethod(jsii.String("GET"), serviceCredentialsIntegration, &awsapigateway.MethodOptions{})
+	serviceCredentialsResource.AddMethod(jsii.String("POST"), serviceCredentialsIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-service-credential-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createServiceCredentialModel,
+		},
+	})
+	serviceCredentialIdResource.AddMethod(jsii.String("DELETE"), serviceCredentialsIntegration, &awsapigateway.MethodOptions{})
+	serviceCredentialIdResource.AddResource(jsii.String("rotate"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), serviceCredentialsIntegration, &awsapigateway.MethodOptions{})
+
+	createShareLinkModel := awsapigateway.NewModel(stack, jsii.String("CreateShareLinkModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateShareLink"),
+		Schema:      &schema.CreateShareLinkRequestSchema,
+	})
+	shareLinksIntegration := awsapigateway.NewLambdaIntegration(lambdas.shareLinks, &awsapigateway.LambdaIntegrationOptions{})
+	shareLinksResource := repoIdResource.AddResource(jsii.String("share-links"), &awsapigateway.ResourceOptions{})
+
+	shareLinksResource.AddMethod(jsii.String("GET"), shareLinksIntegration, &awsapigateway.MethodOptions{})
+	shareLinksResource.AddMethod(jsii.String("POST"), shareLinksIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-share-link-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createShareLinkModel,
+		},
+	})
+	shareLinksResource.AddResource(jsii.String("{linkId}"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("DELETE"), shareLinksIntegration, &awsapigateway.MethodOptions{})
+
+	createSyncTargetModel := awsapigateway.NewModel(stack, jsii.String("CreateSyncTargetModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateSyncTarget"),
+		Schema:      &schema.CreateSyncTargetRequestSchema,
+	})
+	syncTargetsIntegration := awsapigateway.NewLambdaIntegration(lambdas.syncTargets, &awsapigateway.LambdaIntegrationOptions{})
+	syncTargetsResource := repoIdResource.AddResource(jsii.String("sync-targets"), &awsapigateway.ResourceOptions{})
+	syncTargetIdResource := syncTargetsResource.AddResource(jsii.String("{targetId}"), &awsapigateway.ResourceOptions{})
+
+	syncTargetsResource.AddMethod(jsii.String("GET"), syncTargetsIntegration, &awsapigateway.MethodOptions{})
+	syncTargetsResource.AddMethod(jsii.String("POST"), syncTargetsIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-sync-target-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createSyncTargetModel,
+		},
+	})
+	syncTargetIdResource.AddMethod(jsii.String("DELETE"), syncTargetsIntegration, &awsapigateway.MethodOptions{})
+	syncTargetIdResource.AddResource(jsii.String("sync"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), syncTargetsIntegration, &awsapigateway.MethodOptions{})
+
+	lockEnvModel := awsapigateway.NewModel(stack, jsii.String("LockEnvModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("LockEnv"),
+		Schema:      &schema.LockEnvRequestSchema,
+	})
+	envLocksIntegration := awsapigateway.NewLambdaIntegration(lambdas.envLocks, &awsapigateway.LambdaIntegrationOptions{})
+	envLocksResource := repoIdResource.AddResource(jsii.String("locks"), &awsapigateway.ResourceOptions{})
+
+	envLocksResource.AddMethod(jsii.String("GET"), envLocksIntegration, &awsapigateway.MethodOptions{})
+	envLocksResource.AddMethod(jsii.String("POST"), envLocksIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("lock-env-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": lockEnvModel,
+		},
+	})
+	envLocksResource.AddResource(jsii.String("{env}"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("DELETE"), envLocksIntegration, &awsapigateway.MethodOptions{})
+
+	reviewChangeRequestModel := awsapigateway.NewModel(stack, jsii.String("ReviewChangeRequestModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("ReviewChangeRequest"),
+		Schema:      &schema.ReviewChangeRequestRequestSchema,
+	})
+	reviewChangeRequestOptions := func(validatorName string) *awsapigateway.MethodOptions {
+		return &awsapigateway.MethodOptions{
+			RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+				RequestValidatorName: jsii.String(validatorName),
+				ValidateRequestBody:  jsii.Bool(true),
+			},
+			RequestModels: &map[string]awsapigateway.IModel{
+				"application/json": reviewChangeRequestModel,
+			},
+		}
+	}
+	changeRequestsIntegration := awsapigateway.NewLambdaIntegration(lambdas.changeRequests, &awsapigateway.LambdaIntegrationOptions{})
+	changeRequestsResource := orgIdResource.AddResource(jsii.String("change-requests"), &awsapigateway.ResourceOptions{})
+	changeRequestIdResource := changeRequestsResource.AddResource(jsii.String("{changeRequestId}"), &awsapigateway.ResourceOptions{})
+
+	changeRequestsResource.AddMethod(jsii.String("GET"), changeRequestsIntegration, &awsapigateway.MethodOptions{})
+	changeRequestIdResource.AddMethod(jsii.String("GET"), changeRequestsIntegration, &awsapigateway.MethodOptions{})
+	changeRequestIdResource.AddResource(jsii.String("approve"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), changeRequestsIntegration, reviewChangeRequestOptions("approve-change-request-validator"))
+	changeRequestIdResource.AddResource(jsii.String("reject"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), changeRequestsIntegration, reviewChangeRequestOptions("reject-change-request-validator"))
+
+	createWebhookModel := awsapigateway.NewModel(stack, jsii.String("CreateWebhookModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreateWebhook"),
+		Schema:      &schema.CreateWebhookRequestSchema,
+	})
+	webhooksIntegration := awsapigateway.NewLambdaIntegration(lambdas.webhooks, &awsapigateway.LambdaIntegrationOptions{})
+	webhooksResource := orgIdResource.AddResource(jsii.String("webhooks"), &awsapigateway.ResourceOptions{})
+	webhookIdResource := webhooksResource.AddResource(jsii.String("{webhookId}"), &awsapigateway.ResourceOptions{})
+
+	webhooksResource.AddMethod(jsii.String("GET"), webhooksIntegration, &awsapigateway.MethodOptions{})
+	webhooksResource.AddMethod(jsii.String("POST"), webhooksIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-webhook-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createWebhookModel,
+		},
+	})
+	webhookIdResource.AddMethod(jsii.String("DELETE"), webhooksIntegration, &awsapigateway.MethodOptions{})
+	webhookIdResource.AddResource(jsii.String("deliveries"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("GET"), webhooksIntegration, &awsapigateway.MethodOptions{})
+
+	orgIdResource.AddResource(jsii.String("rotation-report"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("GET"),
+			awsapigateway.NewLambdaIntegration(lambdas.rotationReport, &awsapigateway.LambdaIntegrationOptions{}),
+			&awsapigateway.MethodOptions{})
+
+	orgIdResource.AddResource(jsii.String("audit-log"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("GET"),
+			awsapigateway.NewLambdaIntegration(lambdas.auditLog, &awsapigateway.LambdaIntegrationOptions{}),
+			&awsapigateway.MethodOptions{Authorizer: authorizer})
+}
+
+// Share links carry their own secret, so opening one needs no authorizer
+func createShareResource(api awsapigateway.RestApi, props *CdkApiGatewayProps) {
+	api.Root().AddResource(jsii.String("share"), &awsapigateway.ResourceOptions{}).
+		AddResource(jsii.String("{token}"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("GET"),
+			awsapigateway.NewLambdaIntegration(props.CdkLambdaStackFunctions.shareLinks, &awsapigateway.LambdaIntegrationOptions{}),
+			&awsapigateway.MethodOptions{})
+}
+
+func createTokenResource(stack awscdk.Stack, api awsapigateway.RestApi, props *CdkApiGatewayProps, authorizer awsapigateway.IAuthorizer) {
+	personalAccessTokensIntegration := awsapigateway.NewLambdaIntegration(props.CdkLambdaStackFunctions.personalAccessTokens, &awsapigateway.LambdaIntegrationOptions{})
+	tokenResource := api.Root().AddResource(jsii.String("tokens"), &awsapigateway.ResourceOptions{
+		DefaultMethodOptions: &awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+		},
+	})
+	createPersonalAccessTokenModel := awsapigateway.NewModel(stack, jsii.String("CreatePersonalAccessTokenModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("CreatePersonalAccessToken"),
+		Schema:      &schema.CreatePersonalAccessTokenRequestSchema,
+	})
+
+	tokenResource.AddMethod(jsii.String("GET"), personalAccessTokensIntegration, &awsapigateway.MethodOptions{})
+	tokenResource.AddMethod(jsii.String("POST"), personalAccessTokensIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("create-personal-access-token-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": createPersonalAccessTokenModel,
+		},
+	})
+	tokenResource.AddResource(jsii.String("{tokenId}"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("DELETE"), personalAccessTokensIntegration, &awsapigateway.MethodOptions{})
+}
+
+// The CLI sessions of the caller, one per device login
+func createDeviceResource(stack awscdk.Stack, api awsapigateway.RestApi, props *CdkApiGatewayProps, authorizer awsapigateway.IAuthorizer) {
+	devicesIntegration := awsapigateway.NewLambdaIntegration(props.CdkLambdaStackFunctions.devices, &awsapigateway.LambdaIntegrationOptions{})
+	deviceResource := api.Root().AddResource(jsii.String("devices"), &awsapigateway.ResourceOptions{
+		DefaultMethodOptions: &awsapigateway.MethodOptions{
+			Authorizer: authorizer,
+		},
+	})
+	renameDeviceModel := awsapigateway.NewModel(stack, jsii.String("RenameDeviceModel"), &awsapigateway.ModelProps{
+		RestApi:     api,
+		ContentType: jsii.String("application/json"),
+		ModelName:   jsii.String("RenameDevice"),
+		Schema:      &schema.RenameDeviceRequestSchema,
+	})
+
+	deviceResource.AddMethod(jsii.String("GET"), devicesIntegration, &awsapigateway.MethodOptions{})
+	deviceResource.AddMethod(jsii.String("DELETE"), devicesIntegration, &awsapigateway.MethodOptions{})
+
+	deviceIdResource := deviceResource.AddResource(jsii.String("{deviceId}"), &awsapigateway.ResourceOptions{})
+
+	deviceIdResource.AddMethod(jsii.String("PATCH"), devicesIntegration, &awsapigateway.MethodOptions{
+		RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
+			RequestValidatorName: jsii.String("rename-device-validator"),
+			ValidateRequestBody:  jsii.Bool(true),
+		},
+		RequestModels: &map[string]awsapigateway.IModel{
+			"application/json": renameDeviceModel,
+		},
+	})
+	deviceIdResource.AddMethod(jsii.String("DELETE"), devicesIntegration, &awsapigateway.MethodOptions{})
 }
 
 func createAuthResource(api awsapigateway.RestApi, props *CdkApiGatewayProps) {
@@ -101,24 +592,27 @@ func createAuthResource(api awsapigateway.RestApi, props *CdkApiGatewayProps) {
 	lambdas := props.CdkLambdaStackFunctions
 	authResource := api.Root().AddResource(jsii.String("auth"), &awsapigateway.ResourceOptions{})
 
+	// The device authorization flow of RFC 8628; both endpoints take form encoded bodies, which the lambda validates
+	tokenAuthIntegration := awsapigateway.NewLambdaIntegration(lambdas.tokenAuth, &awsapigateway.LambdaIntegrationOptions{})
+
+	authResource.AddResource(jsii.String("device_authorization"), &awsapigateway.ResourceOptions{}).
+		AddMethod(jsii.String("POST"), tokenAuthIntegration, &awsapigateway.MethodOptions{})
 	authResource.AddResource(jsii.String("token"), &awsapigateway.ResourceOptions{}).
-		AddMethod(jsii.String(*jsii.String("GET")),
-			awsapigateway.NewLambdaIntegration(lambdas.tokenAuth, &awsapigateway.LambdaIntegrationOptions{}),
-			&awsapigateway.MethodOptions{
-				RequestParameters: &map[string]*bool{
-					"method.request.querystring.client_id": jsii.Bool(true),
-				},
-				RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
-					RequestValidatorName:      jsii.String("auth-token-validator"),
-					ValidateRequestParameters: jsii.Bool(true),
-				},
-			})
+		AddMethod(jsii.String("POST"), tokenAuthIntegration, &awsapigateway.MethodOptions{})
+
+	// The verification page: GET shows the form, POST confirms the user code and binds the browser before the redirect to Cognito
+	deviceAuthIntegration := awsapigateway.NewLambdaIntegration(lambdas.deviceAuth, &awsapigateway.LambdaIntegrationOptions{})
+	deviceResource := authResource.AddResource(jsii.String("device"), &awsapigateway.ResourceOptions{})
+
+	deviceResource.AddMethod(jsii.String("GET"), deviceAuthIntegration, &awsapigateway.MethodOptions{})
+	deviceResource.AddMethod(jsii.String("POST"), deviceAuthIntegration, &awsapigateway.MethodOptions{})
 
 	authResource.AddResource(jsii.String("callback"), &awsapigateway.ResourceOptions{}).
 		AddMethod(jsii.String("GET"),
 			awsapigateway.NewLambdaIntegration(lambdas.callbackAuth, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{
+				// Cognito sends error and error_description instead of the code when the login does not go through
 				RequestParameters: &map[string]*bool{
-					"method.request.querystring.code":  jsii.Bool(true),
+					"method.request.querystring.code":  jsii.Bool(false),
 					"method.request.querystring.state": jsii.Bool(true),
 				},
 				RequestValidatorOptions: &awsapigateway.RequestValidatorOptions{
@@ -162,3 +656,11 @@ func createAuthResource(api awsapigateway.RestApi, props *CdkApiGatewayProps) {
 func GetApiGatewayCallbackUri(restApiSubdomain *string) *string {
 	return jsii.Sprintf("https://%s/auth/callback", *restApiSubdomain)
 }
+
+func GetApiGatewayVerificationUri(restApiSubdomain *string) *string {
+	return jsii.Sprintf("https://%s/auth/device", *restApiSubdomain)
+}
+
+func GetApiGatewayShareLinkUri(restApiSubdomain *string) *string {
+	return jsii.Sprintf("https://%s/share", *restApiSubdomain)
+}
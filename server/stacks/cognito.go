@@ -9,6 +9,8 @@ import (
 	"github.com/aws/jsii-runtime-go"
 )
 
+const ResourceServerIdentifier = "moonenv"
+
 type CdkCognitoStackProps struct {
 	awscdk.StackProps
 	AuthSubdomain *string
@@ -39,6 +41,21 @@ func NewCognitoStack(scope constructs.Construct, id string, props *CdkCognitoSta
 		},
 	})
 	userPoolId := userPool.UserPoolId()
+	// Scopes granted to the machine-to-machine app clients that each org creates for its CI pipelines
+	userPool.AddResourceServer(jsii.String("MoonenvResourceServer"), &awscognito.UserPoolResourceServerOptions{
+		Identifier:                 jsii.String(ResourceServerIdentifier),
+		UserPoolResourceServerName: jsii.String("moonenv-resource-server"),
+		Scopes: &[]awscognito.ResourceServerScope{
+			awscognito.NewResourceServerScope(&awscognito.ResourceServerScopeProps{
+				ScopeName:        jsii.String("env:read"),
+				ScopeDescription: jsii.String("Pull environment files"),
+			}),
+			awscognito.NewResourceServerScope(&awscognito.ResourceServerScopeProps{
+				ScopeName:        jsii.String("env:write"),
+				ScopeDescription: jsii.String("Push environment files"),
+			}),
+		},
+	})
 	/**
 	* The parent domain must have a valid DNS A record.
 	* Ex.: for auth.moonenv.link, moonenv.link has a A record for 8.8.8.8
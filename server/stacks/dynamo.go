@@ -9,8 +9,12 @@ import (
 
 type CdkTableStackProps struct {
 	awscdk.StackProps
+	TableId      string
 	TableName    string
 	PartitionKey awsdynamodb.Attribute
+	SortKey      *awsdynamodb.Attribute
+	// A numeric attribute holding the epoch second after which DynamoDB deletes the item
+	TimeToLiveAttribute *string
 }
 
 func NewTableStack(scope constructs.Construct, id string, props *CdkTableStackProps) awsdynamodb.Table {
@@ -21,8 +25,10 @@ func NewTableStack(scope constructs.Construct, id string, props *CdkTableStackPr
 	}
 	stack := awscdk.NewStack(scope, &id, &sProps)
 
-	return awsdynamodb.NewTable(stack, jsii.String("MoonenvTokenCode"), &awsdynamodb.TableProps{
-		TableName:    &props.TableName,
-		PartitionKey: &props.PartitionKey,
+	return awsdynamodb.NewTable(stack, jsii.String(props.TableId), &awsdynamodb.TableProps{
+		TableName:           &props.TableName,
+		PartitionKey:        &props.PartitionKey,
+		SortKey:             props.SortKey,
+		TimeToLiveAttribute: props.TimeToLiveAttribute,
 	})
 }
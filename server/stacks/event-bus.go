@@ -0,0 +1,52 @@
+package stacks
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type CdkEventBusStackProps struct {
+	awscdk.StackProps
+	EventBusName *string
+}
+
+// Creates the bus the lambdas publish their domain events to. Every event is also kept in a log group and an
+// archive, so consumers can be added later and replay what they missed
+func NewEventBusStack(scope constructs.Construct, id string, props *CdkEventBusStackProps) awsevents.EventBus {
+	var sProps awscdk.StackProps
+
+	if props != nil {
+		sProps = props.StackProps
+	}
+	stack := awscdk.NewStack(scope, &id, &sProps)
+
+	eventBus := awsevents.NewEventBus(stack, jsii.String("MoonenvEventBus"), &awsevents.EventBusProps{
+		EventBusName: props.EventBusName,
+	})
+
+	eventPattern := &awsevents.EventPattern{
+		Source: jsii.Strings("moonenv"),
+	}
+
+	eventBus.Archive(jsii.String("MoonenvEventArchive"), &awsevents.BaseArchiveProps{
+		EventPattern: eventPattern,
+		Retention:    awscdk.Duration_Days(jsii.Number(90)),
+	})
+
+	logGroup := awslogs.NewLogGroup(stack, jsii.String("MoonenvEventLogGroup"), &awslogs.LogGroupProps{
+		LogGroupName: jsii.Sprintf("/aws/events/%s", *props.EventBusName),
+		Retention:    awslogs.RetentionDays_ONE_MONTH,
+	})
+
+	awsevents.NewRule(stack, jsii.String("MoonenvEventLogRule"), &awsevents.RuleProps{
+		EventBus:     eventBus,
+		EventPattern: eventPattern,
+		Targets:      &[]awsevents.IRuleTarget{awseventstargets.NewCloudWatchLogGroup(logGroup, nil)},
+	})
+
+	return eventBus
+}
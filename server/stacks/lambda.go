@@ -4,7 +4,11 @@ import (
 	"strconv"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awskms"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
 	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
@@ -15,21 +19,64 @@ import (
 type CdkLambdaStackProps struct {
 	awscdk.StackProps
 	awss3.Bucket
-	TokenCodeTable          awsdynamodb.Table
-	TokenCodeStateIndexName *string
-	AuthSubdomain           *string
-	RestApiSubdomain        *string
+	TokenCodeTable                   awsdynamodb.Table
+	TokenCodeStateIndexName          *string
+	TokenCodeUserCodeIndexName       *string
+	TokenCodeUserIndexName           *string
+	OrgTable                         awsdynamodb.Table
+	OrgMemberTable                   awsdynamodb.Table
+	OrgMemberUserIndexName           *string
+	RepoTable                        awsdynamodb.Table
+	EnvPolicyTable                   awsdynamodb.Table
+	AuditLogTable                    awsdynamodb.Table
+	ServiceCredentialTable           awsdynamodb.Table
+	PersonalAccessTokenTable         awsdynamodb.Table
+	PersonalAccessTokenUserIndexName *string
+	ShareLinkTable                   awsdynamodb.Table
+	ShareLinkOrgIndexName            *string
+	ChangeRequestTable               awsdynamodb.Table
+	WebhookTable                     awsdynamodb.Table
+	WebhookDeliveryTable             awsdynamodb.Table
+	SyncTargetTable                  awsdynamodb.Table
+	KeyRotationTable                 awsdynamodb.Table
+	KeyRotationFingerprintIndexName  *string
+	EnvLockTable                     awsdynamodb.Table
+	RateLimitTable                   awsdynamodb.Table
+	EventBus                         awsevents.IEventBus
+	UserPool                         awscognito.IUserPool
+	UserPoolClientId                 *string
+	AuthSubdomain                    *string
+	RestApiSubdomain                 *string
 }
 
 type CdkLambdaStackFunctions struct {
-	uploadFileFunc   awslambda.Function
-	downloadFileFunc awslambda.Function
-	tokenAuth        awslambda.Function
-	callbackAuth     awslambda.Function
-	refreshTokenAuth awslambda.Function
-	revokeTokenAuth  awslambda.Function
-	pullCommand      awslambda.Function
-	pushCommand      awslambda.Function
+	uploadFileFunc       awslambda.Function
+	downloadFileFunc     awslambda.Function
+	tokenAuth            awslambda.Function
+	callbackAuth         awslambda.Function
+	deviceAuth           awslambda.Function
+	refreshTokenAuth     awslambda.Function
+	revokeTokenAuth      awslambda.Function
+	pullCommand          awslambda.Function
+	pushCommand          awslambda.Function
+	orgMembers           awslambda.Function
+	envPolicy            awslambda.Function
+	auditLog             awslambda.Function
+	org                  awslambda.Function
+	transferOrg          awslambda.Function
+	repo                 awslambda.Function
+	serviceCredentials   awslambda.Function
+	authorizer           awslambda.Function
+	personalAccessTokens awslambda.Function
+	devices              awslambda.Function
+	shareLinks           awslambda.Function
+	changeRequests       awslambda.Function
+	deliverWebhook       awslambda.Function
+	webhooks             awslambda.Function
+	syncEnv              awslambda.Function
+	syncTargets          awslambda.Function
+	rotationReport       awslambda.Function
+	envLocks             awslambda.Function
 }
 
 func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaStackProps) *CdkLambdaStackFunctions {
@@ -54,15 +101,39 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 		FunctionName: jsii.String("moonenv-upload-file"),
 	})
 
+	deliverWebhook := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvDeliverWebhook"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Timeout:      awscdk.Duration_Seconds(jsii.Number(90)),
+		Entry:        jsii.String("./lambdas/deliver-webhook"),
+		FunctionName: jsii.String("moonenv-deliver-webhook"),
+		Environment: &map[string]*string{
+			"WebhookTableName":         props.WebhookTable.TableName(),
+			"WebhookDeliveryTableName": props.WebhookDeliveryTable.TableName(),
+		},
+	})
+
+	syncEnv := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvSyncEnv"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+		Entry:        jsii.String("./lambdas/sync-env"),
+		FunctionName: jsii.String("moonenv-sync-env"),
+		Environment: &map[string]*string{
+			"S3Bucket":            props.Bucket.BucketName(),
+			"SyncTargetTableName": props.SyncTargetTable.TableName(),
+		},
+	})
+
 	tokenAuth := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvAuthToken"), &awscdklambdagoalpha.GoFunctionProps{
 		MemorySize:   jsii.Number(128),
 		Entry:        jsii.String("./lambdas/endpoints/auth/token"),
 		FunctionName: jsii.String("moonenv-auth-token"),
 		Environment: &map[string]*string{
 			"TokenCodeTableName":       props.TokenCodeTable.TableName(),
-			"PollingIntervalInSeconds": jsii.String(strconv.FormatInt(int64(3), 10)),
+			"PollingIntervalInSeconds": jsii.String(strconv.FormatInt(int64(5), 10)),
 			"CognitoUrl":               props.AuthSubdomain,
 			"CallbackUri":              GetApiGatewayCallbackUri(props.RestApiSubdomain),
+			"VerificationUri":          GetApiGatewayVerificationUri(props.RestApiSubdomain),
+			"EventBusName":             props.EventBus.EventBusName(),
 		},
 	})
 
@@ -73,6 +144,17 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 		Environment: &map[string]*string{
 			"StateIndexName":     props.TokenCodeStateIndexName,
 			"TokenCodeTableName": props.TokenCodeTable.TableName(),
+			"OrgTableName":       props.OrgTable.TableName(),
+		},
+	})
+
+	deviceAuth := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvAuthDevice"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.Sprintf("./lambdas/endpoints/auth/device"),
+		FunctionName: jsii.Sprintf("moonenv-auth-device"),
+		Environment: &map[string]*string{
+			"UserCodeIndexName":  props.TokenCodeUserCodeIndexName,
+			"TokenCodeTableName": props.TokenCodeTable.TableName(),
 		},
 	})
 
@@ -83,6 +165,7 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 		Environment: &map[string]*string{
 			"CognitoUrl":         props.AuthSubdomain,
 			"TokenCodeTableName": props.TokenCodeTable.TableName(),
+			"EventBusName":       props.EventBus.EventBusName(),
 		},
 	})
 
@@ -93,6 +176,19 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 		Environment: &map[string]*string{
 			"CognitoUrl":         props.AuthSubdomain,
 			"TokenCodeTableName": props.TokenCodeTable.TableName(),
+			"EventBusName":       props.EventBus.EventBusName(),
+		},
+	})
+
+	devices := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvAuthDevices"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.Sprintf("./lambdas/endpoints/auth/devices"),
+		FunctionName: jsii.Sprintf("moonenv-auth-devices"),
+		Environment: &map[string]*string{
+			"CognitoUrl":         props.AuthSubdomain,
+			"TokenCodeTableName": props.TokenCodeTable.TableName(),
+			"UserIndexName":      props.TokenCodeUserIndexName,
+			"EventBusName":       props.EventBus.EventBusName(),
 		},
 	})
 
@@ -101,18 +197,47 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 		Entry:        jsii.String("./lambdas/endpoints/orchestrator/pull"),
 		FunctionName: jsii.String("moonenv-pull-command"),
 		Environment: &map[string]*string{
-			"AwsRegion":        props.StackProps.Env.Region,
-			"DownloadFuncName": downloadFileFunc.FunctionArn(),
+			"AwsRegion":          props.StackProps.Env.Region,
+			"DownloadFuncName":   downloadFileFunc.FunctionArn(),
+			"OrgTableName":       props.OrgTable.TableName(),
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName": props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+			"EventBusName":       props.EventBus.EventBusName(),
 		},
 	})
 
 	pushCommand := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvPushCommand"), &awscdklambdagoalpha.GoFunctionProps{
 		MemorySize:   jsii.Number(128),
+		Timeout:      awscdk.Duration_Seconds(jsii.Number(29)),
 		Entry:        jsii.String("./lambdas/endpoints/orchestrator/push"),
 		FunctionName: jsii.String("moonenv-push-command"),
 		Environment: &map[string]*string{
-			"AwsRegion":      props.StackProps.Env.Region,
-			"UploadFuncName": uploadFileFunc.FunctionArn(),
+			"AwsRegion":                       props.StackProps.Env.Region,
+			"UploadFuncName":                  uploadFileFunc.FunctionArn(),
+			"DownloadFuncName":                downloadFileFunc.FunctionArn(),
+			"OrgTableName":                    props.OrgTable.TableName(),
+			"RepoTableName":                   props.RepoTable.TableName(),
+			"OrgMemberTableName":              props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName":              props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":               props.AuditLogTable.TableName(),
+			"ChangeRequestTableName":          props.ChangeRequestTable.TableName(),
+			"DeliverWebhookFuncName":          deliverWebhook.FunctionArn(),
+			"EventBusName":                    props.EventBus.EventBusName(),
+			"SyncEnvFuncName":                 syncEnv.FunctionArn(),
+			"KeyRotationTableName":            props.KeyRotationTable.TableName(),
+			"KeyRotationFingerprintIndexName": props.KeyRotationFingerprintIndexName,
+			"EnvLockTableName":                props.EnvLockTable.TableName(),
+			"S3Bucket":                        props.Bucket.BucketName(),
+		},
+	})
+
+	orgMembers := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvOrgMembers"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/members"),
+		FunctionName: jsii.String("moonenv-org-members"),
+		Environment: &map[string]*string{
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
 		},
 	})
 
@@ -122,20 +247,430 @@ func NewCdkLambdaStack(scope constructs.Construct, id string, props *CdkLambdaSt
 	downloadFileFunc.GrantInvoke(pullCommand.Role())
 	uploadFileFunc.GrantInvoke(pushCommand.Role())
 
-	authTypes := []awslambda.Function{refreshTokenAuth, tokenAuth, callbackAuth, revokeTokenAuth}
+	envPolicy := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvEnvPolicy"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/env-policy"),
+		FunctionName: jsii.String("moonenv-env-policy"),
+		Environment: &map[string]*string{
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName": props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+		},
+	})
+
+	auditLog := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvAuditLog"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/audit-log"),
+		FunctionName: jsii.String("moonenv-audit-log"),
+		Environment: &map[string]*string{
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+		},
+	})
+
+	org := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvOrg"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/org"),
+		FunctionName: jsii.String("moonenv-org"),
+		Environment: &map[string]*string{
+			"S3Bucket":               props.Bucket.BucketName(),
+			"OrgTableName":           props.OrgTable.TableName(),
+			"OrgMemberTableName":     props.OrgMemberTable.TableName(),
+			"OrgMemberUserIndexName": props.OrgMemberUserIndexName,
+			"AuditLogTableName":      props.AuditLogTable.TableName(),
+		},
+	})
+
+	// Not behind the API: operators invoke it to register the orgs that were created implicitly on the first push
+	registerOrg := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvRegisterOrg"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/register-org"),
+		FunctionName: jsii.String("moonenv-register-org"),
+		Environment: &map[string]*string{
+			"S3Bucket":           props.Bucket.BucketName(),
+			"OrgTableName":       props.OrgTable.TableName(),
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"RepoTableName":      props.RepoTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+		},
+	})
+
+	transferOrg := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvTransferOrg"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/transfer"),
+		FunctionName: jsii.String("moonenv-transfer-org"),
+		Environment: &map[string]*string{
+			"OrgTableName":       props.OrgTable.TableName(),
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+		},
+	})
+
+	repo := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvRepo"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Timeout:      awscdk.Duration_Seconds(jsii.Number(29)),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/repo"),
+		FunctionName: jsii.String("moonenv-repo"),
+		Environment: &map[string]*string{
+			"S3Bucket":               props.Bucket.BucketName(),
+			"OrgTableName":           props.OrgTable.TableName(),
+			"OrgMemberTableName":     props.OrgMemberTable.TableName(),
+			"RepoTableName":          props.RepoTable.TableName(),
+			"EnvPolicyTableName":     props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":      props.AuditLogTable.TableName(),
+			"AwsRegion":              props.StackProps.Env.Region,
+			"DeliverWebhookFuncName": deliverWebhook.FunctionArn(),
+			"EventBusName":           props.EventBus.EventBusName(),
+			"KeyRotationTableName":   props.KeyRotationTable.TableName(),
+			"EnvLockTableName":       props.EnvLockTable.TableName(),
+			"SyncTargetTableName":    props.SyncTargetTable.TableName(),
+			"ShareLinkTableName":     props.ShareLinkTable.TableName(),
+			"ShareLinkOrgIndexName":  props.ShareLinkOrgIndexName,
+			"ChangeRequestTableName": props.ChangeRequestTable.TableName(),
+			"WebhookTableName":       props.WebhookTable.TableName(),
+		},
+	})
+
+	serviceCredentials := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvServiceCredentials"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/service-credentials"),
+		FunctionName: jsii.String("moonenv-service-credentials"),
+		Environment: &map[string]*string{
+			"UserPoolId":                 props.UserPool.UserPoolId(),
+			"OrgMemberTableName":         props.OrgMemberTable.TableName(),
+			"ServiceCredentialTableName": props.ServiceCredentialTable.TableName(),
+			"AuditLogTableName":          props.AuditLogTable.TableName(),
+		},
+	})
+
+	authorizer := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvAuthorizer"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/auth/authorizer"),
+		FunctionName: jsii.String("moonenv-authorizer"),
+		Environment: &map[string]*string{
+			"UserPoolId":                   props.UserPool.UserPoolId(),
+			"UserPoolClientId":             props.UserPoolClientId,
+			"PersonalAccessTokenTableName": props.PersonalAccessTokenTable.TableName(),
+			"DefaultUsageKey":              jsii.String(defaultUsageKey),
+			"IntegrationUsageKey":          jsii.String(integrationUsageKey),
+		},
+	})
+
+	personalAccessTokens := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvPersonalAccessTokens"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/tokens/personal-access-tokens"),
+		FunctionName: jsii.String("moonenv-personal-access-tokens"),
+		Environment: &map[string]*string{
+			"PersonalAccessTokenTableName":     props.PersonalAccessTokenTable.TableName(),
+			"PersonalAccessTokenUserIndexName": props.PersonalAccessTokenUserIndexName,
+		},
+	})
+
+	shareLinks := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvShareLinks"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orchestrator/share"),
+		FunctionName: jsii.String("moonenv-share-links"),
+		Environment: &map[string]*string{
+			"AwsRegion":             props.StackProps.Env.Region,
+			"DownloadFuncName":      downloadFileFunc.FunctionArn(),
+			"ShareLinkUri":          GetApiGatewayShareLinkUri(props.RestApiSubdomain),
+			"OrgTableName":          props.OrgTable.TableName(),
+			"OrgMemberTableName":    props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName":    props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":     props.AuditLogTable.TableName(),
+			"ShareLinkTableName":    props.ShareLinkTable.TableName(),
+			"ShareLinkOrgIndexName": props.ShareLinkOrgIndexName,
+			"EventBusName":          props.EventBus.EventBusName(),
+		},
+	})
+
+	downloadFileFunc.GrantInvoke(shareLinks.Role())
+	props.OrgTable.GrantReadData(shareLinks)
+	props.OrgMemberTable.GrantReadData(shareLinks)
+	props.EnvPolicyTable.GrantReadData(shareLinks)
+	props.AuditLogTable.GrantWriteData(shareLinks)
+	props.ShareLinkTable.GrantReadWriteData(shareLinks)
+	// Approvals go through the same checks as a push
+	changeRequests := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvChangeRequests"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Timeout:      awscdk.Duration_Seconds(jsii.Number(29)),
+		Entry:        jsii.String("./lambdas/endpoints/orchestrator/change-requests"),
+		FunctionName: jsii.String("moonenv-change-requests"),
+		Environment: &map[string]*string{
+			"AwsRegion":                       props.StackProps.Env.Region,
+			"UploadFuncName":                  uploadFileFunc.FunctionArn(),
+			"OrgTableName":                    props.OrgTable.TableName(),
+			"RepoTableName":                   props.RepoTable.TableName(),
+			"OrgMemberTableName":              props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName":              props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":               props.AuditLogTable.TableName(),
+			"ChangeRequestTableName":          props.ChangeRequestTable.TableName(),
+			"DeliverWebhookFuncName":          deliverWebhook.FunctionArn(),
+			"EventBusName":                    props.EventBus.EventBusName(),
+			"SyncEnvFuncName":                 syncEnv.FunctionArn(),
+			"DownloadFuncName":                downloadFileFunc.FunctionArn(),
+			"KeyRotationTableName":            props.KeyRotationTable.TableName(),
+			"KeyRotationFingerprintIndexName": props.KeyRotationFingerprintIndexName,
+			"EnvLockTableName":                props.EnvLockTable.TableName(),
+			"S3Bucket":                        props.Bucket.BucketName(),
+		},
+	})
+
+	webhooks := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvWebhooks"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/webhooks"),
+		FunctionName: jsii.String("moonenv-webhooks"),
+		Environment: &map[string]*string{
+			"OrgMemberTableName":       props.OrgMemberTable.TableName(),
+			"AuditLogTableName":        props.AuditLogTable.TableName(),
+			"WebhookTableName":         props.WebhookTable.TableName(),
+			"WebhookDeliveryTableName": props.WebhookDeliveryTable.TableName(),
+		},
+	})
+
+	syncTargets := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvSyncTargets"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/sync-targets"),
+		FunctionName: jsii.String("moonenv-sync-targets"),
+		Environment: &map[string]*string{
+			"AwsRegion":           props.StackProps.Env.Region,
+			"SyncEnvFuncName":     syncEnv.FunctionArn(),
+			"OrgTableName":        props.OrgTable.TableName(),
+			"OrgMemberTableName":  props.OrgMemberTable.TableName(),
+			"RepoTableName":       props.RepoTable.TableName(),
+			"EnvPolicyTableName":  props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":   props.AuditLogTable.TableName(),
+			"SyncTargetTableName": props.SyncTargetTable.TableName(),
+		},
+	})
+
+	// Sync targets live under /moonenv/{orgId}/ in SSM and moonenv/{orgId}/ in Secrets Manager; the lambdas keep
+	// each org to its own part of the namespace
+	syncEnv.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("ssm:PutParameter", "ssm:AddTagsToResource", "ssm:DeleteParameters"),
+		Resources: jsii.Strings(*jsii.Sprintf("arn:aws:ssm:%s:%s:parameter/moonenv/*", *props.StackProps.Env.Region, *props.StackProps.Env.Account)),
+	}))
+	// DescribeParameters does not support resource level permissions
+	syncEnv.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("ssm:DescribeParameters"),
+		Resources: jsii.Strings("*"),
+	}))
+	syncEnv.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("secretsmanager:CreateSecret", "secretsmanager:PutSecretValue", "secretsmanager:TagResource"),
+		Resources: jsii.Strings(*jsii.Sprintf("arn:aws:secretsmanager:%s:%s:secret:moonenv/*", *props.StackProps.Env.Region, *props.StackProps.Env.Account)),
+	}))
+	// Imports read the source with the role of the push lambda, from the same namespace as the sync targets
+	pushCommand.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("ssm:GetParametersByPath"),
+		Resources: jsii.Strings(*jsii.Sprintf("arn:aws:ssm:%s:%s:parameter/moonenv/*", *props.StackProps.Env.Region, *props.StackProps.Env.Account)),
+	}))
+	pushCommand.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("secretsmanager:GetSecretValue"),
+		Resources: jsii.Strings(*jsii.Sprintf("arn:aws:secretsmanager:%s:%s:secret:moonenv/*", *props.StackProps.Env.Region, *props.StackProps.Env.Account)),
+	}))
+	props.Bucket.GrantRead(syncEnv.Role(), nil)
+	props.SyncTargetTable.GrantReadWriteData(syncEnv)
+	props.SyncTargetTable.GrantReadWriteData(syncTargets)
+	props.OrgTable.GrantReadData(syncTargets)
+	props.OrgMemberTable.GrantReadData(syncTargets)
+	props.RepoTable.GrantReadData(syncTargets)
+	props.EnvPolicyTable.GrantReadData(syncTargets)
+	props.AuditLogTable.GrantWriteData(syncTargets)
+	rotationReport := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvRotationReport"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/rotation-report"),
+		FunctionName: jsii.String("moonenv-rotation-report"),
+		Environment: &map[string]*string{
+			"OrgTableName":         props.OrgTable.TableName(),
+			"OrgMemberTableName":   props.OrgMemberTable.TableName(),
+			"KeyRotationTableName": props.KeyRotationTable.TableName(),
+		},
+	})
+
+	props.OrgTable.GrantReadData(rotationReport)
+	props.OrgMemberTable.GrantReadData(rotationReport)
+	props.KeyRotationTable.GrantReadData(rotationReport)
+	props.KeyRotationTable.GrantReadWriteData(pushCommand)
+	props.KeyRotationTable.GrantReadWriteData(changeRequests)
+	props.KeyRotationTable.GrantReadWriteData(repo)
+	envLocks := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("MoonenvEnvLocks"), &awscdklambdagoalpha.GoFunctionProps{
+		MemorySize:   jsii.Number(128),
+		Entry:        jsii.String("./lambdas/endpoints/orgs/env-locks"),
+		FunctionName: jsii.String("moonenv-env-locks"),
+		Environment: &map[string]*string{
+			"OrgTableName":       props.OrgTable.TableName(),
+			"OrgMemberTableName": props.OrgMemberTable.TableName(),
+			"EnvPolicyTableName": props.EnvPolicyTable.TableName(),
+			"AuditLogTableName":  props.AuditLogTable.TableName(),
+			"EnvLockTableName":   props.EnvLockTable.TableName(),
+		},
+	})
+
+	props.OrgTable.GrantReadData(envLocks)
+	props.OrgMemberTable.GrantReadData(envLocks)
+	props.EnvPolicyTable.GrantReadData(envLocks)
+	props.AuditLogTable.GrantWriteData(envLocks)
+	props.EnvLockTable.GrantReadWriteData(envLocks)
+	props.EnvLockTable.GrantReadData(pushCommand)
+	props.EnvLockTable.GrantReadData(changeRequests)
+	props.EnvLockTable.GrantReadWriteData(repo)
+	props.OrgTable.GrantReadWriteData(repo)
+	downloadFileFunc.GrantInvoke(changeRequests.Role())
+	syncEnv.GrantInvoke(pushCommand.Role())
+	syncEnv.GrantInvoke(changeRequests.Role())
+	syncEnv.GrantInvoke(syncTargets.Role())
+	deliverWebhook.GrantInvoke(pushCommand.Role())
+	deliverWebhook.GrantInvoke(changeRequests.Role())
+	deliverWebhook.GrantInvoke(repo.Role())
+	props.WebhookTable.GrantReadData(deliverWebhook)
+	props.WebhookDeliveryTable.GrantWriteData(deliverWebhook)
+	props.WebhookTable.GrantReadWriteData(webhooks)
+	props.WebhookDeliveryTable.GrantReadData(webhooks)
+	props.OrgMemberTable.GrantReadData(webhooks)
+	props.AuditLogTable.GrantWriteData(webhooks)
+	downloadFileFunc.GrantInvoke(pushCommand.Role())
+	uploadFileFunc.GrantInvoke(changeRequests.Role())
+	props.ChangeRequestTable.GrantWriteData(pushCommand)
+	props.ChangeRequestTable.GrantReadWriteData(changeRequests)
+	props.OrgTable.GrantReadWriteData(changeRequests)
+	props.OrgMemberTable.GrantReadData(changeRequests)
+	props.EnvPolicyTable.GrantReadData(changeRequests)
+	props.AuditLogTable.GrantWriteData(changeRequests)
+	props.PersonalAccessTokenTable.GrantReadWriteData(authorizer)
+	props.PersonalAccessTokenTable.GrantReadWriteData(personalAccessTokens)
+	serviceCredentials.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("cognito-idp:CreateUserPoolClient", "cognito-idp:DeleteUserPoolClient"),
+		Resources: jsii.Strings(*props.UserPool.UserPoolArn()),
+	}))
+	props.OrgMemberTable.GrantReadWriteData(serviceCredentials)
+	props.ServiceCredentialTable.GrantReadWriteData(serviceCredentials)
+	props.AuditLogTable.GrantWriteData(serviceCredentials)
+	props.Bucket.GrantReadWrite(repo.Role(), "*")
+	props.Bucket.GrantDelete(repo.Role(), "*")
+	props.OrgMemberTable.GrantReadData(repo)
+	props.RepoTable.GrantReadWriteData(repo)
+	props.SyncTargetTable.GrantReadData(repo)
+	props.ShareLinkTable.GrantReadData(repo)
+	props.ChangeRequestTable.GrantReadData(repo)
+	props.WebhookTable.GrantReadData(repo)
+	props.RepoTable.GrantReadWriteData(pushCommand)
+	props.RepoTable.GrantReadWriteData(changeRequests)
+	props.EnvPolicyTable.GrantReadWriteData(repo)
+	props.AuditLogTable.GrantWriteData(repo)
+	props.OrgTable.GrantReadData(pullCommand)
+	props.OrgTable.GrantReadWriteData(pushCommand)
+	props.OrgTable.GrantReadWriteData(org)
+	props.OrgTable.GrantReadWriteData(registerOrg)
+	props.Bucket.GrantRead(org.Role(), "*")
+	props.OrgTable.GrantReadWriteData(transferOrg)
+	props.OrgMemberTable.GrantReadWriteData(org)
+	props.OrgMemberTable.GrantReadWriteData(registerOrg)
+	props.RepoTable.GrantReadWriteData(registerOrg)
+	props.Bucket.GrantRead(registerOrg.Role(), "*")
+	props.OrgMemberTable.GrantReadWriteData(transferOrg)
+	props.AuditLogTable.GrantWriteData(org)
+	props.AuditLogTable.GrantWriteData(registerOrg)
+	props.AuditLogTable.GrantWriteData(transferOrg)
+	props.OrgMemberTable.GrantReadData(pullCommand)
+	props.OrgMemberTable.GrantReadData(pushCommand)
+	props.OrgMemberTable.GrantReadWriteData(orgMembers)
+	props.OrgMemberTable.GrantReadData(envPolicy)
+	props.OrgMemberTable.GrantReadData(auditLog)
+	props.EnvPolicyTable.GrantReadData(pullCommand)
+	props.EnvPolicyTable.GrantReadData(pushCommand)
+	props.EnvPolicyTable.GrantReadWriteData(envPolicy)
+	props.AuditLogTable.GrantWriteData(pullCommand)
+	props.AuditLogTable.GrantWriteData(pushCommand)
+	props.AuditLogTable.GrantWriteData(envPolicy)
+	props.AuditLogTable.GrantReadData(auditLog)
+
+	eventPublishers := []awslambda.Function{tokenAuth, refreshTokenAuth, revokeTokenAuth, devices, pullCommand, pushCommand, shareLinks, changeRequests, repo}
+
+	for _, eventPublisher := range eventPublishers {
+		props.EventBus.GrantPutEventsTo(eventPublisher)
+	}
+
+	// Pushes also count against the quotas of the org, and device codes against the limit of the source IP
+	rateLimited := []awslambda.Function{tokenAuth, pullCommand, pushCommand, shareLinks, changeRequests, envLocks}
+
+	for _, function := range rateLimited {
+		function.AddEnvironment(jsii.String("RateLimitTableName"), props.RateLimitTable.TableName(), nil)
+		props.RateLimitTable.GrantReadWriteData(function)
+	}
+
+	// Counts the storage of orgs created before it was kept on the org, on their first push
+	props.Bucket.GrantRead(pushCommand.Role(), nil)
+	props.Bucket.GrantRead(changeRequests.Role(), nil)
+
+	authTypes := []awslambda.Function{refreshTokenAuth, tokenAuth, callbackAuth, deviceAuth, revokeTokenAuth, devices}
+
+	// Encrypts the data keys that protect the PKCE verifier, the login code and the authorization URI of each device record
+	tokenCodeKey := awskms.NewKey(stack, jsii.String("MoonenvTokenCodeKey"), &awskms.KeyProps{
+		Alias:             jsii.String("alias/moonenv-token-code"),
+		Description:       jsii.String("Encrypts the secrets of the device authorization records"),
+		EnableKeyRotation: jsii.Bool(true),
+	})
 
 	for _, auth := range authTypes {
 		props.TokenCodeTable.GrantReadWriteData(auth)
+		auth.AddEnvironment(jsii.String("TokenCodeKeyId"), tokenCodeKey.KeyArn(), nil)
+		tokenCodeKey.GrantEncryptDecrypt(auth)
+	}
+
+	// The landing page of the callback shows the name of the org the CLI signs in for
+	props.OrgTable.GrantReadData(callbackAuth)
+
+	// Encrypts the data keys that protect the signing secret of each webhook
+	webhookKey := awskms.NewKey(stack, jsii.String("MoonenvWebhookKey"), &awskms.KeyProps{
+		Alias:             jsii.String("alias/moonenv-webhook"),
+		Description:       jsii.String("Encrypts the signing secrets of the webhooks"),
+		EnableKeyRotation: jsii.Bool(true),
+	})
+
+	webhooks.AddEnvironment(jsii.String("WebhookKeyId"), webhookKey.KeyArn(), nil)
+	webhookKey.GrantEncrypt(webhooks)
+	webhookKey.GrantDecrypt(deliverWebhook)
+
+	// Derives the per org keys that fingerprint the values of the envs, to find duplicated secrets without storing them
+	fingerprintKey := awskms.NewKey(stack, jsii.String("MoonenvFingerprintKey"), &awskms.KeyProps{
+		Alias:       jsii.String("alias/moonenv-fingerprint"),
+		Description: jsii.String("Derives the keys that fingerprint the values of the envs"),
+		KeySpec:     awskms.KeySpec_HMAC_256,
+		KeyUsage:    awskms.KeyUsage_GENERATE_VERIFY_MAC,
+	})
+
+	for _, function := range []awslambda.Function{pushCommand, changeRequests} {
+		function.AddEnvironment(jsii.String("FingerprintKeyId"), fingerprintKey.KeyArn(), nil)
+		fingerprintKey.Grant(function, jsii.String("kms:GenerateMac"))
 	}
 
 	return &CdkLambdaStackFunctions{
-		uploadFileFunc:   uploadFileFunc,
-		downloadFileFunc: downloadFileFunc,
-		tokenAuth:        tokenAuth,
-		callbackAuth:     callbackAuth,
-		refreshTokenAuth: refreshTokenAuth,
-		revokeTokenAuth:  revokeTokenAuth,
-		pullCommand:      pullCommand,
-		pushCommand:      pushCommand,
+		uploadFileFunc:       uploadFileFunc,
+		downloadFileFunc:     downloadFileFunc,
+		tokenAuth:            tokenAuth,
+		callbackAuth:         callbackAuth,
+		deviceAuth:           deviceAuth,
+		refreshTokenAuth:     refreshTokenAuth,
+		revokeTokenAuth:      revokeTokenAuth,
+		pullCommand:          pullCommand,
+		pushCommand:          pushCommand,
+		orgMembers:           orgMembers,
+		envPolicy:            envPolicy,
+		auditLog:             auditLog,
+		org:                  org,
+		transferOrg:          transferOrg,
+		repo:                 repo,
+		serviceCredentials:   serviceCredentials,
+		authorizer:           authorizer,
+		personalAccessTokens: personalAccessTokens,
+		devices:              devices,
+		shareLinks:           shareLinks,
+		changeRequests:       changeRequests,
+		deliverWebhook:       deliverWebhook,
+		webhooks:             webhooks,
+		syncEnv:              syncEnv,
+		syncTargets:          syncTargets,
+		rotationReport:       rotationReport,
+		envLocks:             envLocks,
 	}
 }